@@ -1,6 +1,7 @@
 package api
 
 import (
+	"fmt"
 	"io"
 	"time"
 )
@@ -10,6 +11,58 @@ var (
 	DirectionWa2tg = "wa2tg"
 	ChattedYes     = "yes"
 	ChattedNo      = "no"
+
+	OutboxPending   = "pending"
+	OutboxSent      = "sent"
+	OutboxDead      = "dead"
+	OutboxScheduled = "scheduled"
+	OutboxCanceled  = "canceled"
+
+	UndeliveredPending   = "pending"
+	UndeliveredDelivered = "delivered"
+	UndeliveredDead      = "dead"
+
+	AssignRoundRobin  = "roundrobin"
+	AssignLeastLoaded = "leastloaded"
+	AssignLast        = "last"
+
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+
+	SLAFirst     = "first"
+	SLANext      = "next"
+	SLABreached  = "breached"
+	SLAEscalated = "escalated"
+
+	ReminderPending = "pending"
+	ReminderSent    = "sent"
+	ReminderDone    = "done"
+
+	AssignmentNew       = "new"
+	AssignmentPending   = "pending"
+	AssignmentAccepted  = "accepted"
+	AssignmentClosed    = "closed"
+	AssignmentEscalated = "escalated"
+
+	CampaignDraft    = "draft"
+	CampaignRunning  = "running"
+	CampaignPaused   = "paused"
+	CampaignDone     = "done"
+	CampaignCanceled = "canceled"
+
+	RecipientPending = "pending"
+	RecipientSent    = "sent"
+	RecipientFailed  = "failed"
+	RecipientOptOut  = "optout"
+
+	RevokeStatusRevoked = "revoked"
+	RevokeStatusFailed  = "failed"
+
+	ConnectionConnecting = "connecting"
+	ConnectionConnected  = "connected"
+	ConnectionLoggedOut  = "logged-out"
+	ConnectionBackoff    = "backoff"
 )
 
 type WAMessage struct {
@@ -50,6 +103,9 @@ type Message struct {
 	MessageStatus  int
 	Text           string
 	Session        string
+	RevokeStatus   string
+	RevokedBy      string
+	AfterHours     bool
 }
 
 type Chat struct {
@@ -61,10 +117,160 @@ type Chat struct {
 }
 
 type MainGroup struct {
-	TGChatID     int64
-	Name         string
-	MessagePin   int
-	LoggerChatID int64
+	TGChatID      int64
+	Name          string
+	MessagePin    int
+	LoggerChatID  int64
+	Topics        bool
+	AssignPolicy  string
+	AssignTimeout time.Duration
+	SLAFirst      time.Duration
+	SLANext       time.Duration
+	SLAEscalate   time.Duration
+	NotePrefix    string
+	OptOutKeyword string
+}
+
+// Operator Telegram user registered in private chat with bot to get assigned clients
+type Operator struct {
+	TGUserID       int
+	TGUserName     string
+	LastAssignedAt time.Time
+	Presence       string
+	PresenceAt     time.Time
+	AwayAfter      time.Duration
+	LastActiveAt   time.Time
+	Supervisor     bool
+}
+
+// Assignment offer of new WhatsApp client to operator, escalated to main group after ExpiresAt.
+// New assignment waits worker to pick operator, then it is pending offer to the operator.
+// MessageID is offer in private chat of operator, MGMessageID is new client message of main group
+type Assignment struct {
+	ID          uint
+	MGID        string
+	WAClient    string
+	Name        string
+	TGUserID    int
+	TGUserName  string
+	MessageID   int
+	MGMessageID int
+	Status      string
+	ExpiresAt   time.Time
+}
+
+// SLABreach WhatsApp client waited answer longer than SLA of main group, one record per level of
+// waiting started by message WAMessageID
+type SLABreach struct {
+	ID          uint
+	MGID        string
+	WAClient    string
+	WAMessageID string
+	Kind        string
+	Level       string
+	TGUserName  string
+	Waited      time.Duration
+	CreatedAt   time.Time
+}
+
+// Canned response of main group sent by key, Text is text/template with client, operator and main group
+type Canned struct {
+	ID   uint
+	MGID string
+	Key  string
+	Text string
+}
+
+// Reminder ping of operator TGUserID about client at RemindAt in chat TGChatID or in main group when chat left
+type Reminder struct {
+	ID          uint
+	MGID        string
+	WAClient    string
+	TGChatID    int64
+	TGMessageID int
+	TGUserID    int
+	TGUserName  string
+	Note        string
+	Status      string
+	RemindAt    time.Time
+}
+
+// Campaign broadcast of Text to WhatsApp clients of Segment, progress is shown in main group message MessageID
+type Campaign struct {
+	ID         uint
+	MGID       string
+	Segment    string
+	Text       string
+	TGUserName string
+	Status     string
+	MessageID  int
+	NextAt     time.Time
+}
+
+// CampaignRecipient WhatsApp client of campaign with status of send
+type CampaignRecipient struct {
+	ID          uint
+	CampaignID  uint
+	WAClient    string
+	Status      string
+	WAMessageID string
+	Error       string
+}
+
+// OptOut WhatsApp client excluded from campaigns of main group
+type OptOut struct {
+	ID       uint
+	MGID     string
+	WAClient string
+}
+
+// Watch supervisor TGUserID gets read-only copy of traffic with WAClient or of chats of Operator
+type Watch struct {
+	ID         uint
+	MGID       string
+	TGUserID   int
+	TGUserName string
+	WAClient   string
+	Operator   string
+}
+
+// Note internal note of operator on WhatsApp client, never sent to the client
+type Note struct {
+	ID         uint
+	MGID       string
+	WAClient   string
+	TGUserName string
+	Text       string
+	CreatedAt  time.Time
+}
+
+// Transfer handover of conversation with WhatsApp client between operators
+type Transfer struct {
+	MGID       string
+	WAClient   string
+	Session    string
+	FromUser   string
+	ToUser     string
+	FromChatID int64
+	ToChatID   int64
+	Note       string
+	CreatedAt  time.Time
+}
+
+// FreeChat Telegram chat with bot not joined to any WhatsApp client, MGID is main group the chat served,
+// empty until the chat joins a client
+type FreeChat struct {
+	MGID     string
+	TGChatID int64
+	Title    string
+}
+
+// Topic forum topic of main group for WhatsApp client, ThreadID is message_thread_id of topic
+type Topic struct {
+	MGID     string
+	WAClient string
+	ThreadID int
+	Name     string
 }
 
 type Stat struct {
@@ -101,12 +307,133 @@ type Contact struct {
 	ShortName string
 }
 
+// Outbox tg2wa message waiting for delivery to WhatsApp, scheduled message waits NextAt to become pending
+type Outbox struct {
+	ID             uint
+	MGID           string
+	WAClient       string
+	TGChatID       int64
+	TGUserName     string
+	TGMessageID    int
+	TGTimestamp    int
+	TGFwdMessageID int
+	TGFwdChatID    int64
+	Session        string
+	Kind           string
+	Text           string
+	FileID         string
+	FileName       string
+	Mime           string
+	Lat            float64
+	Lon            float64
+	Phone          string
+	Name           string
+	QuotedID       string
+	Quoted         string
+	Status         string
+	Attempts       int
+	NextAt         time.Time
+	Error          string
+}
+
+// Undelivered wa2tg message waiting for retry of delivery to Telegram
+type Undelivered struct {
+	ID            uint
+	MGID          string
+	WAMessageID   string
+	Kind          string
+	Client        string
+	Name          string
+	From          string
+	FromName      string
+	FromMe        bool
+	Owner         string
+	Timestamp     uint64
+	MessageStatus int
+	QuotedID      string
+	Text          string
+	Caption       string
+	FileName      string
+	Lat           float64
+	Lon           float64
+	VCard         string
+	Media         []byte
+	Status        string
+	Attempts      int
+	NextAt        time.Time
+	Error         string
+}
+
+// AutoReply text sent to not joined WhatsApp client when rule matched, see bridge.ParseAutoReplyRule
+type AutoReply struct {
+	ID   uint
+	MGID string
+	Rule string
+	Text string
+}
+
+// AutoReplySent last reply of AutoReplyID rule to WAClient, cooldown of rule counts from At
+type AutoReplySent struct {
+	ID          uint
+	MGID        string
+	WAClient    string
+	AutoReplyID uint
+	At          time.Time
+}
+
+// MessageStatus values follow WhatsApp WebMessageInfo status, its ERROR is also the zero value of messages
+// stored without status, so it is MessageStatusUnknown and failed delivery is MessageStatusFailed
+const (
+	MessageStatusUnknown = iota
+	MessageStatusPending
+	MessageStatusServerAck
+	MessageStatusDeliveryAck
+	MessageStatusRead
+	MessageStatusPlayed
+
+	MessageStatusFailed = -1
+)
+
+type ConnectionState struct {
+	State   string
+	Attempt int
+	NextAt  time.Time
+	Since   time.Time
+	Error   string
+}
+
+// Describe human readable state, e.g. "reconnecting, attempt 4, next in 2m"
+func (c ConnectionState) Describe(now time.Time) string {
+	switch c.State {
+	case ConnectionConnected:
+		return fmt.Sprintf("connected since %s", c.Since.Format("02.01 15:04"))
+	case ConnectionConnecting:
+		return fmt.Sprintf("reconnecting, attempt %d, in progress", c.Attempt)
+	case ConnectionBackoff:
+		next := c.NextAt.Sub(now)
+		if next < 0 {
+			next = 0
+		}
+		if next >= time.Minute {
+			return fmt.Sprintf("reconnecting, attempt %d, next in %dm", c.Attempt, int(next.Round(time.Minute).Minutes()))
+		}
+		return fmt.Sprintf("reconnecting, attempt %d, next in %ds", c.Attempt, int(next.Round(time.Second).Seconds()))
+	case ConnectionLoggedOut:
+		if c.Error != "" {
+			return fmt.Sprintf("logged out (%s), please /login", c.Error)
+		}
+		return "logged out, please /login"
+	default:
+		return "unknown"
+	}
+}
+
 type WA interface {
 	GetInstance(id int64) (WAInstance, bool)
 }
 
 type WAInstance interface {
-	ReadMessage(client, messageID string) (err error)
+	ReadMessage(client, sender, messageID string) (err error)
 	GetUnreadChat() (map[string]string, int, string)
 	GetStatusContacts() (bool, int, string)
 	GetStatusDevice() bool
@@ -121,6 +448,8 @@ type WAInstance interface {
 	SendAudio(client string, reader io.Reader, mime string, QuotedID string, Quoted string) (msg *WAMessage, err error)
 	SendVideo(client string, reader io.Reader, mime string, QuotedID string, Quoted string) (msg *WAMessage, err error)
 	SendLocation(client string, lat, lon float64, QuotedID string, Quoted string) (msg *WAMessage, err error)
+	SendContact(client, name, phone string, QuotedID string, Quoted string) (msg *WAMessage, err error)
+	RevokeMessage(client, messageID string, fromMe bool) (err error)
 	GetHistory(client string, size int) (err error)
 	GetContactPhoto(client string) (result string, err error)
 	GetShortClient(client string) string
@@ -129,17 +458,24 @@ type WAInstance interface {
 	GetID() string
 	SyncContacts() (bool, error)
 	SyncChats() (bool, error)
+	GetConnectionState() ConnectionState
 }
 
 type TG interface {
 	SendQR(mgChatID int64, code string) (msg *TGMessage, err error)
-	SendMessage(chatID int64, text string) (msg *TGMessage, err error)
-	SendImage(chatID int64, reader io.Reader, caption string) (msg *TGMessage, err error)
-	SendAudio(chatID int64, reader io.Reader) (msg *TGMessage, err error)
-	SendVideo(chatID int64, reader io.Reader) (msg *TGMessage, err error)
-	SendDocument(chatID int64, reader io.Reader, fileName string) (msg *TGMessage, err error)
-	SendLocation(chatID int64, lat, lon float64) (msg *TGMessage, err error)
+	SendMessage(chatID int64, text string, replyToID, threadID int) (msg *TGMessage, err error)
+	SendImage(chatID int64, reader io.Reader, caption string, replyToID, threadID int) (msg *TGMessage, err error)
+	SendAudio(chatID int64, reader io.Reader, replyToID, threadID int) (msg *TGMessage, err error)
+	SendVideo(chatID int64, reader io.Reader, replyToID, threadID int) (msg *TGMessage, err error)
+	SendDocument(chatID int64, reader io.Reader, fileName string, replyToID, threadID int) (msg *TGMessage, err error)
+	SendLocation(chatID int64, lat, lon float64, replyToID, threadID int) (msg *TGMessage, err error)
+	SendContact(chatID int64, phone, name string, replyToID, threadID int) (msg *TGMessage, err error)
+	ReactMessage(chatID int64, messageID int, emoji string) (err error)
+	EditMessage(chatID int64, messageID int, text string, parseMode string) (err error)
 	DeleteMessage(chatID int64, messageID int) (err error)
+	CreateTopic(chatID int64, name string) (threadID int, err error)
+	SendNewClient(mgChatID int64, client, name string) (msg *TGMessage, err error)
+	MirrorMessage(message *Message)
 	UpdateStatMessage(chunk int)
 	SendLog(text string)
 	GetMainGroups() []int64
@@ -151,11 +487,16 @@ type Store interface {
 	SaveMainGroup(mg *MainGroup) (err error)
 	SaveMessage(message *Message) error
 	GetMessageByWA(messageID string) (*Message, error)
+	GetMessageByTG(messageID int, chatID int64) (*Message, error)
+	GetUnreadOutgoing(chatID int64, session string) ([]*Message, error)
+	GetWaitingInSession(mgID, client, session string) (*Message, error)
 	GetMessagesNotChattedByClient(client string) ([]*Message, error)
+	GetLastMessagesByClient(mgID, client string, size int) ([]*Message, error)
 	ExistMessageByWA(messageID string) bool
 	ExistMessageByTG(messageID int, chatID int64) bool
 	GetChatByClient(client string, id string) (*Chat, error)
 	GetChatsByChatID(chatID int64) ([]*Chat, error)
+	GetChatsByMGID(mgID string) ([]*Chat, error)
 	SaveChat(chat *Chat) error
 	GetStatOnPeriod(mgChatID int64, userName string, start, end time.Time) (apiItems []*Stat, err error)
 	DeleteChat(chat *Chat) (bool, error)
@@ -166,6 +507,60 @@ type Store interface {
 	SaveContact(contact *Contact) (err error)
 	GetContactsByPhone(phone string) (apiItems []*Contact, err error)
 	GetContactsByWAClient(waClient string) (apiItems []*Contact, err error)
+	SaveSession(mgID string, data []byte) (err error)
+	GetSession(mgID string) (data []byte, err error)
+	SaveOutbox(item *Outbox) (err error)
+	GetOutboxPending(mgID string) (apiItems []*Outbox, err error)
+	GetOutbox(id uint) (apiItem *Outbox, err error)
+	GetOutboxScheduled(mgID string) (apiItems []*Outbox, err error)
+	SaveUndelivered(item *Undelivered) (err error)
+	GetUndelivered(mgID string) (apiItems []*Undelivered, err error)
+	CountUndelivered(mgID string) (count int, err error)
+	RetryUndelivered(mgID string) (err error)
+	SaveAutoReply(item *AutoReply) (err error)
+	GetAutoReplies(mgID string) (apiItems []*AutoReply, err error)
+	DeleteAutoReply(mgID string, id uint) (bool, error)
+	SaveAutoReplySent(item *AutoReplySent) (err error)
+	GetAutoReplySent(mgID, client string, autoReplyID uint) (apiItem *AutoReplySent, err error)
+	SaveCalendar(calendar *Calendar) (err error)
+	GetCalendar(mgID string) (apiItem *Calendar, err error)
+	SaveTopic(topic *Topic) (err error)
+	GetTopicByClient(mgID string, client string) (apiItem *Topic, err error)
+	GetTopicByThread(mgID string, threadID int) (apiItem *Topic, err error)
+	SaveFreeChat(chat *FreeChat) (err error)
+	TakeFreeChat(mgID string) (apiItem *FreeChat, err error)
+	DeleteFreeChat(chatID int64) (bool, error)
+	SaveTransfer(transfer *Transfer) (err error)
+	GetTransfersBySession(session string) (apiItems []*Transfer, err error)
+	SaveOperator(operator *Operator) (err error)
+	GetOperators() (apiItems []*Operator, err error)
+	GetOperator(tgUserID int) (operator *Operator, err error)
+	SaveAssignment(item *Assignment) (err error)
+	GetAssignment(id uint) (apiItem *Assignment, err error)
+	GetAssignmentsPending(mgID string) (apiItems []*Assignment, err error)
+	SaveSLABreach(item *SLABreach) (created bool, err error)
+	SaveNote(note *Note) (err error)
+	SaveCanned(canned *Canned) (err error)
+	GetCanned(mgID, key string) (apiItem *Canned, err error)
+	GetCannedResponses(mgID string) (apiItems []*Canned, err error)
+	DeleteCanned(mgID, key string) (bool, error)
+	SaveReminder(item *Reminder) (err error)
+	GetReminder(id uint) (apiItem *Reminder, err error)
+	GetRemindersPending(mgID string) (apiItems []*Reminder, err error)
+	SaveCampaign(item *Campaign) (err error)
+	GetCampaign(id uint) (apiItem *Campaign, err error)
+	GetCampaigns(mgID string) (apiItems []*Campaign, err error)
+	SaveCampaignRecipient(item *CampaignRecipient) (err error)
+	GetCampaignRecipients(campaignID uint) (apiItems []*CampaignRecipient, err error)
+	GetCampaignRecipientNext(campaignID uint) (apiItem *CampaignRecipient, err error)
+	SaveOptOut(item *OptOut) (created bool, err error)
+	GetOptOuts(mgID string) (apiItems []*OptOut, err error)
+	GetClients(mgID string, since time.Time) (clients []string, err error)
+	SaveWatch(watch *Watch) (err error)
+	GetWatches(mgID string) (apiItems []*Watch, err error)
+	DeleteWatches(mgID string, tgUserID int, client, operator string) (count int64, err error)
+	GetNotesByClient(mgID, client string) (apiItems []*Note, err error)
+	GetSLABreachesOnPeriod(mgID string, start, end time.Time) (apiItems []*SLABreach, err error)
 }
 
 type Cache interface {
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Calendar working hours of main group, nil or empty Hours means always open
+//
+//	Timezone: Asia/Dubai
+//	Hours:    1-5 09:00-18:00; 6 10:00-14:00  (1 is Monday, 7 is Sunday)
+//	Holidays: 2022-12-31,2023-01-01
+type Calendar struct {
+	MGID     string
+	Timezone string
+	Hours    string
+	Holidays string
+}
+
+// deadlineDays how far WorkDeadline looks for working hours
+const deadlineDays = 400
+
+type workWindow struct {
+	from time.Duration
+	to   time.Duration
+}
+
+// Validate check timezone, hours and holidays can be parsed
+func (c *Calendar) Validate() error {
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone '%s'", c.Timezone)
+	}
+	if _, err := parseHours(c.Hours); err != nil {
+		return err
+	}
+	for _, v := range c.HolidayList() {
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			return fmt.Errorf("holiday '%s' is not in format YYYY-MM-DD", v)
+		}
+	}
+	return nil
+}
+
+// HolidayList sorted holiday dates
+func (c *Calendar) HolidayList() []string {
+	list := []string{}
+	for _, v := range strings.Split(c.Holidays, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Location timezone of calendar, UTC when unknown
+func (c *Calendar) Location() *time.Location {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// IsOpen main group works at t
+func (c *Calendar) IsOpen(t time.Time) bool {
+	if c == nil || strings.TrimSpace(c.Hours) == "" {
+		return true
+	}
+	hours, err := parseHours(c.Hours)
+	if err != nil {
+		return true
+	}
+	t = t.In(c.Location())
+	if c.isHoliday(t) {
+		return false
+	}
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	for _, w := range hours[t.Weekday()] {
+		if clock >= w.from && clock < w.to {
+			return true
+		}
+	}
+	return false
+}
+
+// WorkDuration part of period between from and to inside working hours
+func (c *Calendar) WorkDuration(from, to time.Time) time.Duration {
+	if !to.After(from) {
+		return 0
+	}
+	if c == nil || strings.TrimSpace(c.Hours) == "" {
+		return to.Sub(from)
+	}
+	hours, err := parseHours(c.Hours)
+	if err != nil {
+		return to.Sub(from)
+	}
+
+	loc := c.Location()
+	from, to = from.In(loc), to.In(loc)
+	total := time.Duration(0)
+	for day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc); day.Before(to); day = day.AddDate(0, 0, 1) {
+		if c.isHoliday(day) {
+			continue
+		}
+		for _, w := range hours[day.Weekday()] {
+			start, end := day.Add(w.from), day.Add(w.to)
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			if end.After(start) {
+				total += end.Sub(start)
+			}
+		}
+	}
+	return total
+}
+
+// WorkDeadline moment when work of working hours passes since from, zero time when calendar has
+// no working hours ahead
+func (c *Calendar) WorkDeadline(from time.Time, work time.Duration) time.Time {
+	if work <= 0 {
+		return from
+	}
+	if c == nil || strings.TrimSpace(c.Hours) == "" {
+		return from.Add(work)
+	}
+	hours, err := parseHours(c.Hours)
+	if err != nil {
+		return from.Add(work)
+	}
+
+	loc := c.Location()
+	from = from.In(loc)
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	for i := 0; i < deadlineDays; i, day = i+1, day.AddDate(0, 0, 1) {
+		if c.isHoliday(day) {
+			continue
+		}
+		windows := hours[day.Weekday()]
+		sort.Slice(windows, func(a, b int) bool { return windows[a].from < windows[b].from })
+		for _, w := range windows {
+			start, end := day.Add(w.from), day.Add(w.to)
+			if start.Before(from) {
+				start = from
+			}
+			if !end.After(start) {
+				continue
+			}
+			if end.Sub(start) >= work {
+				return start.Add(work)
+			}
+			work -= end.Sub(start)
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Calendar) isHoliday(t time.Time) bool {
+	date := t.Format("2006-01-02")
+	for _, v := range c.HolidayList() {
+		if v == date {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHours parse "1-5 09:00-18:00; 6 10:00-14:00" to windows by weekday
+func parseHours(value string) (map[time.Weekday][]workWindow, error) {
+	hours := map[time.Weekday][]workWindow{}
+	for _, item := range strings.Split(value, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Fields(item)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("hours '%s' is not in format 1-5 09:00-18:00", item)
+		}
+
+		days := strings.Split(parts[0], "-")
+		start, err := strconv.Atoi(days[0])
+		if err != nil || len(days) > 2 || start < 1 || start > 7 {
+			return nil, fmt.Errorf("weekdays '%s' is not in format 1-5, 1 is Monday", parts[0])
+		}
+		end := start
+		if len(days) == 2 {
+			if end, err = strconv.Atoi(days[1]); err != nil || end < start || end > 7 {
+				return nil, fmt.Errorf("weekdays '%s' is not in format 1-5, 1 is Monday", parts[0])
+			}
+		}
+
+		clocks := strings.Split(parts[1], "-")
+		if len(clocks) != 2 {
+			return nil, fmt.Errorf("time '%s' is not in format 09:00-18:00", parts[1])
+		}
+		w := workWindow{}
+		if w.from, err = ParseClock(clocks[0]); err != nil {
+			return nil, err
+		}
+		if w.to, err = ParseClock(clocks[1]); err != nil {
+			return nil, err
+		}
+		if w.to <= w.from {
+			return nil, fmt.Errorf("time '%s' ends before start, split night hours by days", parts[1])
+		}
+
+		for day := start; day <= end; day++ {
+			hours[time.Weekday(day%7)] = append(hours[time.Weekday(day%7)], w)
+		}
+	}
+	return hours, nil
+}
+
+// ParseClock parse HH:MM into duration since midnight, 24:00 is the end of day
+func ParseClock(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("time '%s' is not in format HH:MM", value)
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendar_IsOpen(t *testing.T) {
+	calendar := &Calendar{Timezone: "Asia/Dubai", Hours: "1-5 09:00-18:00; 6 10:00-14:00", Holidays: "2022-03-08"}
+	// 2022-03-07 is Monday, Dubai is UTC+4
+	tests := []struct {
+		name string
+		at   string
+		want bool
+	}{
+		{name: "monday morning", at: "2022-03-07T05:00:00Z", want: true},
+		{name: "monday before open", at: "2022-03-07T04:59:00Z", want: false},
+		{name: "monday close", at: "2022-03-07T14:00:00Z", want: false},
+		{name: "holiday", at: "2022-03-08T06:00:00Z", want: false},
+		{name: "saturday", at: "2022-03-12T07:00:00Z", want: true},
+		{name: "sunday", at: "2022-03-13T07:00:00Z", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, _ := time.Parse(time.RFC3339, tt.at)
+			if got := calendar.IsOpen(at); got != tt.want {
+				t.Errorf("IsOpen(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+
+	var empty *Calendar
+	if !empty.IsOpen(time.Now()) {
+		t.Errorf("IsOpen() of nil calendar = false, want true")
+	}
+}
+
+func TestCalendar_WorkDuration(t *testing.T) {
+	calendar := &Calendar{Timezone: "UTC", Hours: "1-5 09:00-18:00", Holidays: "2022-03-08"}
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want time.Duration
+	}{
+		{name: "inside", from: "2022-03-07T10:00:00Z", to: "2022-03-07T10:30:00Z", want: 30 * time.Minute},
+		{name: "night", from: "2022-03-07T17:00:00Z", to: "2022-03-09T09:30:00Z", want: 90 * time.Minute},
+		{name: "weekend", from: "2022-03-11T17:50:00Z", to: "2022-03-14T09:10:00Z", want: 20 * time.Minute},
+		{name: "off hours only", from: "2022-03-12T10:00:00Z", to: "2022-03-13T10:00:00Z", want: 0},
+		{name: "reversed", from: "2022-03-07T11:00:00Z", to: "2022-03-07T10:00:00Z", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, _ := time.Parse(time.RFC3339, tt.from)
+			to, _ := time.Parse(time.RFC3339, tt.to)
+			if got := calendar.WorkDuration(from, to); got != tt.want {
+				t.Errorf("WorkDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalendar_Validate(t *testing.T) {
+	tests := []struct {
+		calendar Calendar
+		wantErr  bool
+	}{
+		{calendar: Calendar{Timezone: "Europe/Minsk", Hours: "1-5 09:00-18:00; 6 10:00-14:00", Holidays: "2022-12-31"}},
+		{calendar: Calendar{Timezone: "UTC"}},
+		{calendar: Calendar{Timezone: "Mars/Base"}, wantErr: true},
+		{calendar: Calendar{Hours: "1-5 18:00-09:00"}, wantErr: true},
+		{calendar: Calendar{Hours: "0-5 09:00-18:00"}, wantErr: true},
+		{calendar: Calendar{Hours: "1-5"}, wantErr: true},
+		{calendar: Calendar{Holidays: "31.12.2022"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.calendar.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error = %v, wantErr %v", tt.calendar, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "9:00", want: 9 * time.Hour},
+		{value: " 17:30 ", want: 17*time.Hour + 30*time.Minute},
+		{value: "24:00", want: 24 * time.Hour},
+		{value: "25:00", wantErr: true},
+		{value: "17", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseClock(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseClock(%q) = %v, %v, want %v, wantErr %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCalendar_WorkDeadline(t *testing.T) {
+	calendar := &Calendar{Timezone: "UTC", Hours: "1-5 09:00-18:00", Holidays: "2022-03-08"}
+	tests := []struct {
+		name string
+		from string
+		work time.Duration
+		want string
+	}{
+		{name: "inside", from: "2022-03-07T10:00:00Z", work: 30 * time.Minute, want: "2022-03-07T10:30:00Z"},
+		{name: "night", from: "2022-03-07T17:00:00Z", work: 90 * time.Minute, want: "2022-03-09T09:30:00Z"},
+		{name: "weekend", from: "2022-03-12T10:00:00Z", work: 10 * time.Minute, want: "2022-03-14T09:10:00Z"},
+		{name: "nothing left", from: "2022-03-12T10:00:00Z", work: 0, want: "2022-03-12T10:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, _ := time.Parse(time.RFC3339, tt.from)
+			want, _ := time.Parse(time.RFC3339, tt.want)
+			if got := calendar.WorkDeadline(from, tt.work); !got.Equal(want) {
+				t.Errorf("WorkDeadline() = %v, want %v", got, want)
+			}
+		})
+	}
+
+	var empty *Calendar
+	from := time.Now()
+	if got := empty.WorkDeadline(from, time.Hour); !got.Equal(from.Add(time.Hour)) {
+		t.Errorf("WorkDeadline() of nil calendar = %v, want %v", got, from.Add(time.Hour))
+	}
+	closed := &Calendar{Timezone: "UTC", Hours: "1 09:00-18:00", Holidays: "2022-03-07"}
+	if got := closed.WorkDeadline(from, 400*24*time.Hour); !got.IsZero() {
+		t.Errorf("WorkDeadline() beyond working hours = %v, want zero", got)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Segment WhatsApp clients of campaign, clients with messages in main group since Since and with all Tags
+// in contact or alias name:
+//
+//	all                  all clients
+//	active 30d           clients with messages in last 30 days, or Go duration e.g. 12h
+//	active 30d tag vip   and name contains "vip", e.g. contact saved by /contact +971 55 995 02 03 Maxim vip
+type Segment struct {
+	Since time.Time
+	Tags  []string
+}
+
+// ParseSegment parse segment spec, filters may go in any order
+func ParseSegment(spec string, now time.Time) (*Segment, error) {
+	segment := &Segment{}
+	fields := strings.Fields(strings.ToLower(spec))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("segment required, e.g. all, active 30d or tag vip")
+	}
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "all":
+		case "active", "tag":
+			if i+1 == len(fields) {
+				return nil, fmt.Errorf("value of '%s' required", fields[i])
+			}
+			i++
+			if fields[i-1] == "tag" {
+				segment.Tags = append(segment.Tags, fields[i])
+				continue
+			}
+			period, err := parsePeriod(fields[i])
+			if err != nil {
+				return nil, err
+			}
+			segment.Since = now.Add(-period)
+		default:
+			return nil, fmt.Errorf("unknown filter '%s', use all, active <days>d or tag <word>", fields[i])
+		}
+	}
+	return segment, nil
+}
+
+// Match client name has all tags of segment
+func (s *Segment) Match(name string) bool {
+	name = strings.ToLower(name)
+	for _, v := range s.Tags {
+		if !strings.Contains(name, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func parsePeriod(v string) (time.Duration, error) {
+	if strings.HasSuffix(v, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(v, "d"))
+		if err == nil && days > 0 {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	}
+	period, err := time.ParseDuration(v)
+	if err != nil || period <= 0 {
+		return 0, fmt.Errorf("fail parse period '%s', e.g. 30d or 12h", v)
+	}
+	return period, nil
+}
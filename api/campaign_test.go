@@ -0,0 +1,46 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSegment(t *testing.T) {
+	now := time.Date(2022, 3, 7, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		spec    string
+		want    *Segment
+		wantErr bool
+	}{
+		{spec: "all", want: &Segment{}},
+		{spec: "active 30d", want: &Segment{Since: now.AddDate(0, 0, -30)}},
+		{spec: "Tag VIP active 12h tag dubai", want: &Segment{Since: now.Add(-12 * time.Hour), Tags: []string{"vip", "dubai"}}},
+		{spec: "", wantErr: true},
+		{spec: "active", wantErr: true},
+		{spec: "active 0d", wantErr: true},
+		{spec: "active soon", wantErr: true},
+		{spec: "vip", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseSegment(tt.spec, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSegment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSegment() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegment_Match(t *testing.T) {
+	segment := &Segment{Tags: []string{"vip", "dubai"}}
+	if !segment.Match("Maxim VIP Dubai") {
+		t.Errorf("Match() = false, want true")
+	}
+	if segment.Match("Maxim VIP") {
+		t.Errorf("Match() without tag = true, want false")
+	}
+}
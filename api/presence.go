@@ -0,0 +1,38 @@
+package api
+
+import "time"
+
+// State presence of operator at now, operator without presence is online. Online operator with
+// AwayAfter is away when not active in bridged chats for that time
+func (o *Operator) State(now time.Time) string {
+	if o == nil {
+		return PresenceOffline
+	}
+	switch o.Presence {
+	case PresenceAway, PresenceOffline:
+		return o.Presence
+	}
+	if o.AwayAfter <= 0 {
+		return PresenceOnline
+	}
+	active := o.LastActiveAt
+	if o.PresenceAt.After(active) {
+		active = o.PresenceAt
+	}
+	if !active.IsZero() && now.Sub(active) >= o.AwayAfter {
+		return PresenceAway
+	}
+	return PresenceOnline
+}
+
+// Since time of last presence change, auto away starts after AwayAfter of inactivity
+func (o *Operator) Since(now time.Time) time.Time {
+	if o.State(now) == PresenceAway && o.Presence != PresenceAway {
+		active := o.LastActiveAt
+		if o.PresenceAt.After(active) {
+			active = o.PresenceAt
+		}
+		return active.Add(o.AwayAfter)
+	}
+	return o.PresenceAt
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOperator_State(t *testing.T) {
+	now := time.Date(2022, 3, 7, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		operator *Operator
+		want     string
+	}{
+		{name: "nil", operator: nil, want: PresenceOffline},
+		{name: "registered only", operator: &Operator{}, want: PresenceOnline},
+		{name: "offline", operator: &Operator{Presence: PresenceOffline}, want: PresenceOffline},
+		{name: "away", operator: &Operator{Presence: PresenceAway}, want: PresenceAway},
+		{name: "active", operator: &Operator{Presence: PresenceOnline, AwayAfter: time.Hour, LastActiveAt: now.Add(-time.Minute)}, want: PresenceOnline},
+		{name: "inactive", operator: &Operator{Presence: PresenceOnline, AwayAfter: time.Hour, LastActiveAt: now.Add(-2 * time.Hour)}, want: PresenceAway},
+		{name: "just online", operator: &Operator{Presence: PresenceOnline, AwayAfter: time.Hour, PresenceAt: now.Add(-time.Minute), LastActiveAt: now.Add(-2 * time.Hour)}, want: PresenceOnline},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.operator.State(now); got != tt.want {
+				t.Errorf("State() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ParseWhen split arguments of scheduled message to send time and text keeping its new lines, time is in loc:
+//
+//	30m Text         after duration
+//	9:00 Text        today or tomorrow when passed
+//	tomorrow 9:00    tomorrow
+//	2022-03-08 9:00  date
+func ParseWhen(args string, now time.Time, loc *time.Location) (at time.Time, text string, err error) {
+
+	now = now.In(loc)
+	word, rest := nextWord(args)
+	if word == "" {
+		return at, "", fmt.Errorf("time required")
+	}
+
+	if d, err := time.ParseDuration(word); err == nil {
+		if d <= 0 {
+			return at, "", fmt.Errorf("duration '%s' must be positive", word)
+		}
+		return now.Add(d), rest, nil
+	}
+
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	dated := true
+	if strings.ToLower(word) == "tomorrow" {
+		day = day.AddDate(0, 0, 1)
+	} else if date, err := time.ParseInLocation("2006-01-02", word, loc); err == nil {
+		day = date
+	} else {
+		dated = false
+		rest = strings.TrimSpace(args)
+	}
+
+	word, rest = nextWord(rest)
+	clock, err := time.Parse("15:04", word)
+	if err != nil {
+		return at, "", fmt.Errorf("fail parse time '%s', e.g. 30m, 9:00, tomorrow 9:00 or 2022-03-08 9:00", word)
+	}
+	at = time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+	if !dated && !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+	if !at.After(now) {
+		return at, "", fmt.Errorf("time %s already passed", at.Format("2006-01-02 15:04"))
+	}
+	return at, rest, nil
+}
+
+func nextWord(s string) (word, rest string) {
+	s = strings.TrimSpace(s)
+	end := strings.IndexFunc(s, unicode.IsSpace)
+	if end < 0 {
+		return s, ""
+	}
+	return s[:end], strings.TrimSpace(s[end:])
+}
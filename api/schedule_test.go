@@ -0,0 +1,45 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWhen(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Dubai")
+	if err != nil {
+		t.Fatalf("LoadLocation() error = %v", err)
+	}
+	now := time.Date(2022, 3, 7, 12, 0, 0, 0, loc)
+	tests := []struct {
+		name     string
+		args     string
+		wantAt   time.Time
+		wantText string
+		wantErr  bool
+	}{
+		{name: "duration", args: "30m Hello", wantAt: now.Add(30 * time.Minute), wantText: "Hello"},
+		{name: "clock today", args: "18:30 Hello\nthere", wantAt: time.Date(2022, 3, 7, 18, 30, 0, 0, loc), wantText: "Hello\nthere"},
+		{name: "clock passed", args: "9:00 Hello", wantAt: time.Date(2022, 3, 8, 9, 0, 0, 0, loc), wantText: "Hello"},
+		{name: "tomorrow", args: "Tomorrow 9:00 Hello", wantAt: time.Date(2022, 3, 8, 9, 0, 0, 0, loc), wantText: "Hello"},
+		{name: "date", args: "2022-03-10 09:15 Hello", wantAt: time.Date(2022, 3, 10, 9, 15, 0, 0, loc), wantText: "Hello"},
+		{name: "date passed", args: "2022-03-07 9:00 Hello", wantErr: true},
+		{name: "negative", args: "-5m Hello", wantErr: true},
+		{name: "no time", args: "tomorrow Hello", wantErr: true},
+		{name: "empty", args: " ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotAt, gotText, err := ParseWhen(tt.args, now, loc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWhen() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !gotAt.Equal(tt.wantAt) || gotText != tt.wantText {
+				t.Errorf("ParseWhen() = %v, %q, want %v, %q", gotAt, gotText, tt.wantAt, tt.wantText)
+			}
+		})
+	}
+}
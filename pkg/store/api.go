@@ -1,9 +1,14 @@
 package store
 
 import (
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"tgwabr/api"
 	"time"
+
+	"github.com/jinzhu/gorm"
 )
 
 func (s *Store) SaveMessage(message *api.Message) (err error) {
@@ -98,6 +103,18 @@ func (s *Store) GetMessageByWA(messageID string) (apiItem *api.Message, err erro
 	return item.ToAPIMessage(), nil
 }
 
+func (s *Store) GetMessageByTG(messageID int, chatID int64) (apiItem *api.Message, err error) {
+	item := &Message{}
+	ok, err := s.FindOne(s.db.Model(&Message{}).Where(&Message{TGMessageID: messageID, TGChatID: chatID}), item)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return nil, nil
+	}
+	return item.ToAPIMessage(), nil
+}
+
 func (s *Store) ExistMessageByWA(messageID string) bool {
 	ok, err := s.Check(s.db.Model(&Message{}).Where(&Message{WAMessageID: messageID}))
 	if err != nil {
@@ -137,6 +154,16 @@ func (s *Store) GetChatsByChatID(chatID int64) (chats []*api.Chat, err error) {
 	return items.ToAPIChats(), nil
 }
 
+func (s *Store) GetChatsByMGID(mgID string) (chats []*api.Chat, err error) {
+
+	items := Chats{}
+	err = s.db.Model(&Chat{}).Find(&items, &Chat{MGID: mgID}).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPIChats(), nil
+}
+
 func (s *Store) GetMessagesNotChattedByClient(client string) (msg []*api.Message, err error) {
 
 	items := Messages{}
@@ -147,31 +174,180 @@ func (s *Store) GetMessagesNotChattedByClient(client string) (msg []*api.Message
 	return items.ToAPIMessages(), nil
 }
 
+// GetLastMessagesByClient the last size messages of main group with client, the oldest first
+func (s *Store) GetLastMessagesByClient(mgID, client string, size int) (msg []*api.Message, err error) {
+
+	items := Messages{}
+	err = s.db.Model(&Message{}).Where(&Message{MGID: mgID, WAClient: client}).Order("id desc").Limit(size).Find(&items).Error
+	if err != nil {
+		return
+	}
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items.ToAPIMessages(), nil
+}
+
+// GetWaitingInSession first message of client in session after the last answer of operator, nil when answered
+func (s *Store) GetWaitingInSession(mgID, client, session string) (apiItem *api.Message, err error) {
+
+	answer := &Message{}
+	answered, err := s.FindOne(s.db.Model(&Message{}).
+		Where(&Message{MGID: mgID, WAClient: client, Session: session, Direction: api.DirectionTg2wa}).
+		Order("id desc"), answer)
+	if err != nil {
+		return
+	}
+
+	query := s.db.Model(&Message{}).Where(&Message{MGID: mgID, WAClient: client, Session: session, Direction: api.DirectionWa2tg})
+	if answered {
+		query = query.Where("id > ?", answer.ID)
+	}
+	item := &Message{}
+	ok, err := s.FindOne(query.Order("id"), item)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return nil, nil
+	}
+	return item.ToAPIMessage(), nil
+}
+
+func (s *Store) GetUnreadOutgoing(chatID int64, session string) (msg []*api.Message, err error) {
+
+	items := Messages{}
+	err = s.db.Model(&Message{}).
+		Where(&Message{TGChatID: chatID, Session: session, Direction: api.DirectionTg2wa}).
+		Where("message_status <> ? AND message_status < ?", api.MessageStatusUnknown, api.MessageStatusRead).
+		Order("id").
+		Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPIMessages(), nil
+}
+
+// statRow group of messages GetStatOnPeriod counts by day, operator, session and client
+type statRow struct {
+	Date       string
+	TGUserName string
+	WAClient   string
+	WAName     string
+	SessionID  string
+	Session    *string
+	Answered   *float64
+	CountIn    int
+	CountOut   int
+}
+
+// answeredRow answered message of group, its answer time is recounted in working hours of calendar
+type answeredRow struct {
+	Date        string
+	TGUserName  string
+	WAClient    string
+	WAName      string
+	SessionID   string
+	Answered    uint64
+	WATimestamp uint64
+}
+
+// GetStatOnPeriod stat by day, operator, session and client, answered time counts only working
+// hours of main group calendar
 func (s *Store) GetStatOnPeriod(mgChatID int64, userName string, start, end time.Time) (res []*api.Stat, err error) {
 	res = []*api.Stat{}
-	q := s.db.Table("messages").Select(`
-       date(created_at)                                   "date",
+
+	mgID := strconv.FormatInt(mgChatID, 10)
+	calendar, err := s.GetCalendar(mgID)
+	if err != nil {
+		return
+	}
+
+	filter := func(q *gorm.DB) *gorm.DB {
+		q = q.Where("mg_id = ? and created_at between ? and ?", mgID, start, end.AddDate(0, 0, 1))
+		if userName != "" {
+			q = q.Where("tg_user_name = ?", userName)
+		}
+		return q
+	}
+
+	rows := []*statRow{}
+	q := filter(s.db.Table("messages").Select(`
+       date(created_at)                                     "date",
        tg_user_name,
        wa_client,
        wa_name,
-       min(case when session != '' then created_at end)   "session",
-       min(case when answered > 0 then answered end) / 60 "answered",
-       count(case when direction = 'wa2tg' then id end)   "count_in",
-       count(case when direction = 'tg2wa' then id end)   "count_out"`).
-		Where("mg_id = ? and created_at between ? and DATE_ADD(?, INTERVAL 1 DAY)", mgChatID, start, end)
-	if userName != "" {
-		q = q.Where("tg_user_name = ?", userName)
-	}
-	q = q.Group("date(created_at), tg_user_name, session, wa_name, wa_client").
+       session                                              "session_id",
+       min(case when session != '' then created_at end)    "session",
+       min(case when answered > 0 then answered end) / 60.0 "answered",
+       count(case when direction = 'wa2tg' then id end)     "count_in",
+       count(case when direction = 'tg2wa' then id end)     "count_out"`)).
+		Group("date(created_at), tg_user_name, session, wa_name, wa_client").
 		Order("date").
 		Order("tg_user_name").
 		Order("min(case when session != '' then created_at end)").
 		Order("wa_name").
 		Order("wa_client")
+	if err = q.Scan(&rows).Error; err != nil {
+		return
+	}
 
-	err = q.Scan(&res).Error
+	groups := map[string]*api.Stat{}
+	for _, v := range rows {
+		item := &api.Stat{Date: dbTime(v.Date), TGUserName: v.TGUserName, WAName: v.WAName, WAClient: v.WAClient,
+			Answered: v.Answered, CountIn: v.CountIn, CountOut: v.CountOut}
+		if v.Session != nil {
+			session := dbTime(*v.Session)
+			item.Session = &session
+		}
+		groups[strings.Join([]string{v.Date, v.TGUserName, v.SessionID, v.WAName, v.WAClient}, "|")] = item
+		res = append(res, item)
+	}
 
-	return res, err
+	if calendar == nil || strings.TrimSpace(calendar.Hours) == "" {
+		return res, nil
+	}
+
+	// off hours are not counted in answered time, only answered messages are loaded for it
+	answered := []*answeredRow{}
+	q = filter(s.db.Table("messages").Select(`
+       date(created_at) "date",
+       tg_user_name,
+       wa_client,
+       wa_name,
+       session          "session_id",
+       answered,
+       wa_timestamp`)).
+		Where("answered > 0")
+	if err = q.Scan(&answered).Error; err != nil {
+		return
+	}
+	for _, item := range res {
+		item.Answered = nil
+	}
+	for _, v := range answered {
+		item, ok := groups[strings.Join([]string{v.Date, v.TGUserName, v.SessionID, v.WAName, v.WAClient}, "|")]
+		if !ok {
+			continue
+		}
+		asked := time.Unix(int64(v.WATimestamp), 0)
+		minutes := calendar.WorkDuration(asked, asked.Add(time.Duration(v.Answered)*time.Second)).Minutes()
+		if item.Answered == nil || *item.Answered > minutes {
+			item.Answered = &minutes
+		}
+	}
+
+	return res, nil
+}
+
+// dbTime parse date or time column scanned into string, MySQL gives RFC 3339 and SQLite own text format
+func dbTime(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
 }
 
 func (s *Store) DeleteChat(chat *api.Chat) (bool, error) {
@@ -298,3 +474,692 @@ func (s *Store) GetContactsByWAClient(waClient string) (apiItems []*api.Contact,
 	}
 	return items.ToAPIContacts(), nil
 }
+
+func (s *Store) SaveSession(mgID string, data []byte) (err error) {
+
+	if s.sessionKey == nil {
+		return fmt.Errorf("session key not configured, set STORE_SESSION_KEY")
+	}
+	sealed, err := seal(s.sessionKey, data)
+	if err != nil {
+		return err
+	}
+	item := &WASession{}
+	_, err = s.FindOne(s.db.Model(&WASession{}).Where(&WASession{MGID: mgID}), item)
+	if err != nil {
+		return err
+	}
+	item.MGID = mgID
+	item.Data = sealed
+	return s.db.Save(item).Error
+}
+
+func (s *Store) GetSession(mgID string) (data []byte, err error) {
+
+	item := &WASession{}
+	ok, err := s.FindOne(s.db.Model(&WASession{}).Where(&WASession{MGID: mgID}), item)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return nil, nil
+	}
+	if s.sessionKey == nil {
+		return nil, fmt.Errorf("session key not configured, set STORE_SESSION_KEY")
+	}
+	return open(s.sessionKey, item.Data)
+}
+
+func (s *Store) SaveOutbox(item *api.Outbox) (err error) {
+	dbItem := APIOutbox(*item).ToOutbox()
+	if item.ID != 0 {
+		current := &Outbox{}
+		if err = s.db.First(current, item.ID).Error; err != nil {
+			return err
+		}
+		dbItem.CreatedAt = current.CreatedAt
+	}
+	err = s.db.Save(dbItem).Error
+	if err != nil {
+		return err
+	}
+	item.ID = dbItem.ID
+	return
+}
+
+func (s *Store) GetOutboxPending(mgID string) (apiItems []*api.Outbox, err error) {
+
+	items := Outboxes{}
+	err = s.db.Model(&Outbox{}).Where(&Outbox{MGID: mgID, Status: api.OutboxPending}).Order("id").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPIOutboxes(), nil
+}
+
+func (s *Store) GetOutbox(id uint) (apiItem *api.Outbox, err error) {
+
+	item := &Outbox{}
+	ok, err := s.FindOne(s.db.Model(&Outbox{}).Where("id = ?", id), item)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return nil, nil
+	}
+	return item.ToAPIOutbox(), nil
+}
+
+func (s *Store) GetOutboxScheduled(mgID string) (apiItems []*api.Outbox, err error) {
+
+	items := Outboxes{}
+	err = s.db.Model(&Outbox{}).Where(&Outbox{MGID: mgID, Status: api.OutboxScheduled}).Order("next_at, id").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPIOutboxes(), nil
+}
+
+func (s *Store) SaveUndelivered(item *api.Undelivered) (err error) {
+	current := &Undelivered{}
+	_, err = s.FindOne(s.db.Model(&Undelivered{}).Where(&Undelivered{WAMessageID: item.WAMessageID}), current)
+	if err != nil {
+		return err
+	}
+	dbItem := APIUndelivered(*item).ToUndelivered()
+	dbItem.ID = current.ID
+	dbItem.CreatedAt = current.CreatedAt
+	err = s.db.Save(dbItem).Error
+	if err != nil {
+		return err
+	}
+	item.ID = dbItem.ID
+	return
+}
+
+func (s *Store) GetUndelivered(mgID string) (apiItems []*api.Undelivered, err error) {
+
+	items := Undelivereds{}
+	err = s.db.Model(&Undelivered{}).Where(&Undelivered{MGID: mgID, Status: api.UndeliveredPending}).Order("id").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPIUndelivereds(), nil
+}
+
+func (s *Store) CountUndelivered(mgID string) (count int, err error) {
+	err = s.db.Model(&Undelivered{}).Where(&Undelivered{MGID: mgID, Status: api.UndeliveredPending}).Count(&count).Error
+	return
+}
+
+func (s *Store) RetryUndelivered(mgID string) (err error) {
+	return s.db.Model(&Undelivered{}).
+		Where(&Undelivered{MGID: mgID, Status: api.UndeliveredPending}).
+		Update("next_at", time.Now()).Error
+}
+
+func (s *Store) SaveAutoReply(item *api.AutoReply) (err error) {
+	dbItem := APIAutoReply(*item).ToAutoReply()
+	err = s.db.Save(dbItem).Error
+	if err != nil {
+		return err
+	}
+	item.ID = dbItem.ID
+	return
+}
+
+func (s *Store) GetAutoReplies(mgID string) (apiItems []*api.AutoReply, err error) {
+
+	items := AutoReplies{}
+	err = s.db.Model(&AutoReply{}).Where(&AutoReply{MGID: mgID}).Order("id").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPIAutoReplies(), nil
+}
+
+func (s *Store) DeleteAutoReply(mgID string, id uint) (bool, error) {
+	item := &AutoReply{}
+	ok, err := s.FindOne(s.db.Model(&AutoReply{}).Where("id = ? and mg_id = ?", id, mgID), item)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+	err = s.db.Unscoped().Delete(&item).Error
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Store) SaveAutoReplySent(sent *api.AutoReplySent) (err error) {
+
+	item := &AutoReplySent{}
+	_, err = s.FindOne(s.db.Model(&AutoReplySent{}).
+		Where(&AutoReplySent{MGID: sent.MGID, WAClient: sent.WAClient, AutoReplyID: sent.AutoReplyID}), item)
+	if err != nil {
+		return err
+	}
+	id := item.ID
+	item = APIAutoReplySent(*sent).ToAutoReplySent()
+	item.ID = id
+	if err = s.db.Save(item).Error; err != nil {
+		return err
+	}
+	sent.ID = item.ID
+	return
+}
+
+func (s *Store) GetAutoReplySent(mgID, client string, autoReplyID uint) (apiItem *api.AutoReplySent, err error) {
+
+	item := &AutoReplySent{}
+	ok, err := s.FindOne(s.db.Model(&AutoReplySent{}).
+		Where(&AutoReplySent{MGID: mgID, WAClient: client, AutoReplyID: autoReplyID}), item)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return nil, nil
+	}
+	return item.ToAPIAutoReplySent(), nil
+}
+
+func (s *Store) SaveCalendar(calendar *api.Calendar) (err error) {
+
+	item := &Calendar{}
+	_, err = s.FindOne(s.db.Model(&Calendar{}).Where(&Calendar{MGID: calendar.MGID}), item)
+	if err != nil {
+		return err
+	}
+	id := item.ID
+	item = APICalendar(*calendar).ToCalendar()
+	item.ID = id
+	return s.db.Save(item).Error
+}
+
+func (s *Store) GetCalendar(mgID string) (apiItem *api.Calendar, err error) {
+
+	item := &Calendar{}
+	ok, err := s.FindOne(s.db.Model(&Calendar{}).Where(&Calendar{MGID: mgID}), item)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return nil, nil
+	}
+	return item.ToAPICalendar(), nil
+}
+
+func (s *Store) SaveTopic(topic *api.Topic) (err error) {
+
+	item := &Topic{}
+	_, err = s.FindOne(s.db.Model(&Topic{}).Where(&Topic{MGID: topic.MGID, WAClient: topic.WAClient}), item)
+	if err != nil {
+		return err
+	}
+	id := item.ID
+	item = APITopic(*topic).ToTopic()
+	item.ID = id
+	return s.db.Save(item).Error
+}
+
+func (s *Store) GetTopicByClient(mgID string, client string) (apiItem *api.Topic, err error) {
+
+	item := &Topic{}
+	ok, err := s.FindOne(s.db.Model(&Topic{}).Where(&Topic{MGID: mgID, WAClient: client}), item)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return nil, nil
+	}
+	return item.ToAPITopic(), nil
+}
+
+func (s *Store) GetTopicByThread(mgID string, threadID int) (apiItem *api.Topic, err error) {
+
+	item := &Topic{}
+	ok, err := s.FindOne(s.db.Model(&Topic{}).Where(&Topic{MGID: mgID, ThreadID: threadID}), item)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return nil, nil
+	}
+	return item.ToAPITopic(), nil
+}
+
+// SaveFreeChat put chat to pool, chat saved without MGID keeps main group it served before
+func (s *Store) SaveFreeChat(chat *api.FreeChat) (err error) {
+
+	item := &FreeChat{}
+	_, err = s.FindOne(s.db.Model(&FreeChat{}).Where(&FreeChat{TGChatID: chat.TGChatID}), item)
+	if err != nil {
+		return err
+	}
+	id, mgID := item.ID, item.MGID
+	item = APIFreeChat(*chat).ToFreeChat()
+	item.ID = id
+	if item.MGID == "" {
+		item.MGID = mgID
+	}
+	return s.db.Save(item).Error
+}
+
+// TakeFreeChat remove the oldest free chat of main group from pool and return it, chat not served any main
+// group yet is taken when main group has none, nil when pool is empty
+func (s *Store) TakeFreeChat(mgID string) (apiItem *api.FreeChat, err error) {
+
+	tx := s.db.Begin()
+	item := &FreeChat{}
+	ok, err := s.FindOne(tx.Model(&FreeChat{}).Where("mg_id = ?", mgID).Order("id"), item)
+	if err == nil && !ok {
+		ok, err = s.FindOne(tx.Model(&FreeChat{}).Where("mg_id = '' OR mg_id IS NULL").Order("id"), item)
+	}
+	if err == nil && ok {
+		err = tx.Unscoped().Delete(item).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return item.ToAPIFreeChat(), nil
+}
+
+func (s *Store) DeleteFreeChat(chatID int64) (bool, error) {
+	result := s.db.Unscoped().Where(&FreeChat{TGChatID: chatID}).Delete(&FreeChat{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (s *Store) SaveTransfer(transfer *api.Transfer) (err error) {
+	item := APITransfer(*transfer).ToTransfer()
+	err = s.db.Save(item).Error
+	if err != nil {
+		return err
+	}
+	transfer.CreatedAt = item.CreatedAt
+	return
+}
+
+func (s *Store) GetTransfersBySession(session string) (apiItems []*api.Transfer, err error) {
+
+	items := Transfers{}
+	err = s.db.Model(&Transfer{}).Where(&Transfer{Session: session}).Order("id").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPITransfers(), nil
+}
+
+func (s *Store) SaveOperator(operator *api.Operator) (err error) {
+
+	item := &Operator{}
+	_, err = s.FindOne(s.db.Model(&Operator{}).Where(&Operator{TGUserID: operator.TGUserID}), item)
+	if err != nil {
+		return err
+	}
+	id := item.ID
+	item = APIOperator(*operator).ToOperator()
+	item.ID = id
+	return s.db.Save(item).Error
+}
+
+func (s *Store) GetOperators() (apiItems []*api.Operator, err error) {
+
+	items := Operators{}
+	err = s.db.Model(&Operator{}).Order("id").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPIOperators(), nil
+}
+
+func (s *Store) GetOperator(tgUserID int) (operator *api.Operator, err error) {
+
+	item := &Operator{}
+	ok, err := s.FindOne(s.db.Model(&Operator{}).Where(&Operator{TGUserID: tgUserID}), item)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return item.ToAPIOperator(), nil
+}
+
+func (s *Store) SaveAssignment(item *api.Assignment) (err error) {
+	dbItem := APIAssignment(*item).ToAssignment()
+	if item.ID != 0 {
+		current := &Assignment{}
+		if err = s.db.First(current, item.ID).Error; err != nil {
+			return err
+		}
+		dbItem.CreatedAt = current.CreatedAt
+	}
+	err = s.db.Save(dbItem).Error
+	if err != nil {
+		return err
+	}
+	item.ID = dbItem.ID
+	return
+}
+
+func (s *Store) GetAssignment(id uint) (apiItem *api.Assignment, err error) {
+
+	item := &Assignment{}
+	ok, err := s.FindOne(s.db.Model(&Assignment{}).Where("id = ?", id), item)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return nil, nil
+	}
+	return item.ToAPIAssignment(), nil
+}
+
+func (s *Store) GetAssignmentsPending(mgID string) (apiItems []*api.Assignment, err error) {
+
+	items := Assignments{}
+	err = s.db.Model(&Assignment{}).Where("mg_id = ? AND status IN (?)", mgID, []string{api.AssignmentNew, api.AssignmentPending}).Order("id").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPIAssignments(), nil
+}
+
+func (s *Store) SaveSLABreach(item *api.SLABreach) (created bool, err error) {
+
+	current := &SLABreach{}
+	ok, err := s.FindOne(s.db.Model(&SLABreach{}).Where(&SLABreach{
+		MGID:        item.MGID,
+		WAClient:    item.WAClient,
+		WAMessageID: item.WAMessageID,
+		Level:       item.Level,
+	}), current)
+	if err != nil || ok {
+		return false, err
+	}
+	dbItem := APISLABreach(*item).ToSLABreach()
+	if err = s.db.Save(dbItem).Error; err != nil {
+		return false, err
+	}
+	item.ID, item.CreatedAt = dbItem.ID, dbItem.CreatedAt
+	return true, nil
+}
+
+func (s *Store) GetSLABreachesOnPeriod(mgID string, start, end time.Time) (apiItems []*api.SLABreach, err error) {
+
+	items := SLABreaches{}
+	err = s.db.Model(&SLABreach{}).
+		Where("mg_id = ? and created_at between ? and ?", mgID, start, end.AddDate(0, 0, 1)).
+		Order("id").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPISLABreaches(), nil
+}
+
+func (s *Store) SaveNote(note *api.Note) (err error) {
+	item := APINote(*note).ToNote()
+	if err = s.db.Save(item).Error; err != nil {
+		return err
+	}
+	note.ID, note.CreatedAt = item.ID, item.CreatedAt
+	return
+}
+
+func (s *Store) GetNotesByClient(mgID, client string) (apiItems []*api.Note, err error) {
+
+	items := Notes{}
+	err = s.db.Model(&Note{}).Where(&Note{MGID: mgID, WAClient: client}).Order("id").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPINotes(), nil
+}
+
+func (s *Store) SaveWatch(watch *api.Watch) (err error) {
+
+	item := &Watch{}
+	_, err = s.FindOne(s.db.Model(&Watch{}).Where(
+		"mg_id = ? and tg_user_id = ? and wa_client = ? and operator = ?",
+		watch.MGID, watch.TGUserID, watch.WAClient, watch.Operator,
+	), item)
+	if err != nil {
+		return err
+	}
+	id := item.ID
+	item = APIWatch(*watch).ToWatch()
+	item.ID = id
+	if err = s.db.Save(item).Error; err != nil {
+		return err
+	}
+	watch.ID = item.ID
+	return
+}
+
+func (s *Store) GetWatches(mgID string) (apiItems []*api.Watch, err error) {
+
+	items := Watches{}
+	err = s.db.Model(&Watch{}).Where(&Watch{MGID: mgID}).Order("id").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPIWatches(), nil
+}
+
+// DeleteWatches delete watches of supervisor matched client and operator, empty client and operator match any
+func (s *Store) DeleteWatches(mgID string, tgUserID int, client, operator string) (count int64, err error) {
+	result := s.db.Unscoped().Where(&Watch{MGID: mgID, TGUserID: tgUserID, WAClient: client, Operator: operator}).Delete(&Watch{})
+	return result.RowsAffected, result.Error
+}
+
+func (s *Store) SaveCanned(canned *api.Canned) (err error) {
+
+	item := &Canned{}
+	_, err = s.FindOne(s.db.Model(&Canned{}).Where(&Canned{MGID: canned.MGID, Key: canned.Key}), item)
+	if err != nil {
+		return err
+	}
+	id := item.ID
+	item = APICanned(*canned).ToCanned()
+	item.ID = id
+	if err = s.db.Save(item).Error; err != nil {
+		return err
+	}
+	canned.ID = item.ID
+	return
+}
+
+func (s *Store) GetCanned(mgID, key string) (apiItem *api.Canned, err error) {
+
+	item := &Canned{}
+	ok, err := s.FindOne(s.db.Model(&Canned{}).Where(&Canned{MGID: mgID, Key: key}), item)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return item.ToAPICanned(), nil
+}
+
+func (s *Store) GetCannedResponses(mgID string) (apiItems []*api.Canned, err error) {
+
+	items := CannedResponses{}
+	err = s.db.Model(&Canned{}).Where(&Canned{MGID: mgID}).Order("canned_key").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPICannedResponses(), nil
+}
+
+func (s *Store) DeleteCanned(mgID, key string) (bool, error) {
+	result := s.db.Unscoped().Where(&Canned{MGID: mgID, Key: key}).Delete(&Canned{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (s *Store) SaveReminder(item *api.Reminder) (err error) {
+	dbItem := APIReminder(*item).ToReminder()
+	if item.ID != 0 {
+		current := &Reminder{}
+		if err = s.db.First(current, item.ID).Error; err != nil {
+			return err
+		}
+		dbItem.CreatedAt = current.CreatedAt
+	}
+	err = s.db.Save(dbItem).Error
+	if err != nil {
+		return err
+	}
+	item.ID = dbItem.ID
+	return
+}
+
+func (s *Store) GetReminder(id uint) (apiItem *api.Reminder, err error) {
+
+	item := &Reminder{}
+	ok, err := s.FindOne(s.db.Model(&Reminder{}).Where("id = ?", id), item)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return nil, nil
+	}
+	return item.ToAPIReminder(), nil
+}
+
+func (s *Store) GetRemindersPending(mgID string) (apiItems []*api.Reminder, err error) {
+
+	items := Reminders{}
+	err = s.db.Model(&Reminder{}).Where(&Reminder{MGID: mgID, Status: api.ReminderPending}).Order("remind_at, id").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPIReminders(), nil
+}
+
+func (s *Store) SaveCampaign(item *api.Campaign) (err error) {
+	dbItem := APICampaign(*item).ToCampaign()
+	if item.ID != 0 {
+		current := &Campaign{}
+		if err = s.db.First(current, item.ID).Error; err != nil {
+			return err
+		}
+		dbItem.CreatedAt = current.CreatedAt
+	}
+	err = s.db.Save(dbItem).Error
+	if err != nil {
+		return err
+	}
+	item.ID = dbItem.ID
+	return
+}
+
+func (s *Store) GetCampaign(id uint) (apiItem *api.Campaign, err error) {
+
+	item := &Campaign{}
+	ok, err := s.FindOne(s.db.Model(&Campaign{}).Where("id = ?", id), item)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return nil, nil
+	}
+	return item.ToAPICampaign(), nil
+}
+
+func (s *Store) GetCampaigns(mgID string) (apiItems []*api.Campaign, err error) {
+
+	items := Campaigns{}
+	err = s.db.Model(&Campaign{}).Where(&Campaign{MGID: mgID}).Order("id").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPICampaigns(), nil
+}
+
+func (s *Store) SaveCampaignRecipient(item *api.CampaignRecipient) (err error) {
+	dbItem := APICampaignRecipient(*item).ToCampaignRecipient()
+	if item.ID != 0 {
+		current := &CampaignRecipient{}
+		if err = s.db.First(current, item.ID).Error; err != nil {
+			return err
+		}
+		dbItem.CreatedAt = current.CreatedAt
+	}
+	err = s.db.Save(dbItem).Error
+	if err != nil {
+		return err
+	}
+	item.ID = dbItem.ID
+	return
+}
+
+func (s *Store) GetCampaignRecipients(campaignID uint) (apiItems []*api.CampaignRecipient, err error) {
+
+	items := CampaignRecipients{}
+	err = s.db.Model(&CampaignRecipient{}).Where(&CampaignRecipient{CampaignID: campaignID}).Order("id").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPICampaignRecipients(), nil
+}
+
+func (s *Store) GetCampaignRecipientNext(campaignID uint) (apiItem *api.CampaignRecipient, err error) {
+
+	item := &CampaignRecipient{}
+	ok, err := s.FindOne(s.db.Model(&CampaignRecipient{}).Where(&CampaignRecipient{CampaignID: campaignID, Status: api.RecipientPending}).Order("id"), item)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return nil, nil
+	}
+	return item.ToAPICampaignRecipient(), nil
+}
+
+// SaveOptOut save opt-out of client, created is false when client opted out already
+func (s *Store) SaveOptOut(optOut *api.OptOut) (created bool, err error) {
+
+	item := &OptOut{}
+	ok, err := s.FindOne(s.db.Model(&OptOut{}).Where(&OptOut{MGID: optOut.MGID, WAClient: optOut.WAClient}), item)
+	if err != nil || ok {
+		return false, err
+	}
+	item = APIOptOut(*optOut).ToOptOut()
+	if err = s.db.Save(item).Error; err != nil {
+		return false, err
+	}
+	optOut.ID = item.ID
+	return true, nil
+}
+
+func (s *Store) GetOptOuts(mgID string) (apiItems []*api.OptOut, err error) {
+
+	items := OptOuts{}
+	err = s.db.Model(&OptOut{}).Where(&OptOut{MGID: mgID}).Order("id").Find(&items).Error
+	if err != nil {
+		return
+	}
+	return items.ToAPIOptOuts(), nil
+}
+
+// GetClients WhatsApp clients with messages in main group since time, own messages and groups are skipped
+func (s *Store) GetClients(mgID string, since time.Time) (clients []string, err error) {
+
+	err = s.db.Model(&Message{}).
+		Where("mg_id = ? and created_at >= ? and wa_name <> ? and wa_client not like ?", mgID, since, "Self", "%@g.us").
+		Group("wa_client").
+		Order("wa_client").
+		Pluck("wa_client", &clients).Error
+	return
+}
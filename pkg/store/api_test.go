@@ -0,0 +1,515 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"tgwabr/api"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	_ = os.Setenv("TYPE_DB", "sqlite3")
+	_ = os.Setenv("NAME_INSTANCE", filepath.Join(t.TempDir(), "test"))
+	s, err := New(context.Background())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.ShutDown() })
+	return s
+}
+
+func TestStore_Session(t *testing.T) {
+	_ = os.Setenv("STORE_SESSION_KEY", "secret")
+	defer func() { _ = os.Unsetenv("STORE_SESSION_KEY") }()
+	s := newTestStore(t)
+
+	data, err := s.GetSession("-100")
+	if err != nil || data != nil {
+		t.Fatalf("GetSession() empty = %v, %v", data, err)
+	}
+
+	session := []byte("client-token")
+	if err = s.SaveSession("-100", session); err != nil {
+		t.Fatalf("SaveSession() error = %v", err)
+	}
+	if err = s.SaveSession("-100", session); err != nil {
+		t.Fatalf("SaveSession() update error = %v", err)
+	}
+
+	item := &WASession{}
+	if _, err = s.FindOne(s.db.Model(&WASession{}).Where(&WASession{MGID: "-100"}), item); err != nil {
+		t.Fatalf("FindOne() error = %v", err)
+	}
+	if bytes.Contains(item.Data, session) {
+		t.Errorf("SaveSession() stored plaintext")
+	}
+
+	data, err = s.GetSession("-100")
+	if err != nil || !bytes.Equal(data, session) {
+		t.Errorf("GetSession() = %s, %v, want %s", data, err, session)
+	}
+
+	s.sessionKey = nil
+	if err = s.SaveSession("-100", session); err == nil {
+		t.Errorf("SaveSession() without key error = nil")
+	}
+}
+
+func TestStore_Outbox(t *testing.T) {
+	s := newTestStore(t)
+
+	items := []*api.Outbox{
+		{MGID: "-100", WAClient: "1@s.whatsapp.net", Text: "first", Status: api.OutboxPending},
+		{MGID: "-100", WAClient: "1@s.whatsapp.net", Text: "second", Status: api.OutboxPending},
+		{MGID: "-200", WAClient: "1@s.whatsapp.net", Text: "other", Status: api.OutboxPending},
+	}
+	for _, v := range items {
+		if err := s.SaveOutbox(v); err != nil || v.ID == 0 {
+			t.Fatalf("SaveOutbox() = %d, %v", v.ID, err)
+		}
+	}
+
+	items[0].Status = api.OutboxSent
+	items[0].Attempts = 2
+	if err := s.SaveOutbox(items[0]); err != nil {
+		t.Fatalf("SaveOutbox() update error = %v", err)
+	}
+
+	got, err := s.GetOutboxPending("-100")
+	if err != nil || len(got) != 1 || got[0].ID != items[1].ID || got[0].Text != "second" {
+		t.Errorf("GetOutboxPending() = %+v, %v", got, err)
+	}
+}
+
+func TestStore_OutboxScheduled(t *testing.T) {
+	s := newTestStore(t)
+
+	now := time.Now()
+	items := []*api.Outbox{
+		{MGID: "-100", Text: "later", Status: api.OutboxScheduled, NextAt: now.Add(2 * time.Hour)},
+		{MGID: "-100", Text: "sooner", Status: api.OutboxScheduled, NextAt: now.Add(time.Hour)},
+		{MGID: "-100", Text: "now", Status: api.OutboxPending, NextAt: now},
+	}
+	for _, v := range items {
+		if err := s.SaveOutbox(v); err != nil {
+			t.Fatalf("SaveOutbox() error = %v", err)
+		}
+	}
+
+	got, err := s.GetOutboxScheduled("-100")
+	if err != nil || len(got) != 2 || got[0].Text != "sooner" || got[1].Text != "later" {
+		t.Errorf("GetOutboxScheduled() = %+v, %v, want in order of send time", got, err)
+	}
+	if item, err := s.GetOutbox(items[0].ID); err != nil || item == nil || item.Text != "later" {
+		t.Errorf("GetOutbox() = %+v, %v", item, err)
+	}
+	if item, err := s.GetOutbox(100); err != nil || item != nil {
+		t.Errorf("GetOutbox() of unknown = %+v, %v", item, err)
+	}
+}
+func TestStore_Undelivered(t *testing.T) {
+	s := newTestStore(t)
+
+	later := time.Now().Add(time.Hour)
+	items := []*api.Undelivered{
+		{MGID: "-100", WAMessageID: "A", Text: "first", Status: api.UndeliveredPending, NextAt: later},
+		{MGID: "-100", WAMessageID: "B", Text: "second", Status: api.UndeliveredPending, NextAt: later},
+		{MGID: "-200", WAMessageID: "C", Text: "other", Status: api.UndeliveredPending, NextAt: later},
+	}
+	for _, v := range items {
+		if err := s.SaveUndelivered(v); err != nil {
+			t.Fatalf("SaveUndelivered() error = %v", err)
+		}
+	}
+
+	items[0].Status = api.UndeliveredDelivered
+	if err := s.SaveUndelivered(items[0]); err != nil {
+		t.Fatalf("SaveUndelivered() update error = %v", err)
+	}
+
+	if count, err := s.CountUndelivered("-100"); err != nil || count != 1 {
+		t.Errorf("CountUndelivered() = %d, %v, want 1", count, err)
+	}
+
+	if err := s.RetryUndelivered("-100"); err != nil {
+		t.Fatalf("RetryUndelivered() error = %v", err)
+	}
+	got, err := s.GetUndelivered("-100")
+	if err != nil || len(got) != 1 || got[0].WAMessageID != "B" || got[0].NextAt.After(time.Now()) {
+		t.Errorf("GetUndelivered() = %+v, %v", got, err)
+	}
+}
+
+func TestStore_AutoReplySent(t *testing.T) {
+	s := newTestStore(t)
+
+	if got, err := s.GetAutoReplySent("-100", "1@s.whatsapp.net", 1); got != nil || err != nil {
+		t.Fatalf("GetAutoReplySent() = %+v, %v, want nil", got, err)
+	}
+	at := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, v := range []*api.AutoReplySent{
+		{MGID: "-100", WAClient: "1@s.whatsapp.net", AutoReplyID: 1, At: at.Add(-time.Hour)},
+		{MGID: "-100", WAClient: "1@s.whatsapp.net", AutoReplyID: 1, At: at},
+		{MGID: "-100", WAClient: "1@s.whatsapp.net", AutoReplyID: 2, At: at.Add(-time.Hour)},
+	} {
+		if err := s.SaveAutoReplySent(v); err != nil {
+			t.Fatalf("SaveAutoReplySent() error = %v", err)
+		}
+	}
+	got, err := s.GetAutoReplySent("-100", "1@s.whatsapp.net", 1)
+	if err != nil || got == nil || !got.At.Equal(at) {
+		t.Errorf("GetAutoReplySent() = %+v, %v, want last reply at %s", got, err, at)
+	}
+	if got, err = s.GetAutoReplySent("-200", "1@s.whatsapp.net", 1); got != nil || err != nil {
+		t.Errorf("GetAutoReplySent() other main group = %+v, %v, want nil", got, err)
+	}
+}
+
+func TestStore_GetStatOnPeriod(t *testing.T) {
+	s := newTestStore(t)
+
+	if err := s.SaveCalendar(&api.Calendar{MGID: "-100", Timezone: "UTC", Hours: "1-7 09:00-18:00"}); err != nil {
+		t.Fatalf("SaveCalendar() error = %v", err)
+	}
+
+	// asked an hour before opening, answered 30 minutes after
+	asked := time.Date(2022, 3, 7, 8, 0, 0, 0, time.UTC)
+	messages := []*api.Message{
+		{MGID: "-100", WAMessageID: "A", WAClient: "1", TGUserName: "operator", Session: "s1", Direction: api.DirectionWa2tg,
+			WATimestamp: uint64(asked.Unix()), Answered: uint64((90 * time.Minute).Seconds())},
+		{MGID: "-100", WAMessageID: "B", WAClient: "1", TGUserName: "operator", Session: "s1", Direction: api.DirectionTg2wa},
+		{MGID: "-100", WAMessageID: "D", WAClient: "2", TGUserName: "operator", Direction: api.DirectionWa2tg},
+		{MGID: "-200", WAMessageID: "C", WAClient: "1", TGUserName: "operator", Session: "s1", Direction: api.DirectionWa2tg,
+			WATimestamp: uint64(asked.Unix()), Answered: uint64((90 * time.Minute).Seconds())},
+	}
+	for _, v := range messages {
+		if err := s.SaveMessage(v); err != nil {
+			t.Fatalf("SaveMessage() error = %v", err)
+		}
+	}
+
+	got, err := s.GetStatOnPeriod(-100, "", time.Now().AddDate(0, 0, -1), time.Now())
+	if err != nil || len(got) != 2 {
+		t.Fatalf("GetStatOnPeriod() = %+v, %v", got, err)
+	}
+	if got[0].WAClient != "2" || got[0].Answered != nil || got[0].CountIn != 1 || got[0].Session != nil {
+		t.Errorf("GetStatOnPeriod() = %+v, want client 2 without session", got[0])
+	}
+	if got[1].Answered == nil || *got[1].Answered != 30 || got[1].CountIn != 1 || got[1].CountOut != 1 ||
+		got[1].Session == nil || time.Since(*got[1].Session) > time.Minute {
+		t.Errorf("GetStatOnPeriod() = %+v, want answered 30, 1 in, 1 out", got[1])
+	}
+	if y, m, d := got[1].Date.Date(); y != time.Now().UTC().Year() || m != time.Now().UTC().Month() || d != time.Now().UTC().Day() {
+		t.Errorf("GetStatOnPeriod() date = %s, want today", got[1].Date)
+	}
+
+	// without working hours answered time is counted in SQL
+	got, err = s.GetStatOnPeriod(-200, "operator", time.Now().AddDate(0, 0, -1), time.Now())
+	if err != nil || len(got) != 1 || got[0].Answered == nil || *got[0].Answered != 90 {
+		t.Errorf("GetStatOnPeriod() = %+v, %v, want answered 90", got, err)
+	}
+}
+
+func TestStore_FreeChat(t *testing.T) {
+	s := newTestStore(t)
+
+	for _, v := range []api.FreeChat{{TGChatID: -300}, {MGID: "-100", TGChatID: -200}, {MGID: "-101", TGChatID: -400}, {TGChatID: -300}, {TGChatID: -400}} {
+		if err := s.SaveFreeChat(&api.FreeChat{MGID: v.MGID, TGChatID: v.TGChatID, Title: "free"}); err != nil {
+			t.Fatalf("SaveFreeChat() error = %v", err)
+		}
+	}
+	if ok, err := s.DeleteFreeChat(-500); ok || err != nil {
+		t.Errorf("DeleteFreeChat() of unknown = %v, %v", ok, err)
+	}
+
+	// own chat of main group first, then chat not served any main group, never chat of other main group
+	for _, want := range []int64{-200, -300} {
+		got, err := s.TakeFreeChat("-100")
+		if err != nil || got == nil || got.TGChatID != want {
+			t.Fatalf("TakeFreeChat() = %+v, %v, want %d", got, err, want)
+		}
+	}
+	if got, err := s.TakeFreeChat("-100"); got != nil || err != nil {
+		t.Errorf("TakeFreeChat() of empty pool = %+v, %v", got, err)
+	}
+	if got, err := s.TakeFreeChat("-101"); err != nil || got == nil || got.TGChatID != -400 || got.MGID != "-101" {
+		t.Errorf("TakeFreeChat() of other main group = %+v, %v, want -400", got, err)
+	}
+}
+
+func TestStore_Assignment(t *testing.T) {
+	s := newTestStore(t)
+
+	operator := &api.Operator{TGUserID: 11, TGUserName: "operator"}
+	if err := s.SaveOperator(operator); err != nil {
+		t.Fatalf("SaveOperator() error = %v", err)
+	}
+	operator.LastAssignedAt = time.Now()
+	if err := s.SaveOperator(operator); err != nil {
+		t.Fatalf("SaveOperator() error = %v", err)
+	}
+	operators, err := s.GetOperators()
+	if err != nil || len(operators) != 1 || operators[0].LastAssignedAt.IsZero() {
+		t.Fatalf("GetOperators() = %+v, %v, want one updated operator", operators, err)
+	}
+
+	for _, client := range []string{"79111135900", "79111135901"} {
+		item := &api.Assignment{MGID: "-100", WAClient: client, TGUserID: 11, Status: api.AssignmentPending}
+		if err = s.SaveAssignment(item); err != nil || item.ID == 0 {
+			t.Fatalf("SaveAssignment() = %+v, %v", item, err)
+		}
+	}
+	item, err := s.GetAssignment(1)
+	if err != nil || item == nil || item.WAClient != "79111135900" {
+		t.Fatalf("GetAssignment() = %+v, %v", item, err)
+	}
+	item.Status = api.AssignmentAccepted
+	if err = s.SaveAssignment(item); err != nil {
+		t.Fatalf("SaveAssignment() error = %v", err)
+	}
+	if err = s.SaveAssignment(&api.Assignment{MGID: "-100", WAClient: "79111135902", Status: api.AssignmentNew}); err != nil {
+		t.Fatalf("SaveAssignment() error = %v", err)
+	}
+	items, err := s.GetAssignmentsPending("-100")
+	if err != nil || len(items) != 2 || items[0].WAClient != "79111135901" || items[1].Status != api.AssignmentNew {
+		t.Errorf("GetAssignmentsPending() = %+v, %v", items, err)
+	}
+	if item, err = s.GetAssignment(4); item != nil || err != nil {
+		t.Errorf("GetAssignment() of unknown = %+v, %v", item, err)
+	}
+}
+
+func TestStore_SLABreach(t *testing.T) {
+	s := newTestStore(t)
+
+	for i, want := range []bool{true, false} {
+		created, err := s.SaveSLABreach(&api.SLABreach{MGID: "-100", WAClient: "c1", WAMessageID: "m1", Kind: api.SLAFirst, Level: api.SLABreached})
+		if err != nil || created != want {
+			t.Fatalf("SaveSLABreach() #%d = %v, %v, want %v", i, created, err, want)
+		}
+	}
+	if created, err := s.SaveSLABreach(&api.SLABreach{MGID: "-100", WAClient: "c1", WAMessageID: "m1", Kind: api.SLAFirst, Level: api.SLAEscalated}); !created || err != nil {
+		t.Fatalf("SaveSLABreach() of next level = %v, %v", created, err)
+	}
+
+	now := time.Now()
+	items, err := s.GetSLABreachesOnPeriod("-100", now.AddDate(0, 0, -1), now)
+	if err != nil || len(items) != 2 || items[1].Level != api.SLAEscalated {
+		t.Errorf("GetSLABreachesOnPeriod() = %+v, %v", items, err)
+	}
+	if items, err = s.GetSLABreachesOnPeriod("-200", now.AddDate(0, 0, -1), now); err != nil || len(items) != 0 {
+		t.Errorf("GetSLABreachesOnPeriod() of other main group = %+v, %v", items, err)
+	}
+}
+
+func TestStore_Notes(t *testing.T) {
+	s := newTestStore(t)
+
+	for _, note := range []*api.Note{
+		{MGID: "-100", WAClient: "c1", TGUserName: "operator", Text: "first"},
+		{MGID: "-100", WAClient: "c2", TGUserName: "operator", Text: "other client"},
+		{MGID: "-100", WAClient: "c1", TGUserName: "other", Text: "second"},
+	} {
+		if err := s.SaveNote(note); err != nil || note.ID == 0 || note.CreatedAt.IsZero() {
+			t.Fatalf("SaveNote() = %+v, %v", note, err)
+		}
+	}
+	items, err := s.GetNotesByClient("-100", "c1")
+	if err != nil || len(items) != 2 || items[0].Text != "first" || items[1].TGUserName != "other" {
+		t.Errorf("GetNotesByClient() = %+v, %v", items, err)
+	}
+}
+
+func TestStore_Watch(t *testing.T) {
+	s := newTestStore(t)
+
+	for _, watch := range []*api.Watch{
+		{MGID: "-100", TGUserID: 10, WAClient: "c1"},
+		{MGID: "-100", TGUserID: 10, WAClient: "c1"},
+		{MGID: "-100", TGUserID: 10, Operator: "operator"},
+		{MGID: "-100", TGUserID: 11, WAClient: "c1"},
+	} {
+		if err := s.SaveWatch(watch); err != nil {
+			t.Fatalf("SaveWatch() error = %v", err)
+		}
+	}
+	items, err := s.GetWatches("-100")
+	if err != nil || len(items) != 3 {
+		t.Fatalf("GetWatches() = %+v, %v, want 3 watches", items, err)
+	}
+
+	if count, err := s.DeleteWatches("-100", 10, "", "operator"); count != 1 || err != nil {
+		t.Errorf("DeleteWatches() of operator = %d, %v", count, err)
+	}
+	if count, err := s.DeleteWatches("-100", 10, "", ""); count != 1 || err != nil {
+		t.Errorf("DeleteWatches() of all = %d, %v", count, err)
+	}
+	if items, err = s.GetWatches("-100"); err != nil || len(items) != 1 || items[0].TGUserID != 11 {
+		t.Errorf("GetWatches() = %+v, %v, want watch of other supervisor", items, err)
+	}
+}
+
+func TestStore_Canned(t *testing.T) {
+	s := newTestStore(t)
+
+	for _, canned := range []*api.Canned{
+		{MGID: "-100", Key: "hi", Text: "Hello"},
+		{MGID: "-100", Key: "hi", Text: "Hello {{.Client}}"},
+		{MGID: "-100", Key: "bye", Text: "Bye"},
+		{MGID: "-200", Key: "hi", Text: "Hi"},
+	} {
+		if err := s.SaveCanned(canned); err != nil {
+			t.Fatalf("SaveCanned() error = %v", err)
+		}
+	}
+	items, err := s.GetCannedResponses("-100")
+	if err != nil || len(items) != 2 || items[0].Key != "bye" || items[1].Text != "Hello {{.Client}}" {
+		t.Fatalf("GetCannedResponses() = %+v, %v, want bye and updated hi", items, err)
+	}
+
+	if ok, err := s.DeleteCanned("-100", "hi"); !ok || err != nil {
+		t.Errorf("DeleteCanned() = %v, %v", ok, err)
+	}
+	if ok, err := s.DeleteCanned("-100", "hi"); ok || err != nil {
+		t.Errorf("DeleteCanned() of deleted = %v, %v", ok, err)
+	}
+	if canned, err := s.GetCanned("-200", "hi"); err != nil || canned == nil || canned.Text != "Hi" {
+		t.Errorf("GetCanned() of other main group = %+v, %v", canned, err)
+	}
+}
+
+func TestStore_Reminder(t *testing.T) {
+	s := newTestStore(t)
+
+	now := time.Now()
+	items := []*api.Reminder{
+		{MGID: "-100", TGUserID: 11, Note: "later", Status: api.ReminderPending, RemindAt: now.Add(2 * time.Hour)},
+		{MGID: "-100", TGUserID: 11, Note: "sooner", Status: api.ReminderPending, RemindAt: now.Add(time.Hour)},
+		{MGID: "-100", TGUserID: 11, Note: "sent", Status: api.ReminderSent, RemindAt: now},
+	}
+	for _, v := range items {
+		if err := s.SaveReminder(v); err != nil || v.ID == 0 {
+			t.Fatalf("SaveReminder() = %d, %v", v.ID, err)
+		}
+	}
+
+	got, err := s.GetRemindersPending("-100")
+	if err != nil || len(got) != 2 || got[0].Note != "sooner" || got[1].Note != "later" {
+		t.Errorf("GetRemindersPending() = %+v, %v, want in order of time", got, err)
+	}
+
+	items[2].Status = api.ReminderDone
+	if err = s.SaveReminder(items[2]); err != nil {
+		t.Fatalf("SaveReminder() update error = %v", err)
+	}
+	if item, err := s.GetReminder(items[2].ID); err != nil || item == nil || item.Status != api.ReminderDone {
+		t.Errorf("GetReminder() = %+v, %v", item, err)
+	}
+}
+
+func TestStore_Campaign(t *testing.T) {
+	s := newTestStore(t)
+
+	for _, v := range []*api.Message{
+		{MGID: "-100", WAClient: "2@s.whatsapp.net", WAMessageID: "m1", WAName: "Anna"},
+		{MGID: "-100", WAClient: "1@s.whatsapp.net", WAMessageID: "m2", WAName: "Maxim"},
+		{MGID: "-100", WAClient: "1@s.whatsapp.net", WAMessageID: "m3", WAName: "Maxim"},
+		{MGID: "-100", WAClient: "0@s.whatsapp.net", WAMessageID: "m4", WAName: "Self"},
+		{MGID: "-100", WAClient: "1-2@g.us", WAMessageID: "m5", WAName: "Group"},
+		{MGID: "-200", WAClient: "3@s.whatsapp.net", WAMessageID: "m6", WAName: "Other"},
+	} {
+		if err := s.SaveMessage(v); err != nil {
+			t.Fatalf("SaveMessage() error = %v", err)
+		}
+	}
+	clients, err := s.GetClients("-100", time.Now().Add(-time.Hour))
+	if err != nil || !reflect.DeepEqual(clients, []string{"1@s.whatsapp.net", "2@s.whatsapp.net"}) {
+		t.Errorf("GetClients() = %v, %v", clients, err)
+	}
+	if clients, err = s.GetClients("-100", time.Now().Add(time.Hour)); err != nil || len(clients) != 0 {
+		t.Errorf("GetClients() in future = %v, %v", clients, err)
+	}
+
+	campaign := &api.Campaign{MGID: "-100", Segment: "all", Text: "Sale", Status: api.CampaignDraft}
+	if err = s.SaveCampaign(campaign); err != nil {
+		t.Fatalf("SaveCampaign() error = %v", err)
+	}
+	for _, v := range []string{"1@s.whatsapp.net", "2@s.whatsapp.net"} {
+		if err = s.SaveCampaignRecipient(&api.CampaignRecipient{CampaignID: campaign.ID, WAClient: v, Status: api.RecipientPending}); err != nil {
+			t.Fatalf("SaveCampaignRecipient() error = %v", err)
+		}
+	}
+	next, err := s.GetCampaignRecipientNext(campaign.ID)
+	if err != nil || next == nil || next.WAClient != "1@s.whatsapp.net" {
+		t.Fatalf("GetCampaignRecipientNext() = %+v, %v", next, err)
+	}
+	next.Status = api.RecipientSent
+	if err = s.SaveCampaignRecipient(next); err != nil {
+		t.Fatalf("SaveCampaignRecipient() update error = %v", err)
+	}
+	if next, err = s.GetCampaignRecipientNext(campaign.ID); err != nil || next == nil || next.WAClient != "2@s.whatsapp.net" {
+		t.Errorf("GetCampaignRecipientNext() after send = %+v, %v", next, err)
+	}
+	if items, err := s.GetCampaignRecipients(campaign.ID); err != nil || len(items) != 2 {
+		t.Errorf("GetCampaignRecipients() = %+v, %v", items, err)
+	}
+	if items, err := s.GetCampaigns("-100"); err != nil || len(items) != 1 || items[0].Text != "Sale" {
+		t.Errorf("GetCampaigns() = %+v, %v", items, err)
+	}
+
+	for i, want := range []bool{true, false} {
+		created, err := s.SaveOptOut(&api.OptOut{MGID: "-100", WAClient: "1@s.whatsapp.net"})
+		if err != nil || created != want {
+			t.Fatalf("SaveOptOut() #%d = %v, %v, want %v", i, created, err, want)
+		}
+	}
+	if items, err := s.GetOptOuts("-100"); err != nil || len(items) != 1 {
+		t.Errorf("GetOptOuts() = %+v, %v, want one opt-out", items, err)
+	}
+}
+
+func TestStore_GetWaitingInSession(t *testing.T) {
+	s := newTestStore(t)
+
+	save := func(id, direction, session string) {
+		t.Helper()
+		if err := s.SaveMessage(&api.Message{MGID: "-100", WAClient: "c1", WAMessageID: id, Direction: direction, Session: session}); err != nil {
+			t.Fatalf("SaveMessage() error = %v", err)
+		}
+	}
+	save("m1", api.DirectionWa2tg, "s1")
+	if item, err := s.GetWaitingInSession("-100", "c1", "s1"); err != nil || item == nil || item.WAMessageID != "m1" {
+		t.Fatalf("GetWaitingInSession() = %+v, %v, want m1", item, err)
+	}
+	save("a1", api.DirectionTg2wa, "s1")
+	save("m0", api.DirectionWa2tg, "s0")
+	if item, err := s.GetWaitingInSession("-100", "c1", "s1"); err != nil || item != nil {
+		t.Fatalf("GetWaitingInSession() after answer = %+v, %v, want nil", item, err)
+	}
+	save("m2", api.DirectionWa2tg, "s1")
+	save("m3", api.DirectionWa2tg, "s1")
+	if item, err := s.GetWaitingInSession("-100", "c1", "s1"); err != nil || item == nil || item.WAMessageID != "m2" {
+		t.Errorf("GetWaitingInSession() = %+v, %v, want m2", item, err)
+	}
+}
+
+func TestStore_GetLastMessagesByClient(t *testing.T) {
+	s := newTestStore(t)
+
+	for _, v := range []api.Message{{MGID: "-100", WAClient: "c1", WAMessageID: "m1"}, {MGID: "-100", WAClient: "c2", WAMessageID: "m2"},
+		{MGID: "-101", WAClient: "c1", WAMessageID: "m3"}, {MGID: "-100", WAClient: "c1", WAMessageID: "m4"}, {MGID: "-100", WAClient: "c1", WAMessageID: "m5"}} {
+		item := v
+		if err := s.SaveMessage(&item); err != nil {
+			t.Fatalf("SaveMessage() error = %v", err)
+		}
+	}
+	items, err := s.GetLastMessagesByClient("-100", "c1", 2)
+	if err != nil || len(items) != 2 || items[0].WAMessageID != "m4" || items[1].WAMessageID != "m5" {
+		t.Errorf("GetLastMessagesByClient() = %+v, %v, want m4, m5", items, err)
+	}
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"os"
 	"tgwabr/api"
@@ -16,10 +17,127 @@ import (
 type MainGroup struct {
 	gorm.Model
 
-	TGChatID     int64  `gorm:"index"`
-	Name         string `gorm:"index"`
-	MessagePin   int
-	LoggerChatID int64
+	TGChatID      int64  `gorm:"index"`
+	Name          string `gorm:"index"`
+	MessagePin    int
+	LoggerChatID  int64
+	Topics        bool
+	AssignPolicy  string
+	AssignTimeout time.Duration
+	SLAFirst      time.Duration
+	SLANext       time.Duration
+	SLAEscalate   time.Duration
+	NotePrefix    string
+	OptOutKeyword string
+}
+
+type Operator struct {
+	gorm.Model
+
+	TGUserID       int `gorm:"unique_index"`
+	TGUserName     string
+	LastAssignedAt time.Time
+	Presence       string
+	PresenceAt     time.Time
+	AwayAfter      time.Duration
+	LastActiveAt   time.Time
+	Supervisor     bool
+}
+
+type Assignment struct {
+	gorm.Model
+
+	MGID        string `gorm:"index"`
+	WAClient    string
+	Name        string
+	TGUserID    int
+	TGUserName  string
+	MessageID   int
+	MGMessageID int
+	Status      string `gorm:"index"`
+	ExpiresAt   time.Time
+}
+
+type SLABreach struct {
+	gorm.Model
+
+	MGID        string `gorm:"index"`
+	WAClient    string `gorm:"index"`
+	WAMessageID string
+	Kind        string
+	Level       string
+	TGUserName  string
+	Waited      time.Duration
+}
+
+type Canned struct {
+	gorm.Model
+
+	MGID string `gorm:"index"`
+	Key  string `gorm:"column:canned_key"`
+	Text string
+}
+
+type Reminder struct {
+	gorm.Model
+
+	MGID        string `gorm:"index"`
+	WAClient    string
+	TGChatID    int64
+	TGMessageID int
+	TGUserID    int
+	TGUserName  string
+	Note        string
+	Status      string `gorm:"index"`
+	RemindAt    time.Time
+}
+
+type Campaign struct {
+	gorm.Model
+
+	MGID       string `gorm:"index"`
+	Segment    string
+	Text       string
+	TGUserName string
+	Status     string `gorm:"index"`
+	MessageID  int
+	NextAt     time.Time
+}
+
+type CampaignRecipient struct {
+	gorm.Model
+
+	CampaignID  uint `gorm:"index"`
+	WAClient    string
+	Status      string `gorm:"index"`
+	WAMessageID string
+	Error       string
+}
+
+type OptOut struct {
+	gorm.Model
+
+	MGID     string `gorm:"index"`
+	WAClient string `gorm:"index"`
+}
+
+type Watch struct {
+	gorm.Model
+
+	MGID       string `gorm:"index"`
+	TGUserID   int    `gorm:"index"`
+	TGUserName string
+	WAClient   string
+	Operator   string
+}
+
+type Note struct {
+	gorm.Model
+
+	MGID       string `gorm:"index"`
+	WAClient   string `gorm:"index"`
+	TGUserName string
+	Text       string
 }
 
 type Chat struct {
@@ -54,6 +172,9 @@ type Message struct {
 	MessageStatus  int
 	Text           string
 	Session        string `gorm:"index"`
+	RevokeStatus   string
+	RevokedBy      string
+	AfterHours     bool
 }
 
 type Alias struct {
@@ -75,6 +196,126 @@ type Contact struct {
 	ShortName string
 }
 
+type WASession struct {
+	gorm.Model
+
+	MGID string `gorm:"index"`
+	Data []byte
+}
+
+type Outbox struct {
+	gorm.Model
+
+	MGID           string `gorm:"index"`
+	WAClient       string `gorm:"index"`
+	TGChatID       int64
+	TGUserName     string
+	TGMessageID    int
+	TGTimestamp    int
+	TGFwdMessageID int
+	TGFwdChatID    int64
+	Session        string
+	Kind           string
+	Text           string
+	FileID         string
+	FileName       string
+	Mime           string
+	Lat            float64
+	Lon            float64
+	Phone          string
+	Name           string
+	QuotedID       string
+	Quoted         string
+	Status         string `gorm:"index"`
+	Attempts       int
+	NextAt         time.Time
+	Error          string
+}
+
+type Transfer struct {
+	gorm.Model
+
+	MGID       string `gorm:"index"`
+	WAClient   string `gorm:"index"`
+	Session    string `gorm:"index"`
+	FromUser   string
+	ToUser     string
+	FromChatID int64
+	ToChatID   int64
+	Note       string
+}
+
+type FreeChat struct {
+	gorm.Model
+
+	MGID     string `gorm:"index"`
+	TGChatID int64  `gorm:"unique_index"`
+	Title    string
+}
+
+type Topic struct {
+	gorm.Model
+
+	MGID     string `gorm:"index"`
+	WAClient string `gorm:"index"`
+	ThreadID int    `gorm:"index"`
+	Name     string
+}
+
+type Calendar struct {
+	gorm.Model
+
+	MGID     string `gorm:"index"`
+	Timezone string
+	Hours    string
+	Holidays string
+}
+
+type AutoReply struct {
+	gorm.Model
+
+	MGID string `gorm:"index"`
+	Rule string
+	Text string
+}
+
+type AutoReplySent struct {
+	gorm.Model
+
+	MGID        string `gorm:"index"`
+	WAClient    string `gorm:"index"`
+	AutoReplyID uint   `gorm:"index"`
+	At          time.Time
+}
+
+type Undelivered struct {
+	gorm.Model
+
+	MGID          string `gorm:"index"`
+	WAMessageID   string `gorm:"index"`
+	Kind          string
+	Client        string
+	Name          string
+	From          string
+	FromName      string
+	FromMe        bool
+	Owner         string
+	Timestamp     uint64
+	MessageStatus int
+	QuotedID      string
+	Text          string
+	Caption       string
+	FileName      string
+	Lat           float64
+	Lon           float64
+	VCard         string
+	Media         []byte
+	Status        string `gorm:"index"`
+	Attempts      int
+	NextAt        time.Time
+	Error         string
+}
+
 type APIMessage api.Message
 
 func (a APIMessage) ToMessage() *Message {
@@ -196,8 +437,9 @@ func (a Contacts) ToAPIContacts() []*api.Contact {
 }
 
 type Store struct {
-	ctx context.Context
-	db  *gorm.DB
+	ctx        context.Context
+	db         *gorm.DB
+	sessionKey []byte
 	api.Store
 }
 
@@ -205,6 +447,11 @@ func New(ctx context.Context) (store *Store, err error) {
 
 	store = &Store{ctx: ctx}
 
+	if key := os.Getenv("STORE_SESSION_KEY"); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		store.sessionKey = sum[:]
+	}
+
 	name := os.Getenv("NAME_INSTANCE")
 	user := os.Getenv("DB_USER")
 	pass := os.Getenv("DB_PASS")
@@ -234,6 +481,25 @@ func New(ctx context.Context) (store *Store, err error) {
 	store.db.AutoMigrate(&MainGroup{})
 	store.db.AutoMigrate(&Alias{})
 	store.db.AutoMigrate(&Contact{})
+	store.db.AutoMigrate(&WASession{})
+	store.db.AutoMigrate(&Outbox{})
+	store.db.AutoMigrate(&Undelivered{})
+	store.db.AutoMigrate(&AutoReply{})
+	store.db.AutoMigrate(&AutoReplySent{})
+	store.db.AutoMigrate(&Calendar{})
+	store.db.AutoMigrate(&Topic{})
+	store.db.AutoMigrate(&FreeChat{})
+	store.db.AutoMigrate(&Transfer{})
+	store.db.AutoMigrate(&Operator{})
+	store.db.AutoMigrate(&Assignment{})
+	store.db.AutoMigrate(&SLABreach{})
+	store.db.AutoMigrate(&Note{})
+	store.db.AutoMigrate(&Watch{})
+	store.db.AutoMigrate(&Canned{})
+	store.db.AutoMigrate(&Reminder{})
+	store.db.AutoMigrate(&Campaign{})
+	store.db.AutoMigrate(&CampaignRecipient{})
+	store.db.AutoMigrate(&OptOut{})
 
 	return
 }
@@ -262,3 +528,395 @@ func (s *Store) Check(db *gorm.DB) (bool, error) {
 	}
 	return count > 0, nil
 }
+
+type APIOutbox api.Outbox
+
+func (a APIOutbox) ToOutbox() *Outbox {
+	item := &Outbox{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a Outbox) ToAPIOutbox() *api.Outbox {
+	item := &api.Outbox{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type Outboxes []*Outbox
+
+func (a Outboxes) ToAPIOutboxes() []*api.Outbox {
+	list := make([]*api.Outbox, len(a))
+	for i, item := range a {
+		list[i] = item.ToAPIOutbox()
+	}
+	return list
+}
+
+type APIUndelivered api.Undelivered
+
+func (a APIUndelivered) ToUndelivered() *Undelivered {
+	item := &Undelivered{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a Undelivered) ToAPIUndelivered() *api.Undelivered {
+	item := &api.Undelivered{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type Undelivereds []*Undelivered
+
+func (a Undelivereds) ToAPIUndelivereds() []*api.Undelivered {
+	list := make([]*api.Undelivered, len(a))
+	for i, item := range a {
+		list[i] = item.ToAPIUndelivered()
+	}
+	return list
+}
+
+type APIAutoReply api.AutoReply
+
+func (a APIAutoReply) ToAutoReply() *AutoReply {
+	item := &AutoReply{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a AutoReply) ToAPIAutoReply() *api.AutoReply {
+	item := &api.AutoReply{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type AutoReplies []*AutoReply
+
+func (a AutoReplies) ToAPIAutoReplies() []*api.AutoReply {
+	list := make([]*api.AutoReply, len(a))
+	for i, item := range a {
+		list[i] = item.ToAPIAutoReply()
+	}
+	return list
+}
+
+type APIAutoReplySent api.AutoReplySent
+
+func (a APIAutoReplySent) ToAutoReplySent() *AutoReplySent {
+	item := &AutoReplySent{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a AutoReplySent) ToAPIAutoReplySent() *api.AutoReplySent {
+	item := &api.AutoReplySent{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type APICalendar api.Calendar
+
+func (a APICalendar) ToCalendar() *Calendar {
+	item := &Calendar{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a Calendar) ToAPICalendar() *api.Calendar {
+	item := &api.Calendar{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type APITopic api.Topic
+
+func (a APITopic) ToTopic() *Topic {
+	item := &Topic{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a Topic) ToAPITopic() *api.Topic {
+	item := &api.Topic{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type APIFreeChat api.FreeChat
+
+func (a APIFreeChat) ToFreeChat() *FreeChat {
+	item := &FreeChat{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a FreeChat) ToAPIFreeChat() *api.FreeChat {
+	item := &api.FreeChat{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type APITransfer api.Transfer
+
+func (a APITransfer) ToTransfer() *Transfer {
+	item := &Transfer{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a Transfer) ToAPITransfer() *api.Transfer {
+	item := &api.Transfer{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type Transfers []*Transfer
+
+func (a Transfers) ToAPITransfers() []*api.Transfer {
+	list := make([]*api.Transfer, len(a))
+	for i, item := range a {
+		list[i] = item.ToAPITransfer()
+	}
+	return list
+}
+
+type APIOperator api.Operator
+
+func (a APIOperator) ToOperator() *Operator {
+	item := &Operator{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a Operator) ToAPIOperator() *api.Operator {
+	item := &api.Operator{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type Operators []*Operator
+
+func (a Operators) ToAPIOperators() []*api.Operator {
+	list := make([]*api.Operator, len(a))
+	for i, item := range a {
+		list[i] = item.ToAPIOperator()
+	}
+	return list
+}
+
+type APIAssignment api.Assignment
+
+func (a APIAssignment) ToAssignment() *Assignment {
+	item := &Assignment{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a Assignment) ToAPIAssignment() *api.Assignment {
+	item := &api.Assignment{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type Assignments []*Assignment
+
+func (a Assignments) ToAPIAssignments() []*api.Assignment {
+	list := make([]*api.Assignment, len(a))
+	for i, item := range a {
+		list[i] = item.ToAPIAssignment()
+	}
+	return list
+}
+
+type APISLABreach api.SLABreach
+
+func (a APISLABreach) ToSLABreach() *SLABreach {
+	item := &SLABreach{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a SLABreach) ToAPISLABreach() *api.SLABreach {
+	item := &api.SLABreach{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type SLABreaches []*SLABreach
+
+func (a SLABreaches) ToAPISLABreaches() []*api.SLABreach {
+	list := make([]*api.SLABreach, len(a))
+	for i, item := range a {
+		list[i] = item.ToAPISLABreach()
+	}
+	return list
+}
+
+type APINote api.Note
+
+func (a APINote) ToNote() *Note {
+	item := &Note{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a Note) ToAPINote() *api.Note {
+	item := &api.Note{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type Notes []*Note
+
+func (a Notes) ToAPINotes() []*api.Note {
+	list := make([]*api.Note, len(a))
+	for i, item := range a {
+		list[i] = item.ToAPINote()
+	}
+	return list
+}
+
+type APIWatch api.Watch
+
+func (a APIWatch) ToWatch() *Watch {
+	item := &Watch{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a Watch) ToAPIWatch() *api.Watch {
+	item := &api.Watch{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type Watches []*Watch
+
+func (a Watches) ToAPIWatches() []*api.Watch {
+	list := make([]*api.Watch, len(a))
+	for i, item := range a {
+		list[i] = item.ToAPIWatch()
+	}
+	return list
+}
+
+type APICanned api.Canned
+
+func (a APICanned) ToCanned() *Canned {
+	item := &Canned{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a Canned) ToAPICanned() *api.Canned {
+	item := &api.Canned{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type CannedResponses []*Canned
+
+func (a CannedResponses) ToAPICannedResponses() []*api.Canned {
+	list := make([]*api.Canned, len(a))
+	for i, item := range a {
+		list[i] = item.ToAPICanned()
+	}
+	return list
+}
+
+type APIReminder api.Reminder
+
+func (a APIReminder) ToReminder() *Reminder {
+	item := &Reminder{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a Reminder) ToAPIReminder() *api.Reminder {
+	item := &api.Reminder{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type Reminders []*Reminder
+
+func (a Reminders) ToAPIReminders() []*api.Reminder {
+	list := make([]*api.Reminder, len(a))
+	for i, item := range a {
+		list[i] = item.ToAPIReminder()
+	}
+	return list
+}
+
+type APICampaign api.Campaign
+
+func (a APICampaign) ToCampaign() *Campaign {
+	item := &Campaign{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a Campaign) ToAPICampaign() *api.Campaign {
+	item := &api.Campaign{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type Campaigns []*Campaign
+
+func (a Campaigns) ToAPICampaigns() []*api.Campaign {
+	list := make([]*api.Campaign, len(a))
+	for i, item := range a {
+		list[i] = item.ToAPICampaign()
+	}
+	return list
+}
+
+type APICampaignRecipient api.CampaignRecipient
+
+func (a APICampaignRecipient) ToCampaignRecipient() *CampaignRecipient {
+	item := &CampaignRecipient{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a CampaignRecipient) ToAPICampaignRecipient() *api.CampaignRecipient {
+	item := &api.CampaignRecipient{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type CampaignRecipients []*CampaignRecipient
+
+func (a CampaignRecipients) ToAPICampaignRecipients() []*api.CampaignRecipient {
+	list := make([]*api.CampaignRecipient, len(a))
+	for i, item := range a {
+		list[i] = item.ToAPICampaignRecipient()
+	}
+	return list
+}
+
+type APIOptOut api.OptOut
+
+func (a APIOptOut) ToOptOut() *OptOut {
+	item := &OptOut{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+func (a OptOut) ToAPIOptOut() *api.OptOut {
+	item := &api.OptOut{}
+	pkg.MustCopyValue(item, &a)
+	return item
+}
+
+type OptOuts []*OptOut
+
+func (a OptOuts) ToAPIOptOuts() []*api.OptOut {
+	list := make([]*api.OptOut, len(a))
+	for i, item := range a {
+		list[i] = item.ToAPIOptOut()
+	}
+	return list
+}
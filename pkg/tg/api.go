@@ -1,9 +1,12 @@
 package tg
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net/url"
+	"strconv"
 	"strings"
 	"tgwabr/api"
 	appCtx "tgwabr/context"
@@ -33,9 +36,15 @@ func (s *Service) SendQR(mgChatID int64, code string) (msg *api.TGMessage, err e
 	return Message(response).ToAPIMessage(), nil
 }
 
-func (s *Service) SendMessage(chatID int64, text string) (msg *api.TGMessage, err error) {
+func (s *Service) SendMessage(chatID int64, text string, replyToID, threadID int) (msg *api.TGMessage, err error) {
 
+	if threadID != 0 {
+		params := topicParams(chatID, replyToID, threadID)
+		params["text"] = text
+		return s.sendTopic("sendMessage", params, threadID, "", nil)
+	}
 	req := tgbotapi.NewMessage(chatID, text)
+	req.ReplyToMessageID = replyToID
 	response, err := s.BotSend(req)
 	if err != nil {
 		return nil, err
@@ -43,13 +52,18 @@ func (s *Service) SendMessage(chatID int64, text string) (msg *api.TGMessage, er
 	return Message(response).ToAPIMessage(), nil
 }
 
-func (s *Service) SendImage(chatID int64, reader io.Reader, caption string) (msg *api.TGMessage, err error) {
+func (s *Service) SendImage(chatID int64, reader io.Reader, caption string, replyToID, threadID int) (msg *api.TGMessage, err error) {
 
-	req := tgbotapi.NewPhotoUpload(chatID, tgbotapi.FileReader{
+	file := tgbotapi.FileReader{
 		Name:   caption,
 		Reader: reader,
 		Size:   -1,
-	})
+	}
+	if threadID != 0 {
+		return s.sendTopic("sendPhoto", topicParams(chatID, replyToID, threadID), threadID, "photo", file)
+	}
+	req := tgbotapi.NewPhotoUpload(chatID, file)
+	req.ReplyToMessageID = replyToID
 	response, err := s.BotSend(req)
 	if err != nil {
 		return nil, err
@@ -57,12 +71,17 @@ func (s *Service) SendImage(chatID int64, reader io.Reader, caption string) (msg
 	return Message(response).ToAPIMessage(), nil
 }
 
-func (s *Service) SendAudio(chatID int64, reader io.Reader) (msg *api.TGMessage, err error) {
+func (s *Service) SendAudio(chatID int64, reader io.Reader, replyToID, threadID int) (msg *api.TGMessage, err error) {
 
-	req := tgbotapi.NewAudioUpload(chatID, tgbotapi.FileReader{
+	file := tgbotapi.FileReader{
 		Reader: reader,
 		Size:   -1,
-	})
+	}
+	if threadID != 0 {
+		return s.sendTopic("sendAudio", topicParams(chatID, replyToID, threadID), threadID, "audio", file)
+	}
+	req := tgbotapi.NewAudioUpload(chatID, file)
+	req.ReplyToMessageID = replyToID
 	response, err := s.BotSend(req)
 	if err != nil {
 		return nil, err
@@ -70,12 +89,17 @@ func (s *Service) SendAudio(chatID int64, reader io.Reader) (msg *api.TGMessage,
 	return Message(response).ToAPIMessage(), nil
 }
 
-func (s *Service) SendVideo(chatID int64, reader io.Reader) (msg *api.TGMessage, err error) {
+func (s *Service) SendVideo(chatID int64, reader io.Reader, replyToID, threadID int) (msg *api.TGMessage, err error) {
 
-	req := tgbotapi.NewVideoUpload(chatID, tgbotapi.FileReader{
+	file := tgbotapi.FileReader{
 		Reader: reader,
 		Size:   -1,
-	})
+	}
+	if threadID != 0 {
+		return s.sendTopic("sendVideo", topicParams(chatID, replyToID, threadID), threadID, "video", file)
+	}
+	req := tgbotapi.NewVideoUpload(chatID, file)
+	req.ReplyToMessageID = replyToID
 	response, err := s.BotSend(req)
 	if err != nil {
 		return nil, err
@@ -83,13 +107,18 @@ func (s *Service) SendVideo(chatID int64, reader io.Reader) (msg *api.TGMessage,
 	return Message(response).ToAPIMessage(), nil
 }
 
-func (s *Service) SendDocument(chatID int64, reader io.Reader, fileName string) (msg *api.TGMessage, err error) {
+func (s *Service) SendDocument(chatID int64, reader io.Reader, fileName string, replyToID, threadID int) (msg *api.TGMessage, err error) {
 
-	req := tgbotapi.NewDocumentUpload(chatID, tgbotapi.FileReader{
+	file := tgbotapi.FileReader{
 		Name:   fileName,
 		Reader: reader,
 		Size:   -1,
-	})
+	}
+	if threadID != 0 {
+		return s.sendTopic("sendDocument", topicParams(chatID, replyToID, threadID), threadID, "document", file)
+	}
+	req := tgbotapi.NewDocumentUpload(chatID, file)
+	req.ReplyToMessageID = replyToID
 	response, err := s.BotSend(req)
 	if err != nil {
 		return nil, err
@@ -97,8 +126,15 @@ func (s *Service) SendDocument(chatID int64, reader io.Reader, fileName string)
 	return Message(response).ToAPIMessage(), nil
 }
 
-func (s *Service) SendLocation(chatID int64, lat, lon float64) (msg *api.TGMessage, err error) {
+func (s *Service) SendLocation(chatID int64, lat, lon float64, replyToID, threadID int) (msg *api.TGMessage, err error) {
+	if threadID != 0 {
+		params := topicParams(chatID, replyToID, threadID)
+		params["latitude"] = strconv.FormatFloat(lat, 'f', 6, 64)
+		params["longitude"] = strconv.FormatFloat(lon, 'f', 6, 64)
+		return s.sendTopic("sendLocation", params, threadID, "", nil)
+	}
 	req := tgbotapi.NewLocation(chatID, lat, lon)
+	req.ReplyToMessageID = replyToID
 	response, err := s.BotSend(req)
 	if err != nil {
 		return nil, err
@@ -106,6 +142,80 @@ func (s *Service) SendLocation(chatID int64, lat, lon float64) (msg *api.TGMessa
 	return Message(response).ToAPIMessage(), nil
 }
 
+func (s *Service) SendContact(chatID int64, phone, name string, replyToID, threadID int) (msg *api.TGMessage, err error) {
+	if threadID != 0 {
+		params := topicParams(chatID, replyToID, threadID)
+		params["phone_number"] = phone
+		params["first_name"] = name
+		return s.sendTopic("sendContact", params, threadID, "", nil)
+	}
+	req := tgbotapi.NewContact(chatID, phone, name)
+	req.ReplyToMessageID = replyToID
+	response, err := s.BotSend(req)
+	if err != nil {
+		return nil, err
+	}
+	return Message(response).ToAPIMessage(), nil
+}
+
+// topicParams params of message sent to forum topic
+func topicParams(chatID int64, replyToID, threadID int) map[string]string {
+	params := map[string]string{
+		"chat_id":           strconv.FormatInt(chatID, 10),
+		"message_thread_id": strconv.Itoa(threadID),
+	}
+	if replyToID != 0 {
+		params["reply_to_message_id"] = strconv.Itoa(replyToID)
+	}
+	return params
+}
+
+// sendTopic send message to forum topic, the Bot API library does not know message_thread_id.
+// Files go as field of multipart upload
+func (s *Service) sendTopic(method string, params map[string]string, threadID int, field string, file interface{}) (msg *api.TGMessage, err error) {
+
+	var resp tgbotapi.APIResponse
+	if file != nil {
+		resp, err = s.bot.UploadFile(method, params, field, file)
+	} else {
+		values := url.Values{}
+		for k, v := range params {
+			values.Add(k, v)
+		}
+		resp, err = s.bot.MakeRequest(method, values)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var response tgbotapi.Message
+	if err = json.Unmarshal(resp.Result, &response); err != nil {
+		return nil, err
+	}
+	s.rememberThread(response.Chat.ID, response.MessageID, threadID)
+	return Message(response).ToAPIMessage(), nil
+}
+
+func (s *Service) ReactMessage(chatID int64, messageID int, emoji string) (err error) {
+	reaction := "[]"
+	if emoji != "" {
+		reaction = fmt.Sprintf(`[{"type":"emoji","emoji":%q}]`, emoji)
+	}
+	params := url.Values{}
+	params.Add("chat_id", strconv.FormatInt(chatID, 10))
+	params.Add("message_id", strconv.Itoa(messageID))
+	params.Add("reaction", reaction)
+	_, err = s.bot.MakeRequest("setMessageReaction", params)
+	return
+}
+
+func (s *Service) EditMessage(chatID int64, messageID int, text string, parseMode string) (err error) {
+	req := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	req.ParseMode = parseMode
+	_, err = s.bot.Send(req)
+	return
+}
+
 func (s *Service) DeleteMessage(chatID int64, messageID int) (err error) {
 	_, err = s.bot.DeleteMessage(tgbotapi.DeleteMessageConfig{
 		ChatID:    chatID,
@@ -114,6 +224,58 @@ func (s *Service) DeleteMessage(chatID int64, messageID int) (err error) {
 	return
 }
 
+// SendNewClient notify main group about new client with button to take free chat from pool and
+// offer client to operator by assign policy of main group
+func (s *Service) SendNewClient(mgChatID int64, client, name string) (msg *api.TGMessage, err error) {
+	req := tgbotapi.NewMessage(mgChatID, fmt.Sprintf("New client %s(%s)", name, client))
+	req.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Take", fmt.Sprintf("chat.take#%s", client)),
+	))
+	response, err := s.BotSend(req)
+	if err != nil {
+		return nil, err
+	}
+	s.assign(mgChatID, client, name, response.MessageID)
+	return Message(response).ToAPIMessage(), nil
+}
+
+// CreateTopic create forum topic in chat, return its message_thread_id to send messages to the topic
+func (s *Service) CreateTopic(chatID int64, name string) (threadID int, err error) {
+	params := url.Values{}
+	params.Add("chat_id", strconv.FormatInt(chatID, 10))
+	params.Add("name", name)
+	resp, err := s.bot.MakeRequest("createForumTopic", params)
+	if err != nil {
+		return 0, err
+	}
+	topic := struct {
+		MessageThreadID int `json:"message_thread_id"`
+	}{}
+	if err = json.Unmarshal(resp.Result, &topic); err != nil {
+		return 0, err
+	}
+	return topic.MessageThreadID, nil
+}
+
+// inviteLink create invite link to chat for one person, unlike exportChatInviteLink it keeps links
+// given before working
+func (s *Service) inviteLink(chatID int64) (link string, err error) {
+	params := url.Values{}
+	params.Add("chat_id", strconv.FormatInt(chatID, 10))
+	params.Add("member_limit", "1")
+	resp, err := s.bot.MakeRequest("createChatInviteLink", params)
+	if err != nil {
+		return "", err
+	}
+	invite := struct {
+		InviteLink string `json:"invite_link"`
+	}{}
+	if err = json.Unmarshal(resp.Result, &invite); err != nil {
+		return "", err
+	}
+	return invite.InviteLink, nil
+}
+
 func (s *Service) GetMembers() (members []int, err error) {
 	return []int{}, nil
 }
@@ -142,6 +304,13 @@ func (s *Service) UpdateStatMessage(chunk int) {
 			continue
 		}
 		txt := ""
+		undelivered, err := db.CountUndelivered(wac.GetID())
+		if err != nil {
+			log.Println("Error count undelivered updateStatMessage: ", err)
+		}
+		if undelivered > 0 {
+			txt = fmt.Sprintf("\n ⚠ %d undelivered", undelivered)
+		}
 		for k, i := range items {
 			if k < (chunk-1)*chunkSize {
 				continue
@@ -186,7 +355,13 @@ func (s *Service) UpdateStatMessage(chunk int) {
 			return
 		}
 
-		inlineKeyBoard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(row...))
+		rows := [][]tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardRow(row...)}
+		if undelivered > 0 {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("retry undelivered ⚠ %d", undelivered), "stat.retry"),
+			))
+		}
+		inlineKeyBoard := tgbotapi.NewInlineKeyboardMarkup(rows...)
 
 		if grp.MessagePin > 0 && txt != "" {
 			msg := tgbotapi.NewEditMessageText(v, grp.MessagePin, txt+"\n #pinstat")
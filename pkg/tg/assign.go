@@ -0,0 +1,423 @@
+package tg
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const defaultAssignTimeout = 5 * time.Minute
+
+// assign queue new client of main group to be offered to operator picked by policy of main group,
+// messageID is new client message of main group the escalation replies to. Picking operator asks
+// Telegram about members, so the outbox worker does it not to hold relay of client messages
+func (s *Service) assign(mgChatID int64, client, name string, messageID int) {
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return
+	}
+
+	mg, err := db.GetMainGroupByTGID(mgChatID)
+	if err != nil {
+		log.Println("Error get MainGroup store: ", err)
+		return
+	}
+	if mg == nil || mg.AssignPolicy == "" {
+		return
+	}
+
+	item := &api.Assignment{
+		MGID:        strconv.FormatInt(mgChatID, 10),
+		WAClient:    client,
+		Name:        name,
+		Status:      api.AssignmentNew,
+		MGMessageID: messageID,
+	}
+	if err = db.SaveAssignment(item); err != nil {
+		log.Println("Error save assignment store: ", err)
+		return
+	}
+	s.kickOutbox(mgChatID)
+}
+
+// offer new assignment to operator picked by policy of main group, close it when nobody available
+func (s *Service) offer(db api.Store, mgChatID int64, item *api.Assignment) {
+
+	mg, err := db.GetMainGroupByTGID(mgChatID)
+	if err != nil {
+		log.Println("Error get MainGroup store: ", err)
+		return
+	}
+
+	var operator *api.Operator
+	if mg != nil && mg.AssignPolicy != "" {
+		if operator, err = s.pickOperator(db, mg, item.WAClient); err != nil {
+			log.Println("Error pick operator: ", err)
+			return
+		}
+	}
+	if operator == nil {
+		item.Status = api.AssignmentClosed
+		if err = db.SaveAssignment(item); err != nil {
+			log.Println("Error save assignment store: ", err)
+		}
+		return
+	}
+
+	timeout := mg.AssignTimeout
+	if timeout <= 0 {
+		timeout = defaultAssignTimeout
+	}
+
+	item.TGUserID = operator.TGUserID
+	item.TGUserName = operator.TGUserName
+	item.Status = api.AssignmentPending
+	item.ExpiresAt = time.Now().Add(timeout)
+	if err = db.SaveAssignment(item); err != nil {
+		log.Println("Error save assignment store: ", err)
+		return
+	}
+
+	operator.LastAssignedAt = time.Now()
+	if err = db.SaveOperator(operator); err != nil {
+		log.Println("Error save operator store: ", err)
+	}
+
+	msg := tgbotapi.NewMessage(int64(operator.TGUserID), fmt.Sprintf("New client %s(%s) assigned to you, press Join within %s", item.Name, item.WAClient, timeout))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Join", fmt.Sprintf("assign.join#%d", item.ID)),
+	))
+	resp, err := s.BotSend(msg)
+	if err != nil {
+		log.Println("Error send assignment: ", err)
+		return
+	}
+	item.MessageID = resp.MessageID
+	if err = db.SaveAssignment(item); err != nil {
+		log.Println("Error save assignment store: ", err)
+	}
+}
+
+// pickOperator registered operator of main group by policy, nil when nobody available
+func (s *Service) pickOperator(db api.Store, mg *api.MainGroup, client string) (*api.Operator, error) {
+
+	operators, err := db.GetOperators()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	candidates := []*api.Operator{}
+	for _, v := range operators {
+		if v.State(now) == api.PresenceOnline && s.IsMemberMainGroup(v.TGUserID, mg.TGChatID) {
+			candidates = append(candidates, v)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	// round robin, operator waiting longest goes first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].LastAssignedAt.Before(candidates[j].LastAssignedAt)
+	})
+
+	switch mg.AssignPolicy {
+	case api.AssignLast:
+		waSvc, ok := appCtx.FromWA(s.ctx)
+		if !ok {
+			return nil, fmt.Errorf("module WhatsApp not ready")
+		}
+		wac, ok := waSvc.GetInstance(mg.TGChatID)
+		if !ok {
+			return nil, fmt.Errorf("instance WhatsApp not ready")
+		}
+		jid := wac.PrepareClientJID(client)
+		items, err := db.GetNotChatted(mg.TGChatID, s.bot.Self.UserName)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if item.WAClient != jid || item.TGUserName == "" {
+				continue
+			}
+			for _, v := range candidates {
+				if v.TGUserName == item.TGUserName {
+					return v, nil
+				}
+			}
+		}
+	case api.AssignLeastLoaded:
+		chats, err := db.GetChatsByMGID(strconv.FormatInt(mg.TGChatID, 10))
+		if err != nil {
+			return nil, err
+		}
+		load := map[string]int{}
+		for _, v := range chats {
+			load[v.TGUserName]++
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return load[candidates[i].TGUserName] < load[candidates[j].TGUserName]
+		})
+	}
+	return candidates[0], nil
+}
+
+// processAssignments offer new assignments to operators, close assignments of joined clients and
+// escalate expired ones to main group, return delay until next expiration
+func (s *Service) processAssignments(mgChatID int64) time.Duration {
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return outboxIdle
+	}
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		return outboxIdle
+	}
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		return outboxIdle
+	}
+
+	items, err := db.GetAssignmentsPending(wac.GetID())
+	if err != nil {
+		log.Println("Error get assignments store: ", err)
+		return outboxIdle
+	}
+
+	delay := outboxIdle
+	for _, item := range items {
+		chat, err := db.GetChatByClient(wac.PrepareClientJID(item.WAClient), wac.GetID())
+		if err != nil {
+			log.Println("Error get chat store: ", err)
+			continue
+		}
+
+		text := ""
+		if chat == nil && item.Status == api.AssignmentNew {
+			s.offer(db, mgChatID, item)
+			if wait := time.Until(item.ExpiresAt); item.Status == api.AssignmentPending && wait < delay {
+				delay = wait
+			}
+			continue
+		} else if chat != nil {
+			item.Status = api.AssignmentClosed
+			text = fmt.Sprintf("Client %s(%s) taken by @%s", item.Name, item.WAClient, chat.TGUserName)
+		} else if wait := time.Until(item.ExpiresAt); wait > 0 {
+			if wait < delay {
+				delay = wait
+			}
+			continue
+		} else {
+			item.Status = api.AssignmentEscalated
+			text = fmt.Sprintf("Client %s(%s) not joined in time and offered to main group", item.Name, item.WAClient)
+			// new client message with Take button is still there, point main group to it
+			msg := tgbotapi.NewMessage(mgChatID, fmt.Sprintf("@%s did not join client %s(%s) in time, anyone?", item.TGUserName, item.Name, item.WAClient))
+			msg.ReplyToMessageID = item.MGMessageID
+			_, _ = s.BotSend(msg)
+		}
+
+		if err = db.SaveAssignment(item); err != nil {
+			log.Println("Error save assignment store: ", err)
+		}
+		if item.MessageID != 0 {
+			if err = s.EditMessage(int64(item.TGUserID), item.MessageID, text, ""); err != nil {
+				log.Println("Error edit assignment message: ", err)
+			}
+		}
+	}
+	return delay
+}
+
+func (s *Service) CallbackQueryAssign(query *tgbotapi.CallbackQuery, parts []string) {
+	if len(parts) == 1 {
+		return
+	}
+	args := strings.Split(parts[1], "#")
+	if len(args) != 2 || args[0] != "join" {
+		return
+	}
+	answer := func(text string) {
+		_, _ = s.bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, text))
+	}
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		answer("Module Store not ready")
+		return
+	}
+
+	id, _ := strconv.Atoi(args[1])
+	item, err := db.GetAssignment(uint(id))
+	if err != nil {
+		answer(fmt.Sprintf("Fail join client, please send admin this error: %s", err))
+		return
+	}
+	if item == nil || item.TGUserID != query.From.ID {
+		answer("Assignment not found")
+		return
+	}
+	if item.Status != api.AssignmentPending {
+		answer("Assignment is over, client offered to main group")
+		return
+	}
+
+	mgChatID, _ := strconv.ParseInt(item.MGID, 10, 64)
+	name, link, err := s.joinFreeChat(mgChatID, item.WAClient, query.From)
+	if err != nil {
+		answer(err.Error())
+		return
+	}
+
+	item.Status = api.AssignmentAccepted
+	if err = db.SaveAssignment(item); err != nil {
+		log.Println("Error save assignment store: ", err)
+	}
+	answer("Join " + item.WAClient)
+	if err = s.EditMessage(query.Message.Chat.ID, query.Message.MessageID, fmt.Sprintf("Chat with %s(%s): %s", name, item.WAClient, link), ""); err != nil {
+		log.Println("Error edit assignment message: ", err)
+	}
+	_, _ = s.BotSend(tgbotapi.NewMessage(mgChatID, fmt.Sprintf("@%s joined assigned client %s(%s)", query.From.UserName, name, item.WAClient)))
+}
+
+// CommandStart register operator in private chat with bot to get assigned clients
+func (s *Service) CommandStart(update tgbotapi.Update) {
+
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	if !update.Message.Chat.IsPrivate() {
+		msg.Text = "Command work only in private chat with bot"
+		return
+	}
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+
+	operator, err := db.GetOperator(update.Message.From.ID)
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail register operator, please send admin this error: %s", err)
+		return
+	}
+	if operator == nil {
+		operator = &api.Operator{TGUserID: update.Message.From.ID, Presence: api.PresenceOnline, PresenceAt: time.Now()}
+	}
+	operator.TGUserName = update.Message.From.UserName
+	if err = db.SaveOperator(operator); err != nil {
+		msg.Text = fmt.Sprintf("Fail register operator, please send admin this error: %s", err)
+		return
+	}
+	msg.Text = "Hi! New clients assigned to you will come here"
+}
+
+func (s *Service) operators(db api.Store) []*api.Operator {
+	items, err := db.GetOperators()
+	if err != nil {
+		log.Println("Error get operators store: ", err)
+	}
+	return items
+}
+
+func (s *Service) CommandAssign(update tgbotapi.Update) {
+
+	chatID := update.Message.Chat.ID
+
+	msg := tgbotapi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	if !s.IsMainGroup(chatID) {
+		msg.Text = "Command work only 'Main group'"
+		return
+	}
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+
+	mg, err := db.GetMainGroupByTGID(chatID)
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get main group, please send admin this error: %s", err)
+		return
+	}
+	if mg == nil {
+		msg.Text = "MainGroup not set, please /set name first"
+		return
+	}
+
+	args := strings.Fields(strings.ToLower(update.Message.CommandArguments()))
+	if len(args) == 0 {
+		policy := mg.AssignPolicy
+		if policy == "" {
+			policy = "off"
+		}
+		timeout := mg.AssignTimeout
+		if timeout <= 0 {
+			timeout = defaultAssignTimeout
+		}
+		names := []string{}
+		for _, v := range s.operators(db) {
+			names = append(names, "@"+v.TGUserName)
+		}
+		msg.Text = fmt.Sprintf("Assign: %s, timeout %s\nOperators: %s", policy, timeout, strings.Join(names, ", "))
+		return
+	}
+
+	switch args[0] {
+	case "off":
+		mg.AssignPolicy = ""
+	case api.AssignRoundRobin, api.AssignLeastLoaded, api.AssignLast:
+		mg.AssignPolicy = args[0]
+	default:
+		msg.Text = "Unknown policy, use /assign roundrobin|leastloaded|last [timeout] or /assign off"
+		return
+	}
+	if len(args) > 1 {
+		timeout, err := time.ParseDuration(args[1])
+		if err != nil || timeout <= 0 {
+			msg.Text = fmt.Sprintf("Fail parse timeout '%s', e.g. 5m", args[1])
+			return
+		}
+		mg.AssignTimeout = timeout
+	}
+
+	member, err := s.bot.GetChatMember(tgbotapi.ChatConfigWithUser{
+		ChatID: chatID,
+		UserID: update.Message.From.ID,
+	})
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get member of main group, please send admin this error: %s", err)
+		return
+	}
+	if !(member.IsCreator() || member.IsAdministrator()) {
+		msg.Text = fmt.Sprintf("Forbbiden, only Admin or Owner")
+		return
+	}
+
+	if err = db.SaveMainGroup(mg); err != nil {
+		msg.Text = fmt.Sprintf("Fail set assign, please send admin this error: %s", err)
+		log.Println("Error save mainGroup store: ", err)
+		return
+	}
+	msg.Text = "Assign Set: OK"
+}
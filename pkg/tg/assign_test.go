@@ -0,0 +1,122 @@
+package tg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"tgwabr/api"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestService_Assign(t *testing.T) {
+	b := newTestBridge(t)
+	b.send(t, testMGChat, testAdmin, "/set dubai", "MainGroup Set: OK")
+	b.send(t, testOpChat, testOperator, "/leave", "Leave chats")
+	b.wac.AddContact("79111135901", "Olga")
+
+	operatorChat := &tgbotapi.Chat{ID: int64(testOperator.ID), Type: "private"}
+	otherChat := &tgbotapi.Chat{ID: int64(testOther.ID), Type: "private"}
+	b.send(t, testMGChat, testOperator, "/start", "Command work only in private chat with bot")
+	b.send(t, operatorChat, testOperator, "/start", "New clients assigned to you will come here")
+	b.send(t, otherChat, testOther, "/start", "New clients assigned to you will come here")
+
+	b.send(t, testMGChat, testOperator, "/assign roundrobin", "Forbbiden, only Admin or Owner")
+	b.send(t, testMGChat, testAdmin, "/assign sometimes", "Unknown policy")
+	b.send(t, testMGChat, testAdmin, "/assign roundrobin 300ms", "Assign Set: OK")
+	b.send(t, testMGChat, testAdmin, "/assign", "Assign: roundrobin, timeout 300ms\nOperators: @operator, @other")
+
+	b.srv.Reset()
+	b.wac.ReceiveText("79111135900", "Hello")
+	call, ok := b.srv.WaitCall("sendMessage", operatorChat.ID, "New client Maxim(79111135900) assigned to you", testTimeout)
+	if !ok || !strings.Contains(call.Params.Get("reply_markup"), "assign.join#1") {
+		t.Fatalf("client not assigned to operator, calls: %+v", b.srv.Calls(""))
+	}
+
+	offer := &tgbotapi.Message{MessageID: 1, Chat: operatorChat, From: &b.srv.Bot}
+	b.srv.PushCallback(offer, testOther, "assign.join#1")
+	b.srv.PushCallback(offer, testOperator, "assign.join#1")
+	if _, ok = b.srv.WaitCall("sendMessage", testMainGroup, "@operator joined assigned client Maxim(79111135900)", testTimeout); !ok {
+		t.Fatalf("assignment not accepted, calls: %+v", b.srv.Calls(""))
+	}
+	chat, err := b.db.GetChatByClient("79111135900@s.whatsapp.net", "-100")
+	if err != nil || chat == nil || chat.TGChatID != testChat || chat.TGUserName != "operator" {
+		t.Fatalf("GetChatByClient() = %+v, %v", chat, err)
+	}
+	answers := map[string]bool{}
+	for _, v := range b.srv.Calls("answerCallbackQuery") {
+		answers[v.Params.Get("text")] = true
+	}
+	if !answers["Assignment not found"] || !answers["Join 79111135900"] {
+		t.Errorf("callback answers = %v", answers)
+	}
+
+	b.srv.Reset()
+	b.wac.ReceiveText("79111135901", "Hi")
+	if _, ok = b.srv.WaitCall("sendMessage", otherChat.ID, "New client Olga(79111135901) assigned to you", testTimeout); !ok {
+		t.Fatalf("client not assigned round robin to other, calls: %+v", b.srv.Calls(""))
+	}
+	escalation, ok := b.srv.WaitCall("sendMessage", testMainGroup, "@other did not join client Olga(79111135901) in time", testTimeout)
+	if !ok {
+		t.Fatalf("assignment not escalated, calls: %+v", b.srv.Calls(""))
+	}
+	newClient := 0
+	for _, v := range b.srv.Calls("sendMessage") {
+		if v.ChatID() == testMainGroup && strings.Contains(v.Params.Get("text"), "New client Olga(79111135901)") {
+			newClient++
+			if escalation.Params.Get("reply_to_message_id") != strconv.Itoa(v.MessageID) {
+				t.Errorf("escalation reply_to_message_id = %s, want new client message %d", escalation.Params.Get("reply_to_message_id"), v.MessageID)
+			}
+		}
+	}
+	if newClient != 1 {
+		t.Errorf("new client messages in main group = %d, want 1", newClient)
+	}
+	if _, ok = b.srv.WaitCall("editMessageText", otherChat.ID, "not joined in time", testTimeout); !ok {
+		t.Errorf("assignment message not updated, calls: %+v", b.srv.Calls(""))
+	}
+	items, err := b.db.GetAssignmentsPending("-100")
+	if err != nil || len(items) != 0 {
+		t.Errorf("GetAssignmentsPending() = %+v, %v, want empty", items, err)
+	}
+}
+
+func TestService_AssignLast(t *testing.T) {
+	b := newTestBridge(t)
+	b.send(t, testMGChat, testAdmin, "/set dubai", "MainGroup Set: OK")
+	b.send(t, testOpChat, testOperator, "/leave", "Leave chats")
+
+	operatorChat := &tgbotapi.Chat{ID: int64(testOperator.ID), Type: "private"}
+	otherChat := &tgbotapi.Chat{ID: int64(testOther.ID), Type: "private"}
+	b.send(t, operatorChat, testOperator, "/start", "New clients assigned to you will come here")
+	b.send(t, otherChat, testOther, "/start", "New clients assigned to you will come here")
+	b.send(t, testMGChat, testAdmin, "/assign last", "Assign Set: OK")
+
+	// @other talked to client with longer number starting with number of new client
+	for i, chatted := range []string{api.ChattedYes, api.ChattedNo} {
+		err := b.db.SaveMessage(&api.Message{
+			MGID:        "-100",
+			WAClient:    "79111135900@s.whatsapp.net",
+			WAMessageID: fmt.Sprintf("LAST%d", i),
+			TGUserName:  "other",
+			Chatted:     chatted,
+			Direction:   api.DirectionWa2tg,
+			Text:        "Hello",
+		})
+		if err != nil {
+			t.Fatalf("SaveMessage() error = %v", err)
+		}
+	}
+
+	b.srv.Reset()
+	b.wac.ReceiveText("7911113590", "Hi")
+	if _, ok := b.srv.WaitCall("sendMessage", operatorChat.ID, "New client", testTimeout); !ok {
+		t.Fatalf("client not assigned round robin to operator, calls: %+v", b.srv.Calls(""))
+	}
+	for _, v := range b.srv.Calls("sendMessage") {
+		if v.ChatID() == otherChat.ID {
+			t.Errorf("client assigned to last operator of other client: %+v", v)
+		}
+	}
+}
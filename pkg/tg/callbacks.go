@@ -1,9 +1,11 @@
 package tg
 
 import (
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
+	appCtx "tgwabr/context"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
@@ -19,6 +21,9 @@ func (s *Service) CallbackQueryStat(query *tgbotapi.CallbackQuery, parts []strin
 	chunk := 0
 	if len(args) == 1 && args[0] == "refresh" {
 		chunk = 1
+	} else if len(args) == 1 && args[0] == "retry" {
+		chunk = 1
+		s.retryUndelivered(query.Message.Chat.ID)
 	} else if len(args) == 2 && args[0] == "get" {
 		chunk, err = strconv.Atoi(args[1])
 		if err != nil {
@@ -48,6 +53,10 @@ func (s *Service) CallbackQueryChat(update tgbotapi.Update, parts []string) {
 		return
 	}
 	args := strings.Split(parts[1], "#")
+	if len(args) == 2 && args[0] == "take" {
+		s.takeChat(update.CallbackQuery, args[1])
+		return
+	}
 	if args[0] != "join" {
 		return
 	}
@@ -56,3 +65,89 @@ func (s *Service) CallbackQueryChat(update tgbotapi.Update, parts []string) {
 	_, _ = s.bot.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, "Join "+args[1]))
 	s.CommandJoin(tgbotapi.Update{Message: msg}, args[1], args[2])
 }
+
+// takeChat join free chat from pool to client of main group and invite operator to it
+func (s *Service) takeChat(query *tgbotapi.CallbackQuery, client string) {
+
+	mgChatID := query.Message.Chat.ID
+	if !s.IsMainGroup(mgChatID) {
+		return
+	}
+
+	name, link, err := s.joinFreeChat(mgChatID, client, query.From)
+	if err != nil {
+		_, _ = s.bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, err.Error()))
+		return
+	}
+
+	if err = s.EditMessage(mgChatID, query.Message.MessageID, fmt.Sprintf("New client %s(%s), taken by @%s", name, client, query.From.UserName), ""); err != nil {
+		log.Println("Error edit new client message: ", err)
+	}
+	msg := tgbotapi.NewMessage(mgChatID, fmt.Sprintf("@%s chat with %s(%s): %s", query.From.UserName, name, client, link))
+	msg.ReplyToMessageID = query.Message.MessageID
+	_, _ = s.BotSend(msg)
+	_, _ = s.bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Take "+client))
+}
+
+// joinFreeChat join free chat from pool to client of main group for user, return client name and
+// invite link to the chat, error text is ready to show to user
+func (s *Service) joinFreeChat(mgChatID int64, client string, from *tgbotapi.User) (name, link string, err error) {
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return "", "", fmt.Errorf("Module Store not ready")
+	}
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		return "", "", fmt.Errorf("Module WhatsApp not ready")
+	}
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		return "", "", fmt.Errorf("Instance WhatsApp not ready")
+	}
+
+	jid := wac.PrepareClientJID(client)
+	chat, err := db.GetChatByClient(jid, wac.GetID())
+	if err != nil {
+		return "", "", fmt.Errorf("Fail take client, please send admin this error: %s", err)
+	}
+	if chat != nil {
+		return "", "", fmt.Errorf("Client already taken by @%s", chat.TGUserName)
+	}
+
+	mgName := ""
+	mg, err := db.GetMainGroupByTGID(mgChatID)
+	if err != nil {
+		log.Println("Error get MainGroup store: ", err)
+	} else if mg != nil {
+		mgName = mg.Name
+	}
+
+	free, err := db.TakeFreeChat(wac.GetID())
+	if err != nil {
+		return "", "", fmt.Errorf("Fail take client, please send admin this error: %s", err)
+	}
+	if free == nil {
+		return "", "", fmt.Errorf("No free chats, add bot to new group and /leave it there")
+	}
+
+	s.CommandJoin(tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: free.TGChatID, Title: free.Title},
+		From: from,
+	}}, client, mgName)
+
+	chat, err = db.GetChatByClient(jid, wac.GetID())
+	if err != nil || chat == nil || chat.TGChatID != free.TGChatID {
+		if err = db.SaveFreeChat(free); err != nil {
+			log.Println("Error save free chat store: ", err)
+		}
+		return "", "", fmt.Errorf("Fail take client, see free chat for details")
+	}
+
+	link, err = s.inviteLink(free.TGChatID)
+	if err != nil {
+		log.Println("Error get invite link: ", err)
+		link = "invite link not available, please ask admin"
+	}
+	return wac.GetClientName(jid), link, nil
+}
@@ -0,0 +1,90 @@
+package tg
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestService_CallbackJoin(t *testing.T) {
+	b := newTestBridge(t)
+	b.send(t, testMGChat, testAdmin, "/set dubai", "MainGroup Set: OK")
+
+	msg := &tgbotapi.Message{MessageID: 1, Chat: testOpChat, From: &b.srv.Bot}
+	b.srv.Reset()
+	b.srv.PushCallback(msg, testOperator, "chat.join#79111135900#dubai")
+	if _, ok := b.srv.WaitCall("sendMessage", testChat, "Join 'Maxim(79111135900)' OK", testTimeout); !ok {
+		t.Fatalf("callback chat.join not joined, calls: %+v", b.srv.Calls(""))
+	}
+	if len(b.srv.Calls("answerCallbackQuery")) != 1 {
+		t.Errorf("callback not answered")
+	}
+}
+
+func TestService_TakeFreeChat(t *testing.T) {
+	b := newTestBridge(t)
+	b.send(t, testMGChat, testAdmin, "/set dubai", "MainGroup Set: OK")
+	b.send(t, testOpChat, testOperator, "/leave", "Leave chats")
+
+	b.srv.Reset()
+	b.wac.ReceiveText("79111135900", "Hello")
+	call, ok := b.srv.WaitCall("sendMessage", testMainGroup, "New client Maxim(79111135900)", testTimeout)
+	if !ok || !strings.Contains(call.Params.Get("reply_markup"), "chat.take#79111135900") {
+		t.Fatalf("new client not offered, calls: %+v", b.srv.Calls(""))
+	}
+	b.wac.ReceiveText("79111135900", "Anybody?")
+	if _, ok = b.srv.WaitCall("sendMessage", testMainGroup, "Anybody?", testTimeout); !ok {
+		t.Fatalf("second message not relayed, calls: %+v", b.srv.Calls(""))
+	}
+	offers := 0
+	for _, v := range b.srv.Calls("sendMessage") {
+		if strings.HasPrefix(v.Params.Get("text"), "New client") {
+			offers++
+		}
+	}
+	if offers != 1 {
+		t.Errorf("new client offered %d times, want once", offers)
+	}
+
+	offer := &tgbotapi.Message{MessageID: 1, Chat: testMGChat, From: &b.srv.Bot}
+	take := func(want string) {
+		t.Helper()
+		b.srv.Reset()
+		b.srv.PushCallback(offer, testOperator, "chat.take#79111135900")
+		deadline := time.Now().Add(testTimeout)
+		for time.Now().Before(deadline) {
+			for _, v := range b.srv.Calls("answerCallbackQuery") {
+				if strings.Contains(v.Params.Get("text"), want) {
+					return
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("take: no answer %q, calls: %+v", want, b.srv.Calls(""))
+	}
+
+	take("Take 79111135900")
+	if _, ok = b.srv.WaitCall("sendMessage", testMainGroup, "@operator chat with Maxim(79111135900): https://t.me/+-200-", testTimeout); !ok {
+		t.Errorf("invite link not sent, calls: %+v", b.srv.Calls(""))
+	}
+	if got := b.srv.Calls("createChatInviteLink"); len(got) != 1 || got[0].Params.Get("member_limit") != "1" {
+		t.Errorf("createChatInviteLink calls = %+v, want one link for one member", got)
+	}
+	if got := b.srv.Calls("exportChatInviteLink"); len(got) != 0 {
+		t.Errorf("exportChatInviteLink calls = %+v, want primary link kept", got)
+	}
+	chat, err := b.db.GetChatByClient("79111135900@s.whatsapp.net", "-100")
+	if err != nil || chat == nil || chat.TGChatID != testChat || chat.TGUserName != "operator" {
+		t.Fatalf("GetChatByClient() = %+v, %v", chat, err)
+	}
+
+	take("Client already taken by @operator")
+
+	b.send(t, testOpChat, testOperator, "/leave", "Leave chats")
+	b.send(t, testOpChat, testOperator, "/join +7(911) 113-59-00", "Join 'Maxim(79111135900)' OK")
+	if free, err := b.db.TakeFreeChat("-100"); free != nil || err != nil {
+		t.Errorf("TakeFreeChat() after join = %+v, %v, want empty pool", free, err)
+	}
+}
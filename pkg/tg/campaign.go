@@ -0,0 +1,404 @@
+package tg
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"tgwabr/pkg/wa/bridge"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// defaultCampaignInterval pause between messages of campaign, WhatsApp bans accounts sending too fast
+const defaultCampaignInterval = 5 * time.Second
+
+// processCampaigns send next message of running campaigns, one per interval, while WhatsApp is connected,
+// return delay until next send
+func (s *Service) processCampaigns(mgChatID int64) time.Duration {
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return outboxIdle
+	}
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		return outboxIdle
+	}
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		return outboxIdle
+	}
+
+	items, err := db.GetCampaigns(wac.GetID())
+	if err != nil {
+		log.Println("Error get campaigns store: ", err)
+		return s.outboxConfig.min
+	}
+
+	delay := outboxIdle
+	var optOuts map[string]bool
+	for _, item := range items {
+		if item.Status != api.CampaignRunning {
+			continue
+		}
+		if wac.GetConnectionState().State != api.ConnectionConnected {
+			return s.outboxConfig.min
+		}
+		if wait := time.Until(item.NextAt); wait > 0 {
+			if wait < delay {
+				delay = wait
+			}
+			continue
+		}
+		if optOuts == nil {
+			if optOuts, err = s.optOuts(db, wac.GetID()); err != nil {
+				log.Println("Error get opt-outs store: ", err)
+				return s.outboxConfig.min
+			}
+		}
+
+		left := s.sendCampaign(db, wac, item, optOuts)
+
+		// campaign may be paused or canceled while sending
+		if current, err := db.GetCampaign(item.ID); err != nil {
+			log.Println("Error get campaign store: ", err)
+		} else if current != nil {
+			item = current
+		}
+		if !left && item.Status == api.CampaignRunning {
+			item.Status = api.CampaignDone
+		}
+		item.NextAt = time.Now().Add(s.outboxConfig.campaign)
+		if err = db.SaveCampaign(item); err != nil {
+			log.Println("Error save campaign store: ", err)
+		}
+		s.updateCampaign(db, mgChatID, item)
+		if item.Status == api.CampaignDone {
+			_, _ = s.BotSend(tgbotapi.NewMessage(mgChatID, fmt.Sprintf("📣 Campaign #%d done by @%s", item.ID, item.TGUserName)))
+			continue
+		}
+		if s.outboxConfig.campaign < delay {
+			delay = s.outboxConfig.campaign
+		}
+	}
+	return delay
+}
+
+// sendCampaign send campaign to next pending recipient skipping opted out ones, return false when nobody left
+func (s *Service) sendCampaign(db api.Store, wac api.WAInstance, item *api.Campaign, optOuts map[string]bool) bool {
+	for {
+		next, err := db.GetCampaignRecipientNext(item.ID)
+		if err != nil {
+			log.Println("Error get campaign recipient store: ", err)
+			return true
+		}
+		if next == nil {
+			return false
+		}
+
+		if optOuts[next.WAClient] {
+			next.Status = api.RecipientOptOut
+		} else if resp, err := wac.SendMessage(next.WAClient, item.Text, "", ""); err != nil {
+			log.Println("Error send campaign message: ", err)
+			next.Status = api.RecipientFailed
+			next.Error = err.Error()
+		} else {
+			next.Status = api.RecipientSent
+			next.WAMessageID = resp.MessageID
+		}
+		if err = db.SaveCampaignRecipient(next); err != nil {
+			log.Println("Error save campaign recipient store: ", err)
+			return true
+		}
+		if next.Status != api.RecipientOptOut {
+			return true
+		}
+	}
+}
+
+// updateCampaign show progress of campaign in its main group message
+func (s *Service) updateCampaign(db api.Store, mgChatID int64, item *api.Campaign) {
+	if item.MessageID == 0 {
+		return
+	}
+	if err := s.EditMessage(mgChatID, item.MessageID, s.campaignProgress(db, item), ""); err != nil {
+		log.Println("Error edit campaign message: ", err)
+	}
+}
+
+func (s *Service) campaignProgress(db api.Store, item *api.Campaign) string {
+	recipients, err := db.GetCampaignRecipients(item.ID)
+	if err != nil {
+		log.Println("Error get campaign recipients store: ", err)
+	}
+	counts := map[string]int{}
+	for _, v := range recipients {
+		counts[v.Status]++
+	}
+	return fmt.Sprintf("📣 Campaign #%d %s, %s: %d/%d sent, %d failed, %d opted out",
+		item.ID, item.Status, item.Segment, counts[api.RecipientSent], len(recipients), counts[api.RecipientFailed], counts[api.RecipientOptOut])
+}
+
+func (s *Service) optOuts(db api.Store, mgID string) (map[string]bool, error) {
+	items, err := db.GetOptOuts(mgID)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]bool{}
+	for _, v := range items {
+		res[v.WAClient] = true
+	}
+	return res, nil
+}
+
+// campaignClients clients of segment with tags in name, contact or alias, return also count of opted out ones
+func (s *Service) campaignClients(db api.Store, wac api.WAInstance, segment *api.Segment) (clients []string, optedOut int, err error) {
+
+	items, err := db.GetClients(wac.GetID(), segment.Since)
+	if err != nil {
+		return nil, 0, err
+	}
+	optOuts, err := s.optOuts(db, wac.GetID())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, client := range items {
+		if len(segment.Tags) > 0 {
+			names := []string{wac.GetClientName(client)}
+			aliases, err := db.GetAliasesByWAClient(client)
+			if err != nil {
+				return nil, 0, err
+			}
+			for _, v := range aliases {
+				if v.MGID == wac.GetID() {
+					names = append(names, v.Name)
+				}
+			}
+			contacts, err := db.GetContactsByWAClient(client)
+			if err != nil {
+				return nil, 0, err
+			}
+			for _, v := range contacts {
+				names = append(names, v.Name, v.ShortName)
+			}
+			if !segment.Match(strings.Join(names, " ")) {
+				continue
+			}
+		}
+		if optOuts[client] {
+			optedOut++
+			continue
+		}
+		clients = append(clients, client)
+	}
+	return clients, optedOut, nil
+}
+
+// CommandCampaign broadcast text to segment of clients of main group, e.g. /campaign preview active 30d tag vip,
+// /campaign new active 30d tag vip; Text, /campaign start 1, /campaign pause 1, /campaign cancel 1, /campaign optout STOP
+func (s *Service) CommandCampaign(update tgbotapi.Update) {
+
+	chatID := update.Message.Chat.ID
+
+	msg := tgbotapi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	if !s.IsMainGroup(chatID) {
+		msg.Text = "Command work only 'Main group'"
+		return
+	}
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		msg.Text = "Module WhatsApp not ready"
+		return
+	}
+	wac, ok := waSvc.GetInstance(chatID)
+	if !ok {
+		msg.Text = "Instance WhatsApp not ready"
+		return
+	}
+
+	args := strings.SplitN(strings.TrimSpace(update.Message.CommandArguments()), " ", 2)
+	action, rest := strings.ToLower(args[0]), ""
+	if len(args) > 1 {
+		rest = strings.TrimSpace(args[1])
+	}
+
+	if action != "" && action != "preview" && !(action == "optout" && rest == "") {
+		member, err := s.bot.GetChatMember(tgbotapi.ChatConfigWithUser{
+			ChatID: chatID,
+			UserID: update.Message.From.ID,
+		})
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get member of main group, please send admin this error: %s", err)
+			return
+		}
+		if !(member.IsCreator() || member.IsAdministrator()) {
+			msg.Text = fmt.Sprintf("Forbbiden, only Admin or Owner")
+			return
+		}
+	}
+
+	switch action {
+	case "":
+		items, err := db.GetCampaigns(wac.GetID())
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get campaigns, please send admin this error: %s", err)
+			return
+		}
+		if len(items) == 0 {
+			msg.Text = "No campaigns, e.g. /campaign preview active 30d tag vip, then /campaign new active 30d tag vip; Text"
+			return
+		}
+		lines := []string{}
+		for _, v := range items {
+			lines = append(lines, s.campaignProgress(db, v))
+		}
+		msg.Text = strings.Join(lines, "\n")
+	case "preview", "new":
+		parts := strings.SplitN(rest, ";", 2)
+		text := ""
+		if len(parts) == 2 {
+			text = strings.TrimSpace(parts[1])
+		}
+		if action == "new" && text == "" {
+			msg.Text = "Segment and text required, e.g. /campaign new active 30d tag vip; Text"
+			return
+		}
+		spec := strings.Join(strings.Fields(strings.ToLower(parts[0])), " ")
+		segment, err := api.ParseSegment(spec, time.Now())
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail parse segment: %s", err)
+			return
+		}
+		clients, optedOut, err := s.campaignClients(db, wac, segment)
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get clients, please send admin this error: %s", err)
+			return
+		}
+		if action == "preview" {
+			msg.Text = fmt.Sprintf("Segment '%s': %d recipients, %d opted out", spec, len(clients), optedOut)
+			return
+		}
+		if len(clients) == 0 {
+			msg.Text = fmt.Sprintf("Segment '%s' has no recipients", spec)
+			return
+		}
+
+		item := &api.Campaign{
+			MGID:       wac.GetID(),
+			Segment:    spec,
+			Text:       text,
+			TGUserName: update.Message.From.UserName,
+			Status:     api.CampaignDraft,
+		}
+		if err = db.SaveCampaign(item); err != nil {
+			msg.Text = fmt.Sprintf("Fail save campaign, please send admin this error: %s", err)
+			return
+		}
+		for _, v := range clients {
+			if err = db.SaveCampaignRecipient(&api.CampaignRecipient{CampaignID: item.ID, WAClient: v, Status: api.RecipientPending}); err != nil {
+				msg.Text = fmt.Sprintf("Fail save campaign recipients, please send admin this error: %s", err)
+				return
+			}
+		}
+		msg.Text = fmt.Sprintf("Campaign #%d draft: %d recipients, %d opted out, start with /campaign start %d", item.ID, len(clients), optedOut, item.ID)
+	case "start", "pause", "cancel":
+		id, err := strconv.Atoi(strings.TrimPrefix(rest, "#"))
+		if err != nil {
+			msg.Text = fmt.Sprintf("Use /campaign %s <number>, e.g. /campaign %s 1", action, action)
+			return
+		}
+		item, err := db.GetCampaign(uint(id))
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get campaign, please send admin this error: %s", err)
+			return
+		}
+		if item == nil || item.MGID != wac.GetID() {
+			msg.Text = fmt.Sprintf("Campaign #%d not found", id)
+			return
+		}
+
+		switch {
+		case action == "start" && (item.Status == api.CampaignDraft || item.Status == api.CampaignPaused):
+			item.Status = api.CampaignRunning
+		case action == "pause" && item.Status == api.CampaignRunning:
+			item.Status = api.CampaignPaused
+		case action == "cancel" && item.Status != api.CampaignDone && item.Status != api.CampaignCanceled:
+			item.Status = api.CampaignCanceled
+		default:
+			msg.Text = fmt.Sprintf("Campaign #%d is %s", item.ID, item.Status)
+			return
+		}
+		if item.MessageID == 0 {
+			resp, err := s.BotSend(tgbotapi.NewMessage(chatID, s.campaignProgress(db, item)))
+			if err != nil {
+				msg.Text = fmt.Sprintf("Fail send campaign progress, please send admin this error: %s", err)
+				return
+			}
+			item.MessageID = resp.MessageID
+		} else {
+			s.updateCampaign(db, chatID, item)
+		}
+		if err = db.SaveCampaign(item); err != nil {
+			msg.Text = fmt.Sprintf("Fail save campaign, please send admin this error: %s", err)
+			return
+		}
+		msg.Text = fmt.Sprintf("Campaign #%d %s", item.ID, item.Status)
+		s.kickOutbox(chatID)
+	case "optout":
+		mg, err := db.GetMainGroupByTGID(chatID)
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get main group, please send admin this error: %s", err)
+			return
+		}
+		if mg == nil {
+			msg.Text = "MainGroup not set, please /set name first"
+			return
+		}
+		if rest == "" {
+			keyword := bridge.OptOutKeyword(mg)
+			if keyword == "" {
+				keyword = "off"
+			}
+			items, err := db.GetOptOuts(wac.GetID())
+			if err != nil {
+				msg.Text = fmt.Sprintf("Fail get opt-outs, please send admin this error: %s", err)
+				return
+			}
+			msg.Text = fmt.Sprintf("Opt-out keyword: %s, opted out clients: %d", keyword, len(items))
+			return
+		}
+		if len(strings.Fields(rest)) != 1 {
+			msg.Text = "Use /campaign optout STOP to set keyword, /campaign optout - to disable it"
+			return
+		}
+		mg.OptOutKeyword = rest
+		if rest == "-" {
+			mg.OptOutKeyword = ""
+		}
+		if err = db.SaveMainGroup(mg); err != nil {
+			msg.Text = fmt.Sprintf("Fail set opt-out keyword, please send admin this error: %s", err)
+			log.Println("Error save mainGroup store: ", err)
+			return
+		}
+		msg.Text = "Opt-out keyword Set: OK"
+	default:
+		msg.Text = "Unknown action, use /campaign, /campaign preview, new, start, pause, cancel or optout"
+	}
+}
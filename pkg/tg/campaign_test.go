@@ -0,0 +1,60 @@
+package tg
+
+import (
+	"testing"
+)
+
+func TestService_Campaign(t *testing.T) {
+	t.Setenv("CAMPAIGN_INTERVAL", "10ms")
+	b := newTestBridge(t)
+	b.send(t, testMGChat, testAdmin, "/set dubai", "MainGroup Set: OK")
+
+	b.wac.AddContact("79111135901", "Anna VIP")
+	b.wac.AddContact("79111135902", "Oleg VIP")
+	for _, v := range []string{"79111135900", "79111135901", "79111135902"} {
+		b.wac.ReceiveText(v, "Hi")
+	}
+	// keyword is off until admin sets it
+	b.wac.ReceiveText("79111135902", "STOP")
+	b.send(t, testMGChat, testOperator, "/campaign optout", "Opt-out keyword: off, opted out clients: 0")
+	b.send(t, testMGChat, testOperator, "/campaign optout STOP", "Forbbiden, only Admin or Owner")
+	b.send(t, testMGChat, testAdmin, "/campaign optout STOP", "Opt-out keyword Set: OK")
+
+	b.wac.ReceiveText("79111135902", " stop ")
+	if last := b.wac.LastSent(); last == nil || last.Text != "You are unsubscribed from our campaigns" {
+		t.Fatalf("opt-out confirmation = %+v", last)
+	}
+	sent := len(b.wac.Sent())
+	b.wac.ReceiveText("79111135902", "STOP")
+	if got := len(b.wac.Sent()); got != sent {
+		t.Errorf("opt-out confirmed again, sent = %d, want %d", got, sent)
+	}
+
+	b.send(t, testMGChat, testOperator, "/campaign", "No campaigns")
+	b.send(t, testMGChat, testOperator, "/campaign preview tag vip", "Segment 'tag vip': 1 recipients, 1 opted out")
+	b.send(t, testMGChat, testOperator, "/campaign preview active soon", "Fail parse segment")
+	b.send(t, testMGChat, testOperator, "/campaign new all; Sale -20%", "Forbbiden, only Admin or Owner")
+	b.send(t, testMGChat, testAdmin, "/campaign new all", "Segment and text required")
+	b.send(t, testMGChat, testAdmin, "/campaign new all; Sale -20%", "Campaign #1 draft: 2 recipients, 1 opted out")
+
+	// opted out after draft is skipped at send
+	b.wac.ReceiveText("79111135901", "STOP")
+	b.send(t, testMGChat, testAdmin, "/campaign start 1", "Campaign #1 running")
+	if _, ok := b.srv.WaitCall("sendMessage", testMainGroup, "📣 Campaign #1 done by @admin", testTimeout); !ok {
+		t.Fatalf("campaign not done, calls: %+v", b.srv.Calls(""))
+	}
+	clients := []string{}
+	for _, v := range b.wac.Sent() {
+		if v.Text == "Sale -20%" {
+			clients = append(clients, v.Client)
+		}
+	}
+	if len(clients) != 1 || clients[0] != "79111135900@s.whatsapp.net" {
+		t.Errorf("campaign sent to %v, want only not opted out client", clients)
+	}
+
+	b.send(t, testMGChat, testOperator, "/campaign", "📣 Campaign #1 done, all: 1/2 sent, 0 failed, 1 opted out")
+	b.send(t, testMGChat, testAdmin, "/campaign start 1", "Campaign #1 is done")
+	b.send(t, testMGChat, testAdmin, "/campaign optout -", "Opt-out keyword Set: OK")
+	b.send(t, testMGChat, testOperator, "/campaign optout", "Opt-out keyword: off, opted out clients: 2")
+}
@@ -0,0 +1,311 @@
+package tg
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"text/template"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// cannedKeyMax max length of canned response key in bytes, callback data "canned.send#<key>" of /r keyboard
+// must fit 64 bytes
+const cannedKeyMax = 32
+
+// CannedVars variables of canned response template, e.g. "Hi {{.Client}}, I am {{.Operator}} from {{.MainGroup}}"
+type CannedVars struct {
+	Client       string
+	Phone        string
+	Operator     string
+	OperatorUser string
+	MainGroup    string
+}
+
+// CommandCanned manage canned responses of main group: /canned [list], /canned add <key> <text>, /canned del <key>
+func (s *Service) CommandCanned(update tgbotapi.Update) {
+	chatID := update.Message.Chat.ID
+
+	msg := tgbotapi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	if !s.IsMainGroup(chatID) {
+		msg.Text = "Command work only 'Main group'"
+		return
+	}
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+
+	mgID := strconv.FormatInt(chatID, 10)
+	action, key, text := cannedArgs(update.Message.CommandArguments())
+	if action == "add" || action == "del" {
+		member, err := s.bot.GetChatMember(tgbotapi.ChatConfigWithUser{
+			ChatID: chatID,
+			UserID: update.Message.From.ID,
+		})
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get member of main group, please send admin this error: %s", err)
+			return
+		}
+		if !(member.IsCreator() || member.IsAdministrator()) {
+			msg.Text = fmt.Sprintf("Forbbiden, only Admin or Owner")
+			return
+		}
+	}
+	switch action {
+	case "", "list":
+		items, err := db.GetCannedResponses(mgID)
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get canned responses, please send admin this error: %s", err)
+			return
+		}
+		if len(items) == 0 {
+			msg.Text = "Canned responses not set, e.g. /canned add hi Hello {{.Client}}, I am {{.Operator}} from {{.MainGroup}}"
+			return
+		}
+		builder := strings.Builder{}
+		builder.WriteString("Canned responses, send in chat with /r <key>:\n")
+		for _, v := range items {
+			builder.WriteString(fmt.Sprintf("%s: %s\n", v.Key, v.Text))
+		}
+		msg.Text = builder.String()
+	case "add":
+		if key == "" || text == "" {
+			msg.Text = "Key and text required, e.g. /canned add hi Hello {{.Client}}, I am {{.Operator}} from {{.MainGroup}}"
+			return
+		}
+		if len(key) > cannedKeyMax {
+			msg.Text = fmt.Sprintf("Key '%s' too long, max %d bytes", key, cannedKeyMax)
+			return
+		}
+		if _, err := template.New(key).Parse(text); err != nil {
+			msg.Text = fmt.Sprintf("Fail parse canned response: %s", err)
+			return
+		}
+		if err := db.SaveCanned(&api.Canned{MGID: mgID, Key: key, Text: text}); err != nil {
+			msg.Text = fmt.Sprintf("Fail save canned response, please send admin this error: %s", err)
+			return
+		}
+		msg.Text = fmt.Sprintf("Canned response '%s' saved", key)
+	case "del":
+		if key == "" {
+			msg.Text = "Key required, e.g. /canned del hi"
+			return
+		}
+		ok, err := db.DeleteCanned(mgID, key)
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail delete canned response, please send admin this error: %s", err)
+			return
+		}
+		if !ok {
+			msg.Text = fmt.Sprintf("Canned response '%s' not found", key)
+			return
+		}
+		msg.Text = fmt.Sprintf("Canned response '%s' deleted", key)
+	default:
+		msg.Text = "Unknown action, use /canned, /canned add <key> <text> or /canned del <key>"
+	}
+}
+
+// cannedArgs split arguments to action, lower case key and text keeping its new lines
+func cannedArgs(args string) (action, key, text string) {
+	rest := strings.TrimSpace(args)
+	next := func() string {
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			end = len(rest)
+		}
+		word := rest[:end]
+		rest = strings.TrimSpace(rest[end:])
+		return strings.ToLower(word)
+	}
+	action = next()
+	key = next()
+	return action, key, rest
+}
+
+// CommandCannedReply send canned response by key to client of joined chat, without key show keyboard of keys
+func (s *Service) CommandCannedReply(update tgbotapi.Update) {
+
+	chatID := update.Message.Chat.ID
+
+	msg := tgbotapi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+
+	chat, replyTo := s.joinedChat(db, update.Message)
+	if chat == nil {
+		msg.Text = "Chat not joined!"
+		return
+	}
+	msg.ReplyToMessageID = replyTo
+
+	key := strings.ToLower(strings.TrimSpace(update.Message.CommandArguments()))
+	if key != "" {
+		if text := s.sendCanned(db, chat, update.Message, key, 0); text != "" {
+			msg.Text = text
+		}
+		return
+	}
+
+	items, err := db.GetCannedResponses(chat.MGID)
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get canned responses, please send admin this error: %s", err)
+		return
+	}
+	if len(items) == 0 {
+		msg.Text = "Canned responses not set, add them in main group with /canned add"
+		return
+	}
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, v := range items {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(v.Key, fmt.Sprintf("canned.send#%s", v.Key)))
+	}
+	msg.Text = "Choose canned response"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(s.chunkedInlineButtons(buttons, 4)...)
+}
+
+// CallbackQueryCanned send canned response chosen on keyboard of /r
+func (s *Service) CallbackQueryCanned(query *tgbotapi.CallbackQuery, parts []string) {
+	if len(parts) == 1 {
+		return
+	}
+	args := strings.SplitN(parts[1], "#", 2)
+	if len(args) != 2 || args[0] != "send" {
+		return
+	}
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		_, _ = s.bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Module Store not ready"))
+		return
+	}
+
+	message := *query.Message
+	message.From = query.From
+	chat, _ := s.joinedChat(db, &message)
+	if chat == nil {
+		_, _ = s.bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Chat not joined!"))
+		return
+	}
+
+	// keyboard message becomes the sent response
+	if text := s.sendCanned(db, chat, &message, args[1], message.MessageID); text != "" {
+		_, _ = s.bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, text))
+		return
+	}
+	_, _ = s.bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "Sent "+args[1]))
+}
+
+// joinedChat joined chat of message and message to reply to in forum topics mode, the reply lands in the topic
+func (s *Service) joinedChat(db api.Store, message *tgbotapi.Message) (*api.Chat, int) {
+	if s.IsMainGroup(message.Chat.ID) {
+		chat := s.topicChat(tgbotapi.Update{Message: message})
+		if chat == nil {
+			return nil, 0
+		}
+		return chat, message.MessageID
+	}
+	chats, err := db.GetChatsByChatID(message.Chat.ID)
+	if err != nil {
+		log.Println("Error get chats store: ", err)
+		return nil, 0
+	}
+	if len(chats) == 0 {
+		return nil, 0
+	}
+	return chats[0], 0
+}
+
+// sendCanned render canned response and send it to client through HandleTextMessage like typed by operator,
+// text is posted to chat or replaces keyboard message editID, return error text for operator
+func (s *Service) sendCanned(db api.Store, chat *api.Chat, message *tgbotapi.Message, key string, editID int) string {
+
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		return "Module WhatsApp not ready"
+	}
+	mgChatID, _ := strconv.ParseInt(chat.MGID, 10, 64)
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		return "Instance WhatsApp not ready"
+	}
+
+	canned, err := db.GetCanned(chat.MGID, key)
+	if err != nil {
+		return fmt.Sprintf("Fail get canned response, please send admin this error: %s", err)
+	}
+	if canned == nil {
+		return fmt.Sprintf("Canned response '%s' not found", key)
+	}
+
+	vars := CannedVars{
+		Client:       wac.GetClientName(chat.WAClient),
+		Phone:        wac.GetShortClient(chat.WAClient),
+		Operator:     message.From.FirstName,
+		OperatorUser: message.From.UserName,
+	}
+	if vars.Operator == "" {
+		vars.Operator = message.From.UserName
+	}
+	mg, err := db.GetMainGroupByTGID(mgChatID)
+	if err != nil {
+		log.Println("Error get MainGroup store: ", err)
+	} else if mg != nil {
+		vars.MainGroup = mg.Name
+	}
+
+	tmpl, err := template.New(key).Parse(canned.Text)
+	if err != nil {
+		return fmt.Sprintf("Fail parse canned response: %s", err)
+	}
+	buf := &bytes.Buffer{}
+	if err = tmpl.Execute(buf, vars); err != nil {
+		return fmt.Sprintf("Fail render canned response: %s", err)
+	}
+	text := strings.TrimSpace(buf.String())
+	if text == "" {
+		return fmt.Sprintf("Canned response '%s' is empty", key)
+	}
+
+	posted := *message
+	if editID != 0 {
+		if err = s.EditMessage(message.Chat.ID, editID, text, ""); err != nil {
+			return fmt.Sprintf("Fail send canned response, please send admin this error: %s", err)
+		}
+		posted.MessageID = editID
+	} else {
+		resp, err := s.SendMessage(message.Chat.ID, text, 0, s.messageThread(message))
+		if err != nil {
+			return fmt.Sprintf("Fail send canned response, please send admin this error: %s", err)
+		}
+		posted.MessageID = resp.MessageID
+		posted.Date = resp.Timestamp
+	}
+	posted.Text = text
+	posted.Entities = nil
+	s.HandleTextMessage(tgbotapi.Update{Message: &posted})
+	return ""
+}
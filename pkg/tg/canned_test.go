@@ -0,0 +1,52 @@
+package tg
+
+import (
+	"strings"
+	"testing"
+	"tgwabr/api"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestService_Canned(t *testing.T) {
+	b := newTestBridge(t)
+	b.join(t)
+
+	b.send(t, testOpChat, testOperator, "/r", "Canned responses not set")
+	b.send(t, testMGChat, testOperator, "/canned add hi Hello", "Forbbiden, only Admin or Owner")
+	b.send(t, testMGChat, testAdmin, "/canned add bad {{.Nope", "Fail parse canned response")
+	b.send(t, testMGChat, testAdmin, "/canned add "+strings.Repeat("я", 17)+" Hello", "too long, max 32 bytes")
+	b.send(t, testMGChat, testAdmin, "/canned add HI Hello {{.Client}}, I am {{.Operator}} from {{.MainGroup}}", "Canned response 'hi' saved")
+	b.send(t, testMGChat, testAdmin, "/canned add price Price for {{.Phone}}\nis 10$", "Canned response 'price' saved")
+	b.send(t, testMGChat, testOperator, "/canned", "hi: Hello {{.Client}}")
+	b.send(t, testOpChat, testOperator, "/r nope", "Canned response 'nope' not found")
+
+	b.send(t, testOpChat, testOperator, "/r hi", "Hello Maxim, I am operator from dubai")
+	last := b.waitSent(t, "Hello Maxim, I am operator from dubai")
+	deadline := time.Now().Add(testTimeout)
+	msg, err := b.db.GetMessageByWA(last.MessageID)
+	for msg == nil && err == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		msg, err = b.db.GetMessageByWA(last.MessageID)
+	}
+	if err != nil || msg == nil || msg.Direction != api.DirectionTg2wa || msg.TGUserName != "operator" || msg.TGChatID != testChat {
+		t.Errorf("GetMessageByWA() = %+v, %v", msg, err)
+	}
+
+	call := b.send(t, testOpChat, testOperator, "/r", "Choose canned response")
+	if !strings.Contains(call.Params.Get("reply_markup"), "canned.send#price") {
+		t.Fatalf("keyboard = %s", call.Params.Get("reply_markup"))
+	}
+	b.srv.Reset()
+	keyboard := &tgbotapi.Message{MessageID: 1000, Chat: testOpChat, From: &b.srv.Bot}
+	b.srv.PushCallback(keyboard, testOperator, "canned.send#price")
+	b.waitSent(t, "Price for 79111135900\nis 10$")
+	if _, ok := b.srv.WaitCall("editMessageText", testChat, "Price for 79111135900", testTimeout); !ok {
+		t.Errorf("keyboard not replaced by response, calls: %+v", b.srv.Calls(""))
+	}
+
+	b.send(t, testMGChat, testOperator, "/canned del hi", "Forbbiden, only Admin or Owner")
+	b.send(t, testMGChat, testAdmin, "/canned del hi", "Canned response 'hi' deleted")
+	b.send(t, testMGChat, testAdmin, "/canned del hi", "Canned response 'hi' not found")
+}
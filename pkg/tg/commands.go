@@ -14,6 +14,7 @@ import (
 	"tgwabr/api"
 	"tgwabr/context"
 	"tgwabr/pkg"
+	"tgwabr/pkg/wa/bridge"
 	"time"
 
 	tgBotApi "github.com/go-telegram-bot-api/telegram-bot-api"
@@ -39,7 +40,7 @@ func (s *Service) CommandRestart(update tgBotApi.Update) {
 	os.Exit(0)
 }
 
-func (s *Service) CommandAutoReplay(update tgBotApi.Update) {
+func (s *Service) CommandAutoReply(update tgBotApi.Update) {
 	chatID := update.Message.Chat.ID
 
 	msg := tgBotApi.NewMessage(chatID, "")
@@ -54,11 +55,259 @@ func (s *Service) CommandAutoReplay(update tgBotApi.Update) {
 		return
 	}
 
-	///autoreplay
-	//*;
-	//17:30-8:00|1-7|*|*;
-	//Hello!
+	db, ok := context.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+
+	mgID := strconv.FormatInt(chatID, 10)
+	args := strings.SplitN(strings.TrimSpace(update.Message.CommandArguments()), " ", 2)
+	action := strings.ToLower(args[0])
+
+	if action == "add" || action == "del" {
+		member, err := s.bot.GetChatMember(tgBotApi.ChatConfigWithUser{
+			ChatID: chatID,
+			UserID: update.Message.From.ID,
+		})
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get member of main group, please send admin this error: %s", err)
+			return
+		}
+		if !(member.IsCreator() || member.IsAdministrator()) {
+			msg.Text = "Forbbiden, only Admin or Owner"
+			return
+		}
+	}
+
+	switch action {
+	case "":
+		items, err := db.GetAutoReplies(mgID)
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get auto replies, please send admin this error: %s", err)
+			return
+		}
+		if len(items) == 0 {
+			msg.Text = "Auto replies not set, e.g. /autoreply add 17:30-8:00|1-5|*|1h; We are closed, will answer tomorrow"
+			return
+		}
+		builder := strings.Builder{}
+		builder.WriteString("Auto replies (time|weekdays|client|cooldown):\n")
+		for _, v := range items {
+			builder.WriteString(fmt.Sprintf("#%d %s; %s\n", v.ID, v.Rule, v.Text))
+		}
+		msg.Text = builder.String()
+	case "add":
+		parts := []string{}
+		if len(args) > 1 {
+			parts = strings.SplitN(args[1], ";", 2)
+		}
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			msg.Text = "Rule and text required, e.g. /autoreply add 17:30-8:00|1-5|*|1h; We are closed, will answer tomorrow"
+			return
+		}
+		if _, err := bridge.ParseAutoReplyRule(parts[0]); err != nil {
+			msg.Text = fmt.Sprintf("Fail parse rule: %s", err)
+			return
+		}
+		item := &api.AutoReply{MGID: mgID, Rule: strings.TrimSpace(parts[0]), Text: strings.TrimSpace(parts[1])}
+		if err := db.SaveAutoReply(item); err != nil {
+			msg.Text = fmt.Sprintf("Fail save auto reply, please send admin this error: %s", err)
+			return
+		}
+		msg.Text = fmt.Sprintf("Auto reply #%d added", item.ID)
+	case "del":
+		id := 0
+		if len(args) > 1 {
+			id, _ = strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(args[1]), "#"))
+		}
+		if id <= 0 {
+			msg.Text = "Number of auto reply required, e.g. /autoreply del 1"
+			return
+		}
+		ok, err := db.DeleteAutoReply(mgID, uint(id))
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail delete auto reply, please send admin this error: %s", err)
+			return
+		}
+		if !ok {
+			msg.Text = fmt.Sprintf("Auto reply #%d not found", id)
+			return
+		}
+		msg.Text = fmt.Sprintf("Auto reply #%d deleted", id)
+	default:
+		msg.Text = "Unknown action, use /autoreply, /autoreply add <rule>; <text> or /autoreply del <number>"
+	}
+}
+
+func (s *Service) CommandTopics(update tgBotApi.Update) {
+	chatID := update.Message.Chat.ID
+
+	msg := tgBotApi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
 
+	if !s.IsMainGroup(chatID) {
+		msg.Text = "Command work only 'Main group'"
+		return
+	}
+
+	db, ok := context.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+
+	mg, err := db.GetMainGroupByTGID(chatID)
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get main group, please send admin this error: %s", err)
+		return
+	}
+	if mg == nil {
+		msg.Text = "MainGroup not set, please /set name first"
+		return
+	}
+
+	switch strings.ToLower(strings.TrimSpace(update.Message.CommandArguments())) {
+	case "":
+		if mg.Topics {
+			msg.Text = "Topics: on, every WhatsApp client gets own topic"
+		} else {
+			msg.Text = "Topics: off, join chats to talk with WhatsApp clients"
+		}
+		return
+	case "on":
+		mg.Topics = true
+	case "off":
+		mg.Topics = false
+	default:
+		msg.Text = "Unknown action, use /topics on or /topics off"
+		return
+	}
+
+	member, err := s.bot.GetChatMember(tgBotApi.ChatConfigWithUser{
+		ChatID: chatID,
+		UserID: update.Message.From.ID,
+	})
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get member of main group, please send admin this error: %s", err)
+		return
+	}
+	if !(member.IsCreator() || member.IsAdministrator()) {
+		msg.Text = fmt.Sprintf("Forbbiden, only Admin or Owner")
+		return
+	}
+
+	if err = db.SaveMainGroup(mg); err != nil {
+		msg.Text = fmt.Sprintf("Fail set topics, please send admin this error: %s", err)
+		log.Println("Error save mainGroup store: ", err)
+		return
+	}
+	msg.Text = "Topics Set: OK"
+}
+
+func (s *Service) CommandHours(update tgBotApi.Update) {
+	chatID := update.Message.Chat.ID
+
+	msg := tgBotApi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	if !s.IsMainGroup(chatID) {
+		msg.Text = "Command work only 'Main group'"
+		return
+	}
+
+	db, ok := context.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+
+	mgID := strconv.FormatInt(chatID, 10)
+	calendar, err := db.GetCalendar(mgID)
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get calendar, please send admin this error: %s", err)
+		return
+	}
+	if calendar == nil {
+		calendar = &api.Calendar{MGID: mgID, Timezone: "UTC"}
+	}
+
+	args := strings.SplitN(strings.TrimSpace(update.Message.CommandArguments()), " ", 2)
+	value := ""
+	if len(args) > 1 {
+		value = strings.TrimSpace(args[1])
+	}
+	switch strings.ToLower(args[0]) {
+	case "":
+		hours := calendar.Hours
+		if hours == "" {
+			hours = "always open"
+		}
+		holidays := strings.Join(calendar.HolidayList(), ", ")
+		if holidays == "" {
+			holidays = "-"
+		}
+		now := "closed"
+		if calendar.IsOpen(time.Now()) {
+			now = "open"
+		}
+		msg.Text = fmt.Sprintf("Timezone: %s\nHours: %s\nHolidays: %s\nNow: %s", calendar.Timezone, hours, holidays, now)
+		return
+	case "tz":
+		calendar.Timezone = value
+	case "set":
+		calendar.Hours = value
+	case "holiday":
+		parts := strings.Fields(value)
+		if len(parts) != 2 || (parts[0] != "add" && parts[0] != "del") {
+			msg.Text = "Action and date required, e.g. /hours holiday add 2022-12-31"
+			return
+		}
+		list := []string{}
+		for _, v := range calendar.HolidayList() {
+			if v != parts[1] {
+				list = append(list, v)
+			}
+		}
+		if parts[0] == "add" {
+			list = append(list, parts[1])
+		}
+		calendar.Holidays = strings.Join(list, ",")
+	default:
+		msg.Text = "Unknown action, use /hours, /hours tz Asia/Dubai, /hours set 1-5 09:00-18:00; 6 10:00-14:00 or /hours holiday add|del 2022-12-31"
+		return
+	}
+
+	member, err := s.bot.GetChatMember(tgBotApi.ChatConfigWithUser{
+		ChatID: chatID,
+		UserID: update.Message.From.ID,
+	})
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get member of main group, please send admin this error: %s", err)
+		return
+	}
+	if !(member.IsCreator() || member.IsAdministrator()) {
+		msg.Text = "Forbbiden, only Admin or Owner"
+		return
+	}
+
+	if err = calendar.Validate(); err != nil {
+		msg.Text = fmt.Sprintf("Fail parse calendar: %s", err)
+		return
+	}
+	if err = db.SaveCalendar(calendar); err != nil {
+		msg.Text = fmt.Sprintf("Fail save calendar, please send admin this error: %s", err)
+		return
+	}
+	msg.Text = "Calendar Set: OK"
 }
 
 func (s *Service) CommandSync(update tgBotApi.Update) {
@@ -166,6 +415,7 @@ func (s *Service) CommandSomethingElse(update tgBotApi.Update, user, mg string)
 
 	users := map[string]bool{}
 	stat := map[string]int{}
+	offline := s.offlineOperators(db)
 
 	for _, mainGroup := range s.mainGroups {
 		if !s.IsMemberMainGroup(userID, mainGroup) {
@@ -205,6 +455,11 @@ func (s *Service) CommandSomethingElse(update tgBotApi.Update, user, mg string)
 				continue
 			}
 
+			// clients of offline operators are free for others
+			if offline[v.TGUserName] && v.TGUserName != userNameMessage {
+				v.TGUserName = ""
+			}
+
 			if ok := users[v.TGUserName]; !ok && v.TGUserName != "" && v.TGUserName != userNameMessage {
 				users[v.TGUserName] = true
 			}
@@ -432,6 +687,7 @@ func (s *Service) CommandStat(update tgBotApi.Update) {
 	}
 
 	items := []*api.Stat{}
+	sla := map[string]string{}
 	for _, v := range s.mainGroups {
 		var member tgBotApi.ChatMember
 		member, err = s.bot.GetChatMember(tgBotApi.ChatConfigWithUser{
@@ -455,14 +711,28 @@ func (s *Service) CommandStat(update tgBotApi.Update) {
 			return
 		}
 		items = append(items, res...)
+
+		var breaches []*api.SLABreach
+		breaches, err = db.GetSLABreachesOnPeriod(strconv.FormatInt(v, 10), dateStart, dateEnd)
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get SLA breaches, please send admin this error: %s", err)
+			return
+		}
+		for _, b := range breaches {
+			key := b.CreatedAt.Format("2006-01-02") + "|" + b.WAClient
+			if sla[key] != api.SLAEscalated {
+				sla[key] = b.Level
+			}
+		}
 	}
 	txt := ""
 	if len(items) > 0 {
 		txt = "Complete"
 	}
 	records := [][]string{
-		{"DateAt", "UserName", "WAName", "Session", "Answered", "CountIn", "CountOut"},
+		{"DateAt", "UserName", "WAName", "Session", "Answered", "CountIn", "CountOut", "SLA"},
 	}
+	clients := map[string]bool{}
 	for _, v := range items {
 		if v == nil {
 			continue
@@ -480,10 +750,29 @@ func (s *Service) CommandStat(update tgBotApi.Update) {
 			parts := strings.Split(v.WAClient, "@")
 			waName = parts[0]
 		}
+		key := v.Date.Format("2006-01-02") + "|" + v.WAClient
+		clients[key] = true
+		slaLevel := "ok"
+		if level, ok := sla[key]; ok {
+			slaLevel = level
+		}
 		records = append(records, []string{
-			v.Date.Format("2006-01-02"), v.TGUserName, waName, sess, answered, fmt.Sprintf("%d", v.CountIn), fmt.Sprintf("%d", v.CountOut),
+			v.Date.Format("2006-01-02"), v.TGUserName, waName, sess, answered, fmt.Sprintf("%d", v.CountIn), fmt.Sprintf("%d", v.CountOut), slaLevel,
 		})
 	}
+	if len(clients) > 0 {
+		breached, escalated := 0, 0
+		for key := range clients {
+			switch sla[key] {
+			case api.SLABreached:
+				breached++
+			case api.SLAEscalated:
+				escalated++
+			}
+		}
+		txt = fmt.Sprintf("Complete, SLA compliance %d%%: %d clients, %d breached, %d escalated",
+			100*(len(clients)-breached-escalated)/len(clients), len(clients), breached, escalated)
+	}
 	if txt == "" {
 		txt = "Stat not found from period"
 	} else {
@@ -554,10 +843,14 @@ func (s *Service) CommandSet(update tgBotApi.Update) {
 		return
 	}
 
-	err = db.SaveMainGroup(&api.MainGroup{
-		TGChatID: chatID,
-		Name:     params,
-	})
+	mg, err := db.GetMainGroupByTGID(chatID)
+	if err == nil && mg == nil {
+		mg = &api.MainGroup{TGChatID: chatID}
+	}
+	if err == nil {
+		mg.Name = params
+		err = db.SaveMainGroup(mg)
+	}
 	if err != nil {
 		msg.Text = fmt.Sprintf("Fail set '%s', please send admin this error: %s", params, err)
 		log.Println("Error save mainGroup store: ", err)
@@ -695,13 +988,16 @@ func (s *Service) CommandStatus(update tgBotApi.Update) {
 		chatStat = "No unread chats :)"
 	}
 
+	connection := wac.GetConnectionState().Describe(time.Now())
+
 	msg.Text = fmt.Sprintf(`
 Device: %s
+Connection: %s
 Login: %s
 Contacts: %s, load: %s, count: %d
 Chats: %s, count: %d, items:
  %s
-`, device, login, descContacts, loadContactStr, countContacts, descChats, countChats, chatStat)
+`, device, connection, login, descContacts, loadContactStr, countContacts, descChats, countChats, chatStat)
 }
 
 func (s *Service) CommandHistory(update tgBotApi.Update) {
@@ -1130,6 +1426,10 @@ func (s *Service) CommandJoin(update tgBotApi.Update, clientIn, mgIn string) {
 		return
 	}
 
+	if _, err = db.DeleteFreeChat(chat.TGChatID); err != nil {
+		log.Println("Error delete free chat store: ", err)
+	}
+
 	msgJoin := tgBotApi.NewMessage(mgChatID, fmt.Sprintf("Chat %s(%s) join to @%s", name, client, update.Message.From.UserName))
 	_, _ = s.BotSend(msgJoin)
 
@@ -1166,7 +1466,7 @@ func (s *Service) CommandJoin(update tgBotApi.Update, clientIn, mgIn string) {
 	for _, v := range messages {
 
 		msgTransfer := tgBotApi.NewMessage(chatID, v.Text)
-		err = wac.ReadMessage(v.WAClient, v.WAMessageID)
+		err = wac.ReadMessage(v.WAClient, v.WAFromClient, v.WAMessageID)
 		if err != nil {
 			log.Println("Error transfer message: ", err)
 		}
@@ -1194,6 +1494,8 @@ func (s *Service) CommandJoin(update tgBotApi.Update, clientIn, mgIn string) {
 		}
 	}
 
+	s.sendNotes(db, chatID, chat.MGID, chat.WAClient, fmt.Sprintf("%s(%s)", name, client))
+
 	msg.Text = fmt.Sprintf("Join '%s(%s)' OK", name, client)
 	msg.ReplyMarkup = tgBotApi.NewRemoveKeyboard(true)
 	s.UpdateStatMessage(1)
@@ -1266,11 +1568,215 @@ func (s *Service) CommandLeave(update tgBotApi.Update) {
 		})
 
 		_, _ = s.bot.DeleteChatPhoto(tgBotApi.DeleteChatPhotoConfig{ChatID: update.Message.Chat.ID})
+
+		free := &api.FreeChat{TGChatID: chatID, Title: "H.W.Bot Free chat"}
+		if len(chats) > 0 {
+			free.MGID = chats[0].MGID
+		}
+		err = db.SaveFreeChat(free)
+		if err != nil {
+			log.Println("Error save free chat store: ", err)
+		}
 	}
 
 	s.CommandSomethingElse(update, "", "")
 }
 
+func (s *Service) CommandTransfer(update tgBotApi.Update) {
+
+	chatID := update.Message.Chat.ID
+
+	msg := tgBotApi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	if s.IsMainGroup(chatID) {
+		msg.Text = "Command not work in Main group"
+		return
+	}
+
+	waSvc, ok := context.FromWA(s.ctx)
+	if !ok {
+		msg.Text = "Module WhatsApp not ready"
+		return
+	}
+
+	db, ok := context.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+
+	chats, err := db.GetChatsByChatID(chatID)
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail transfer chat, please send admin this error: %s", err)
+		log.Println("Error get chats store: ", err)
+		return
+	}
+	if len(chats) == 0 {
+		msg.Text = "Chat not joined!"
+		return
+	}
+	chat := chats[0]
+
+	args := strings.SplitN(strings.TrimSpace(update.Message.CommandArguments()), " ", 2)
+	if !strings.HasPrefix(args[0], "@") || len(args[0]) < 2 {
+		transfers, err := db.GetTransfersBySession(chat.Session)
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get transfers, please send admin this error: %s", err)
+			return
+		}
+		builder := strings.Builder{}
+		builder.WriteString("Operator required, e.g. /transfer @username Client asks about delivery\n")
+		for _, v := range transfers {
+			builder.WriteString(fmt.Sprintf("%s @%s -> @%s %s\n", v.CreatedAt.Format("02.01 15:04"), v.FromUser, v.ToUser, v.Note))
+		}
+		msg.Text = builder.String()
+		return
+	}
+	toUser := strings.TrimPrefix(args[0], "@")
+	note := ""
+	if len(args) > 1 {
+		note = strings.TrimSpace(args[1])
+	}
+
+	mgChatID, _ := strconv.ParseInt(chat.MGID, 10, 64)
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		msg.Text = "Instance WhatsApp not ready"
+		return
+	}
+	name := wac.GetClientName(chat.WAClient)
+	client := wac.GetShortClient(chat.WAClient)
+
+	toUser, toUserID, err := s.mainGroupUser(db, mgChatID, toUser)
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail transfer chat, please send admin this error: %s", err)
+		return
+	}
+	if toUser == "" {
+		msg.Text = fmt.Sprintf("Operator @%s not found in main group, ask to send /start to bot", strings.TrimPrefix(args[0], "@"))
+		return
+	}
+
+	transfer := &api.Transfer{
+		MGID:       chat.MGID,
+		WAClient:   chat.WAClient,
+		Session:    chat.Session,
+		FromUser:   update.Message.From.UserName,
+		ToUser:     toUser,
+		FromChatID: chatID,
+		ToChatID:   chatID,
+		Note:       note,
+	}
+
+	free, err := db.TakeFreeChat(chat.MGID)
+	if err != nil {
+		log.Println("Error take free chat store: ", err)
+	}
+	if free != nil {
+		transfer.ToChatID = free.TGChatID
+	}
+
+	chat.TGChatID = transfer.ToChatID
+	chat.TGUserName = toUser
+	if err = db.SaveChat(chat); err != nil {
+		if free != nil {
+			_ = db.SaveFreeChat(free)
+		}
+		msg.Text = fmt.Sprintf("Fail transfer chat, please send admin this error: %s", err)
+		log.Println("Error save chat store: ", err)
+		return
+	}
+	if err = db.SaveTransfer(transfer); err != nil {
+		log.Println("Error save transfer store: ", err)
+	}
+
+	header := fmt.Sprintf("Chat with %s(%s) transferred from @%s to @%s", name, client, transfer.FromUser, toUser)
+	if note != "" {
+		header = fmt.Sprintf("%s: %s", header, note)
+	}
+
+	if free != nil {
+		_, _ = s.bot.SetChatTitle(tgBotApi.SetChatTitleConfig{
+			ChatID: free.TGChatID,
+			Title:  fmt.Sprintf("Chat with %s(%s)", name, client),
+		})
+		_, _ = s.BotSend(tgBotApi.NewMessage(free.TGChatID, header))
+		s.sendNotes(db, free.TGChatID, chat.MGID, chat.WAClient, fmt.Sprintf("%s(%s)", name, client))
+		if err = wac.GetHistory(chat.WAClient, 5); err != nil {
+			log.Println("Error get History: ", err)
+		}
+
+		s.releaseChat(db, chat.MGID, chatID)
+	}
+
+	// one member link goes to operator, main group gets it only when operator has no private chat with bot
+	announce := header
+	link, err := s.inviteLink(transfer.ToChatID)
+	if err != nil {
+		log.Println("Error get invite link: ", err)
+		announce = fmt.Sprintf("%s\n@%s chat: invite link not available, please ask admin", header, toUser)
+	} else if _, err = s.BotSend(tgBotApi.NewMessage(int64(toUserID), fmt.Sprintf("%s\nYour chat: %s", header, link))); err != nil {
+		announce = fmt.Sprintf("%s\n@%s chat: %s", header, toUser, link)
+	}
+	_, _ = s.BotSend(tgBotApi.NewMessage(mgChatID, announce))
+
+	msg.Text = fmt.Sprintf("No free chat to move, chat stays here, @%s takes it over by invite link", toUser)
+	if free != nil {
+		msg.Text = fmt.Sprintf("Transfer to @%s OK, chat moved, this chat is free now", toUser)
+	}
+	s.UpdateStatMessage(1)
+}
+
+// releaseChat put chat back to free chats pool of main group when no client is joined to it anymore
+func (s *Service) releaseChat(db api.Store, mgID string, chatID int64) {
+	chats, err := db.GetChatsByChatID(chatID)
+	if err != nil {
+		log.Println("Error get chats store: ", err)
+		return
+	}
+	if len(chats) > 0 {
+		return
+	}
+	_, _ = s.bot.SetChatTitle(tgBotApi.SetChatTitleConfig{
+		ChatID: chatID,
+		Title:  fmt.Sprintf("H.W.Bot Free chat"),
+	})
+	if err = db.SaveFreeChat(&api.FreeChat{MGID: mgID, TGChatID: chatID, Title: "H.W.Bot Free chat"}); err != nil {
+		log.Println("Error save free chat store: ", err)
+	}
+}
+
+// mainGroupUser user name and id of registered operator member of main group or of admin of main group, empty
+// when not found. Bot API does not find members by user name
+func (s *Service) mainGroupUser(db api.Store, mgChatID int64, userName string) (string, int, error) {
+
+	operators, err := db.GetOperators()
+	if err != nil {
+		return "", 0, err
+	}
+	for _, v := range operators {
+		if strings.EqualFold(v.TGUserName, userName) && s.IsMemberMainGroup(v.TGUserID, mgChatID) {
+			return v.TGUserName, v.TGUserID, nil
+		}
+	}
+
+	admins, err := s.bot.GetChatAdministrators(tgBotApi.ChatConfig{ChatID: mgChatID})
+	if err != nil {
+		return "", 0, err
+	}
+	for _, v := range admins {
+		if v.User != nil && strings.EqualFold(v.User.UserName, userName) {
+			return v.User.UserName, v.User.ID, nil
+		}
+	}
+	return "", 0, nil
+}
+
 func getPhotoByte(path string) []byte {
 	resp, err := http.Get(path)
 	if err != nil {
@@ -1356,3 +1862,166 @@ func (s *Service) chunkedInlineButtons(btns []tgBotApi.InlineKeyboardButton, siz
 	}
 	return
 }
+
+var messageStatusNames = map[int]string{
+	api.MessageStatusFailed:      "failed",
+	api.MessageStatusPending:     "pending",
+	api.MessageStatusServerAck:   "sent",
+	api.MessageStatusDeliveryAck: "delivered",
+	api.MessageStatusRead:        "read",
+	api.MessageStatusPlayed:      "played",
+}
+
+func (s *Service) CommandReceipts(update tgBotApi.Update) {
+
+	chatID := update.Message.Chat.ID
+
+	msg := tgBotApi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	if s.IsMainGroup(chatID) {
+		msg.Text = "Command not work in Main group"
+		return
+	}
+
+	db, ok := context.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+
+	chats, err := db.GetChatsByChatID(chatID)
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get receipts, please send admin this error: %s", err)
+		log.Println("Error get chats store: ", err)
+		return
+	}
+
+	if len(chats) == 0 {
+		msg.Text = "Chat not joined!"
+		return
+	}
+
+	items, err := db.GetUnreadOutgoing(chatID, chats[0].Session)
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get receipts, please send admin this error: %s", err)
+		log.Println("Error get unread outgoing store: ", err)
+		return
+	}
+
+	if len(items) == 0 {
+		msg.Text = "All sent messages are read :)"
+		return
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("Unread messages: %d\n", len(items)))
+	for _, v := range items {
+		text := []rune(v.Text)
+		if len(text) > 30 {
+			text = append(text[:30], []rune("...")...)
+		}
+		builder.WriteString(fmt.Sprintf(" - %s @%s: %s (%s)\n",
+			time.Unix(int64(v.TGTimestamp), 0).Format("02.01 15:04"), v.TGUserName, string(text), messageStatusNames[v.MessageStatus]))
+	}
+	msg.Text = builder.String()
+}
+
+func (s *Service) CommandUnsend(update tgBotApi.Update) {
+
+	chatID := update.Message.Chat.ID
+
+	msg := tgBotApi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	if s.IsMainGroup(chatID) {
+		msg.Text = "Command not work in Main group"
+		return
+	}
+
+	if update.Message.ReplyToMessage == nil {
+		msg.Text = "Reply /unsend to your message for delete it in WhatsApp"
+		return
+	}
+	msg.ReplyToMessageID = update.Message.ReplyToMessage.MessageID
+
+	db, ok := context.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+
+	waSvc, ok := context.FromWA(s.ctx)
+	if !ok {
+		msg.Text = "Module WhatsApp not ready"
+		return
+	}
+
+	item, err := db.GetMessageByTG(update.Message.ReplyToMessage.MessageID, chatID)
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail unsend message, please send admin this error: %s", err)
+		log.Println("Error get message store: ", err)
+		return
+	}
+
+	if item == nil || item.WAMessageID == "" {
+		msg.Text = "Message not sent to WhatsApp"
+		return
+	}
+
+	if item.Direction != api.DirectionTg2wa {
+		msg.Text = "Only messages sent to client can be unsent"
+		return
+	}
+
+	if item.RevokeStatus == api.RevokeStatusRevoked {
+		msg.Text = "Message already unsent"
+		return
+	}
+
+	mgChatID, _ := strconv.ParseInt(item.MGID, 10, 64)
+	if item.TGUserName != update.Message.From.UserName {
+		member, err := s.bot.GetChatMember(tgBotApi.ChatConfigWithUser{
+			ChatID: mgChatID,
+			UserID: update.Message.From.ID,
+		})
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get member of main group, please send admin this error: %s", err)
+			return
+		}
+		if !(member.IsCreator() || member.IsAdministrator()) {
+			msg.Text = "Forbbiden, only author of message, Admin or Owner"
+			return
+		}
+	}
+
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		msg.Text = "Instance WhatsApp not ready"
+		return
+	}
+
+	item.RevokedBy = update.Message.From.UserName
+	item.RevokeStatus = api.RevokeStatusRevoked
+	err = wac.RevokeMessage(item.WAClient, item.WAMessageID, true)
+	if err != nil {
+		item.RevokeStatus = api.RevokeStatusFailed
+		msg.Text = fmt.Sprintf("Fail unsend message, please send admin this error: %s", err)
+		log.Println("Error revoke message WAInstance: ", err)
+	} else {
+		msg.Text = "Message unsent"
+	}
+
+	if err = db.SaveMessage(item); err != nil {
+		msg.Text = fmt.Sprintf("Fail unsend message, please send admin this error: %s", err)
+		log.Println("Error save message store: ", err)
+	}
+}
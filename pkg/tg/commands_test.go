@@ -2,8 +2,13 @@ package tg
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
 	"testing"
 	"tgwabr/api"
+	"tgwabr/pkg/wa/bridge"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
@@ -57,3 +62,153 @@ func TestService_prepareArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestService_AutoReply(t *testing.T) {
+	b := newTestBridge(t)
+	b.send(t, testMGChat, testAdmin, "/set dubai", "MainGroup Set: OK")
+
+	b.send(t, testMGChat, testOperator, "/autoreply add *|*|*|1h; We are closed", "Forbbiden, only Admin or Owner")
+	b.send(t, testMGChat, testAdmin, "/autoreply add 25:00-8:00; Closed", "Fail parse rule")
+	b.send(t, testMGChat, testAdmin, "/autoreply add *|*|+7 911 113-59-01; Only for other", "Auto reply #1 added")
+	b.send(t, testMGChat, testAdmin, "/autoreply add *|*|*|1h; We are closed", "Auto reply #2 added")
+	b.send(t, testMGChat, testAdmin, "/autoreply", "#2 *|*|*|1h; We are closed")
+
+	_, _ = b.wac.DoLogout()
+	b.wac.ReceiveText("79111135900", "Hello")
+	if got, err := b.db.GetAutoReplySent("-100", "79111135900@s.whatsapp.net", 2); err != nil || got != nil {
+		t.Errorf("GetAutoReplySent() = %+v, %v, want no cooldown of failed reply", got, err)
+	}
+	_, _ = b.wac.DoLogin()
+
+	b.wac.ReceiveText("79111135900", "Hello")
+	b.wac.ReceiveText("79111135900", "Anybody?")
+	sent := b.wac.Sent()
+	if len(sent) != 1 || sent[0].Text != "We are closed" || sent[0].Client != "79111135900@s.whatsapp.net" {
+		t.Errorf("auto replies = %+v, want one 'We are closed'", sent)
+	}
+	if got, err := b.db.GetAutoReplySent("-100", "79111135900@s.whatsapp.net", 2); err != nil || got == nil {
+		t.Errorf("GetAutoReplySent() = %+v, %v, want cooldown stored", got, err)
+	}
+
+	b.send(t, testMGChat, testOperator, "/autoreply del 2", "Forbbiden, only Admin or Owner")
+	b.send(t, testMGChat, testAdmin, "/autoreply del 2", "Auto reply #2 deleted")
+	b.send(t, testMGChat, testAdmin, "/autoreply del 2", "Auto reply #2 not found")
+
+	b.wac.AddContact("79111135901", "Ivan")
+	b.send(t, testOpChat, testOperator, "/join +7(911) 113-59-01", "Join 'Ivan(79111135901)' OK")
+	b.wac.ReceiveText("79111135901", "Hello")
+	if got := len(b.wac.Sent()); got != 1 {
+		t.Errorf("auto reply sent to joined client, sent = %d", got)
+	}
+
+	// window is in timezone of /hours, 14 hours away from UTC
+	b.send(t, testMGChat, testAdmin, "/hours tz Pacific/Kiritimati", "Calendar Set: OK")
+	loc, _ := time.LoadLocation("Pacific/Kiritimati")
+	hour := time.Now().In(loc).Hour()
+	rule := fmt.Sprintf("/autoreply add %d:00-%d:00; Good night", hour, (hour+1)%24)
+	b.send(t, testMGChat, testAdmin, rule, "Auto reply #3 added")
+	b.wac.ReceiveText("79111135902", "Hello")
+	if sent := b.wac.Sent(); len(sent) != 2 || sent[1].Text != "Good night" {
+		t.Errorf("auto replies = %+v, want 'Good night' in main group timezone", sent)
+	}
+}
+
+func TestService_Hours(t *testing.T) {
+	b := newTestBridge(t)
+	b.send(t, testMGChat, testAdmin, "/set dubai", "MainGroup Set: OK")
+
+	b.send(t, testMGChat, testOperator, "/hours", "Hours: always open")
+	b.send(t, testMGChat, testOperator, "/hours tz Asia/Dubai", "Forbbiden, only Admin or Owner")
+	b.send(t, testMGChat, testAdmin, "/hours tz Mars/Base", "Fail parse calendar: unknown timezone")
+	b.send(t, testMGChat, testAdmin, "/hours tz Asia/Dubai", "Calendar Set: OK")
+	b.send(t, testMGChat, testAdmin, "/hours set 1-7 00:00-00:01", "Calendar Set: OK")
+	b.send(t, testMGChat, testAdmin, "/hours holiday add 2022-12-31", "Calendar Set: OK")
+	b.send(t, testMGChat, testAdmin, "/hours", "Holidays: 2022-12-31")
+
+	calendar, err := b.db.GetCalendar("-100")
+	if err != nil || calendar == nil {
+		t.Fatalf("GetCalendar() = %v, %v", calendar, err)
+	}
+	at := time.Date(2022, 3, 7, 12, 0, 0, 0, calendar.Location())
+	id := b.wac.Receive(&bridge.Inbound{Kind: bridge.KindText, Client: "79111135900", Text: "Hello", Timestamp: uint64(at.Unix())})
+	msg, err := b.db.GetMessageByWA(id)
+	if err != nil || msg == nil || !msg.AfterHours {
+		t.Errorf("GetMessageByWA() = %+v, %v, want after hours", msg, err)
+	}
+}
+
+func TestService_Transfer(t *testing.T) {
+	b := newTestBridge(t)
+	b.join(t)
+	before, err := b.db.GetChatByClient("79111135900@s.whatsapp.net", "-100")
+	if err != nil || before == nil {
+		t.Fatalf("GetChatByClient() = %+v, %v", before, err)
+	}
+
+	b.send(t, testOpChat, testOperator, "/transfer", "Operator required")
+	b.send(t, testOpChat, testOperator, "/transfer @other VIP client", "Operator @other not found in main group")
+	b.send(t, &tgbotapi.Chat{ID: int64(testOther.ID), Type: "private"}, testOther, "/start", "New clients assigned to you will come here")
+	b.send(t, &tgbotapi.Chat{ID: int64(testAdmin.ID), Type: "private"}, testAdmin, "/start", "New clients assigned to you will come here")
+	b.send(t, testOpChat, testOperator, "/transfer @Other VIP client", "No free chat to move, chat stays here, @other takes it over by invite link")
+	if _, ok := b.srv.WaitCall("sendMessage", int64(testOther.ID), "Chat with Maxim(79111135900) transferred from @operator to @other: VIP client\nYour chat: https://t.me/+-200-", testTimeout); !ok {
+		t.Errorf("invite link not sent to operator, calls: %+v", b.srv.Calls(""))
+	}
+	if call, ok := b.srv.WaitCall("sendMessage", testMainGroup, "Chat with Maxim(79111135900) transferred", testTimeout); !ok || strings.Contains(call.Params.Get("text"), "https://") {
+		t.Errorf("transfer announce = %+v, want without one member link", call)
+	}
+	if got := b.srv.Calls("createChatInviteLink"); len(got) != 1 || got[0].Params.Get("member_limit") != "1" {
+		t.Errorf("createChatInviteLink calls = %+v, want one link for one member", got)
+	}
+
+	const movedChat = int64(-300)
+	if err = b.db.SaveFreeChat(&api.FreeChat{TGChatID: movedChat}); err != nil {
+		t.Fatalf("SaveFreeChat() error = %v", err)
+	}
+	b.send(t, testOpChat, testOther, "/transfer @admin", "Transfer to @admin OK, chat moved, this chat is free now")
+
+	chat, err := b.db.GetChatByClient("79111135900@s.whatsapp.net", "-100")
+	if err != nil || chat == nil || chat.TGChatID != movedChat || chat.TGUserName != "admin" || chat.Session != before.Session {
+		t.Errorf("GetChatByClient() = %+v, %v, want moved to %d with same session", chat, err, movedChat)
+	}
+	if free, err := b.db.TakeFreeChat("-100"); err != nil || free == nil || free.TGChatID != testChat {
+		t.Errorf("TakeFreeChat() = %+v, %v, want released chat", free, err)
+	}
+	transfers, err := b.db.GetTransfersBySession(before.Session)
+	if err != nil || len(transfers) != 2 || transfers[1].FromUser != "other" || transfers[1].ToChatID != movedChat {
+		t.Errorf("GetTransfersBySession() = %+v, %v", transfers, err)
+	}
+}
+
+func TestService_RePined(t *testing.T) {
+	b := newTestBridge(t)
+	b.send(t, testMGChat, testAdmin, "/set dubai", "MainGroup Set: OK")
+	b.wac.ReceiveText("79111135900", "Hello")
+	if _, ok := b.srv.WaitCall("sendMessage", testMainGroup, "#pinstat", testTimeout); !ok {
+		t.Fatalf("stat message not sent, calls: %+v", b.srv.Calls(""))
+	}
+	if _, ok := b.srv.WaitCall("pinChatMessage", testMainGroup, "", testTimeout); !ok {
+		t.Fatalf("stat message not pinned, calls: %+v", b.srv.Calls(""))
+	}
+	mg, err := b.db.GetMainGroupByTGID(testMainGroup)
+	if err != nil || mg == nil || mg.MessagePin < 1 {
+		t.Fatalf("GetMainGroupByTGID() = %+v, %v, want pinned message", mg, err)
+	}
+	pinned := mg.MessagePin
+
+	b.srv.Reset()
+	b.send(t, testOpChat, testOperator, "/repined", "Command work only 'Main group'")
+	b.srv.PushMessage(testMGChat, testOperator, "/repined")
+	if _, ok := b.srv.WaitCall("pinChatMessage", testMainGroup, "", testTimeout); !ok {
+		t.Fatalf("stat message not pinned again, calls: %+v", b.srv.Calls(""))
+	}
+	if got := b.srv.Calls("unpinChatMessage"); len(got) != 1 {
+		t.Errorf("unpinChatMessage calls = %d, want 1", len(got))
+	}
+	if got := b.srv.Calls("deleteMessage"); len(got) != 1 || got[0].Params.Get("message_id") != strconv.Itoa(pinned) {
+		t.Errorf("deleteMessage calls = %+v, want old pin %d", got, pinned)
+	}
+	mg, err = b.db.GetMainGroupByTGID(testMainGroup)
+	if err != nil || mg == nil || mg.MessagePin < 1 || mg.MessagePin == pinned {
+		t.Errorf("GetMainGroupByTGID() = %+v, %v, want new pinned message", mg, err)
+	}
+}
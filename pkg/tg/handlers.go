@@ -8,6 +8,8 @@ import (
 	"strings"
 	"tgwabr/api"
 	appCtx "tgwabr/context"
+	"tgwabr/pkg/wa/bridge"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
@@ -16,8 +18,11 @@ func (s *Service) HandleTextMessage(update tgbotapi.Update) {
 
 	chatID := update.Message.Chat.ID
 
+	var topicChat *api.Chat
 	if s.IsMainGroup(chatID) {
-		return
+		if topicChat = s.topicChat(update); topicChat == nil {
+			return
+		}
 	}
 
 	item := &api.Message{
@@ -43,6 +48,8 @@ func (s *Service) HandleTextMessage(update tgbotapi.Update) {
 		item.Text = fmt.Sprintf("VIDEO %s", update.Message.Video.MimeType)
 	} else if update.Message.Location != nil {
 		item.Text = fmt.Sprintf("LOCATION")
+	} else if update.Message.Contact != nil {
+		item.Text = fmt.Sprintf("CONTACT %s", update.Message.Contact.PhoneNumber)
 	} else {
 		item.Text = update.Message.Text
 	}
@@ -52,6 +59,9 @@ func (s *Service) HandleTextMessage(update tgbotapi.Update) {
 	}
 
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, "")
+	if topicChat != nil {
+		msg.ReplyToMessageID = item.TGMessageID
+	}
 	defer func() {
 		if msg.Text != "" {
 			_, _ = s.BotSend(msg)
@@ -80,6 +90,9 @@ func (s *Service) HandleTextMessage(update tgbotapi.Update) {
 		log.Println("Error get chats store: ", err)
 		return
 	}
+	if topicChat != nil {
+		chats = []*api.Chat{topicChat}
+	}
 
 	if len(chats) == 0 {
 		msg.Text = "Chat not join!"
@@ -88,67 +101,134 @@ func (s *Service) HandleTextMessage(update tgbotapi.Update) {
 
 	chat := chats[0]
 	mgChatID, _ := strconv.ParseInt(chat.MGID, 10, 64)
+
+	if note, ok := s.noteText(db, mgChatID, update.Message.Text); ok {
+		msg.Text = s.saveNote(db, chat, item.TGUserName, note)
+		return
+	}
 	wac, ok := waSvc.GetInstance(mgChatID)
 	if !ok {
 		msg.Text = "Instance WhatsApp not ready"
 		return
 	}
 
-	var resp *api.WAMessage
-	var respFile *http.Response
-	if update.Message.Audio != nil {
-		err, respFile = s.getFileResponse(update.Message.Audio.FileID)
-		if err == nil {
-			resp, err = wac.SendAudio(chat.WAClient, respFile.Body, update.Message.Audio.MimeType, "", "")
+	quotedID, quoted := "", ""
+	if update.Message.ReplyToMessage != nil {
+		orig, err := db.GetMessageByTG(update.Message.ReplyToMessage.MessageID, item.TGChatID)
+		if err != nil {
+			log.Println("Error get quoted message store: ", err)
+		} else if orig != nil && orig.WAMessageID != "" && orig.WAClient == chat.WAClient {
+			quotedID, quoted = orig.WAMessageID, orig.Text
 		}
+	}
+
+	out := &api.Outbox{
+		MGID:           wac.GetID(),
+		WAClient:       chat.WAClient,
+		TGChatID:       item.TGChatID,
+		TGUserName:     item.TGUserName,
+		TGMessageID:    item.TGMessageID,
+		TGTimestamp:    item.TGTimestamp,
+		TGFwdMessageID: item.TGFwdMessageID,
+		TGFwdChatID:    item.TGFwdChatID,
+		Session:        chat.Session,
+		Kind:           bridge.KindText,
+		Text:           item.Text,
+		QuotedID:       quotedID,
+		Quoted:         quoted,
+		Status:         api.OutboxPending,
+	}
+	if update.Message.Audio != nil {
+		out.Kind = bridge.KindAudio
+		out.FileID = update.Message.Audio.FileID
+		out.Mime = update.Message.Audio.MimeType
 	} else if update.Message.Video != nil {
-		err, respFile = s.getFileResponse(update.Message.Video.FileID)
-		if err == nil {
-			resp, err = wac.SendAudio(chat.WAClient, respFile.Body, update.Message.Video.MimeType, "", "")
-		}
+		out.Kind = bridge.KindVideo
+		out.FileID = update.Message.Video.FileID
+		out.Mime = update.Message.Video.MimeType
 	} else if update.Message.Location != nil {
-		resp, err = wac.SendLocation(chat.WAClient, update.Message.Location.Latitude, update.Message.Location.Longitude, "", "")
+		out.Kind = bridge.KindLocation
+		out.Lat = update.Message.Location.Latitude
+		out.Lon = update.Message.Location.Longitude
+	} else if update.Message.Contact != nil {
+		out.Kind = bridge.KindContact
+		out.Name = strings.TrimSpace(update.Message.Contact.FirstName + " " + update.Message.Contact.LastName)
+		out.Phone = update.Message.Contact.PhoneNumber
 	} else if update.Message.Photo != nil && len(*update.Message.Photo) > 0 {
-		v := (*update.Message.Photo)[len(*update.Message.Photo)-1]
-		err, respFile = s.getFileResponse(v.FileID)
-		if err == nil {
-			resp, err = wac.SendImage(chat.WAClient, respFile.Body, "image/jpeg", "", "")
-		}
+		out.Kind = bridge.KindImage
+		out.FileID = (*update.Message.Photo)[len(*update.Message.Photo)-1].FileID
+		out.Mime = "image/jpeg"
 	} else if update.Message.Document != nil {
-		err, respFile = s.getFileResponse(update.Message.Document.FileID)
-		if err == nil {
-			resp, err = wac.SendDocument(chat.WAClient, respFile.Body, update.Message.Document.MimeType, update.Message.Document.FileName, "", "")
-		}
-	} else {
-		resp, err = wac.SendMessage(chat.WAClient, item.Text, "", "")
+		out.Kind = bridge.KindDocument
+		out.FileID = update.Message.Document.FileID
+		out.Mime = update.Message.Document.MimeType
+		out.FileName = update.Message.Document.FileName
 	}
 
+	err = db.SaveOutbox(out)
 	if err != nil {
 		msg.Text = fmt.Sprintf("Fail send message, please send admin this error: %s", err)
-		log.Println("Error Send message WAInstance: ", err)
+		log.Println("Error save outbox store: ", err)
 		return
 	}
+	s.kickOutbox(mgChatID)
+	s.touchOperator(db, update.Message.From)
 
-	item.MGID = wac.GetID()
-	item.WAClient = resp.Client
-	item.WAMessageID = resp.MessageID
-	item.WAName = resp.Name
-	item.WAFwdMessageID = resp.FwdMessageID
-	item.WATimestamp = resp.Timestamp
-	item.Session = chat.Session
+	if topicChat != nil {
+		s.answerTopic(db, topicChat)
+	}
+}
 
-	err = db.SaveMessage(item)
-	if err != nil {
-		msg.Text = fmt.Sprintf("Fail send message, please send admin this error: %s", err)
-		log.Println("Error save Message store: ", err)
+// HandleChatMembers keep pool of free chats, chat bot added to is free until join
+func (s *Service) HandleChatMembers(update tgbotapi.Update) {
+
+	chatID := update.Message.Chat.ID
+	if s.IsMainGroup(chatID) {
+		return
+	}
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return
+	}
+
+	if update.Message.LeftChatMember != nil && update.Message.LeftChatMember.ID == s.bot.Self.ID {
+		if _, err := db.DeleteFreeChat(chatID); err != nil {
+			log.Println("Error delete free chat store: ", err)
+		}
+		return
+	}
+
+	if update.Message.NewChatMembers == nil {
+		return
+	}
+	for _, v := range *update.Message.NewChatMembers {
+		if v.ID != s.bot.Self.ID {
+			continue
+		}
+		chats, err := db.GetChatsByChatID(chatID)
+		if err != nil {
+			log.Println("Error get chats store: ", err)
+			return
+		}
+		if len(chats) > 0 {
+			return
+		}
+		if err = db.SaveFreeChat(&api.FreeChat{TGChatID: chatID, Title: update.Message.Chat.Title}); err != nil {
+			log.Println("Error save free chat store: ", err)
+		}
+		return
 	}
 }
 
+// fileClient download Telegram files, timeout keeps a stalled download from blocking outbox of main group
+var fileClient = &http.Client{Timeout: 2 * time.Minute}
+
 func (s *Service) getFileResponse(fileID string) (err error, respFile *http.Response) {
 	var urlFile string
 	urlFile, err = s.bot.GetFileDirectURL(fileID)
 	if err == nil {
-		respFile, err = http.Get(urlFile)
+		respFile, err = fileClient.Get(urlFile)
 	}
 	return err, respFile
 }
@@ -185,10 +265,52 @@ func (s *Service) HandleCommand(update tgbotapi.Update) {
 		s.CommandRePined(update)
 	case "restart":
 		s.CommandRestart(update)
-	case "autoreplay":
-		s.CommandAutoReplay(update)
+	case "autoreply":
+		s.CommandAutoReply(update)
+	case "hours":
+		s.CommandHours(update)
+	case "topics":
+		s.CommandTopics(update)
+	case "transfer":
+		s.CommandTransfer(update)
+	case "start":
+		s.CommandStart(update)
+	case "assign":
+		s.CommandAssign(update)
+	case "online":
+		s.CommandPresence(update, api.PresenceOnline)
+	case "away":
+		s.CommandPresence(update, api.PresenceAway)
+	case "offline":
+		s.CommandPresence(update, api.PresenceOffline)
+	case "roster":
+		s.CommandRoster(update)
+	case "sla":
+		s.CommandSLA(update)
+	case "note":
+		s.CommandNote(update)
+	case "canned":
+		s.CommandCanned(update)
+	case "r":
+		s.CommandCannedReply(update)
+	case "schedule":
+		s.CommandSchedule(update)
+	case "remind":
+		s.CommandRemind(update)
+	case "campaign":
+		s.CommandCampaign(update)
+	case "supervisor":
+		s.CommandSupervisor(update)
+	case "watch":
+		s.CommandWatch(update)
+	case "unwatch":
+		s.CommandUnwatch(update)
 	case "somethingelse":
 		s.CommandSomethingElse(update, "", "")
+	case "receipts":
+		s.CommandReceipts(update)
+	case "unsend":
+		s.CommandUnsend(update)
 	default:
 		_, _ = s.BotSend(tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Command '%s' not implement", update.Message.Command())))
 	}
@@ -203,6 +325,12 @@ func (s *Service) HandleCallbackQuery(update tgbotapi.Update) {
 		s.CallbackQuerySomethingElse(update.CallbackQuery, parts)
 	case "chat":
 		s.CallbackQueryChat(update, parts)
+	case "assign":
+		s.CallbackQueryAssign(update.CallbackQuery, parts)
+	case "canned":
+		s.CallbackQueryCanned(update.CallbackQuery, parts)
+	case "remind":
+		s.CallbackQueryRemind(update.CallbackQuery, parts)
 	default:
 		_, _ = s.BotSend(tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, fmt.Sprintf("Callback data '%s' not implement", parts[0])))
 	}
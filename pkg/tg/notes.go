@@ -0,0 +1,193 @@
+package tg
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// defaultNotePrefix messages with prefix in joined chat are internal notes, "-" in main group disables prefix
+const defaultNotePrefix = "//"
+
+func notePrefix(mg *api.MainGroup) string {
+	if mg == nil || mg.NotePrefix == "" {
+		return defaultNotePrefix
+	}
+	if mg.NotePrefix == "-" {
+		return ""
+	}
+	return mg.NotePrefix
+}
+
+// noteText text of internal note when message starts with note prefix of main group
+func (s *Service) noteText(db api.Store, mgChatID int64, text string) (string, bool) {
+	mg, err := db.GetMainGroupByTGID(mgChatID)
+	if err != nil {
+		log.Println("Error get MainGroup store: ", err)
+	}
+	prefix := notePrefix(mg)
+	if prefix == "" || !strings.HasPrefix(text, prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(text, prefix)), true
+}
+
+// sendNotes show internal notes on client to chat
+func (s *Service) sendNotes(db api.Store, chatID int64, mgID, client, title string) {
+	notes, err := db.GetNotesByClient(mgID, client)
+	if err != nil {
+		log.Println("Error get notes store: ", err)
+		return
+	}
+	if len(notes) == 0 {
+		return
+	}
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("📝 Notes on %s:", title))
+	for _, v := range notes {
+		builder.WriteString(fmt.Sprintf("\n%s @%s: %s", v.CreatedAt.Format("02.01.06-15:04"), v.TGUserName, v.Text))
+	}
+	_, _ = s.BotSend(tgbotapi.NewMessage(chatID, builder.String()))
+}
+
+// CommandNote add or show internal notes on client of joined chat, in main group set note prefix
+func (s *Service) CommandNote(update tgbotapi.Update) {
+
+	chatID := update.Message.Chat.ID
+
+	msg := tgbotapi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		msg.Text = "Module WhatsApp not ready"
+		return
+	}
+
+	args := strings.TrimSpace(update.Message.CommandArguments())
+
+	var chat *api.Chat
+	if s.IsMainGroup(chatID) {
+		if chat = s.topicChat(update); chat == nil {
+			s.notePrefixSet(db, update, args, &msg)
+			return
+		}
+		msg.ReplyToMessageID = update.Message.MessageID
+	} else {
+		chats, err := db.GetChatsByChatID(chatID)
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get chat, please send admin this error: %s", err)
+			return
+		}
+		if len(chats) == 0 {
+			msg.Text = "Chat not joined!"
+			return
+		}
+		chat = chats[0]
+	}
+
+	mgChatID, _ := strconv.ParseInt(chat.MGID, 10, 64)
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		msg.Text = "Instance WhatsApp not ready"
+		return
+	}
+	title := fmt.Sprintf("%s(%s)", wac.GetClientName(chat.WAClient), wac.GetShortClient(chat.WAClient))
+
+	if args == "" {
+		notes, err := db.GetNotesByClient(chat.MGID, chat.WAClient)
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get notes, please send admin this error: %s", err)
+			return
+		}
+		if len(notes) == 0 {
+			msg.Text = fmt.Sprintf("No notes on %s, add one with /note text", title)
+			return
+		}
+		s.sendNotes(db, chatID, chat.MGID, chat.WAClient, title)
+		return
+	}
+
+	msg.Text = s.saveNote(db, chat, update.Message.From.UserName, args)
+}
+
+func (s *Service) saveNote(db api.Store, chat *api.Chat, userName, text string) string {
+	if text == "" {
+		return "Note is empty"
+	}
+	err := db.SaveNote(&api.Note{
+		MGID:       chat.MGID,
+		WAClient:   chat.WAClient,
+		TGUserName: userName,
+		Text:       text,
+	})
+	if err != nil {
+		log.Println("Error save note store: ", err)
+		return fmt.Sprintf("Fail save note, please send admin this error: %s", err)
+	}
+	return "📝 Note saved, not sent to client"
+}
+
+func (s *Service) notePrefixSet(db api.Store, update tgbotapi.Update, args string, msg *tgbotapi.MessageConfig) {
+
+	chatID := update.Message.Chat.ID
+
+	mg, err := db.GetMainGroupByTGID(chatID)
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get main group, please send admin this error: %s", err)
+		return
+	}
+	if mg == nil {
+		msg.Text = "MainGroup not set, please /set name first"
+		return
+	}
+
+	parts := strings.Fields(args)
+	if len(parts) == 0 {
+		prefix := notePrefix(mg)
+		if prefix == "" {
+			prefix = "off"
+		}
+		msg.Text = fmt.Sprintf("Note prefix: %s, use /note text or prefix in joined chat", prefix)
+		return
+	}
+	if len(parts) != 2 || parts[0] != "prefix" {
+		msg.Text = "Use /note prefix // to set note prefix, /note prefix - to disable it"
+		return
+	}
+
+	member, err := s.bot.GetChatMember(tgbotapi.ChatConfigWithUser{
+		ChatID: chatID,
+		UserID: update.Message.From.ID,
+	})
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get member of main group, please send admin this error: %s", err)
+		return
+	}
+	if !(member.IsCreator() || member.IsAdministrator()) {
+		msg.Text = fmt.Sprintf("Forbbiden, only Admin or Owner")
+		return
+	}
+
+	mg.NotePrefix = parts[1]
+	if err = db.SaveMainGroup(mg); err != nil {
+		msg.Text = fmt.Sprintf("Fail set note prefix, please send admin this error: %s", err)
+		log.Println("Error save mainGroup store: ", err)
+		return
+	}
+	msg.Text = "Note prefix Set: OK"
+}
@@ -0,0 +1,46 @@
+package tg
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestService_Notes(t *testing.T) {
+	b := newTestBridge(t)
+	b.join(t)
+
+	b.send(t, testOpChat, testOperator, "/note", "No notes on Maxim(79111135900)")
+	b.send(t, testOpChat, testOperator, "// prefers calls", "Note saved, not sent to client")
+	b.send(t, testOpChat, testOperator, "/note VIP", "Note saved, not sent to client")
+	b.send(t, testOpChat, testOperator, "/note", "@operator: prefers calls\n")
+
+	b.send(t, testMGChat, testOperator, "/note prefix ##", "Forbbiden, only Admin or Owner")
+	b.send(t, testMGChat, testAdmin, "/note prefix ##", "Note prefix Set: OK")
+	b.send(t, testMGChat, testAdmin, "/note", "Note prefix: ##")
+	b.send(t, testOpChat, testOperator, "## call after 6pm", "Note saved, not sent to client")
+
+	b.srv.Reset()
+	b.srv.PushMessage(testOpChat, testOperator, "// not a note anymore")
+	deadline := time.Now().Add(testTimeout)
+	for b.wac.LastSent() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sent := b.wac.Sent(); len(sent) != 1 || sent[0].Text != "// not a note anymore" {
+		t.Fatalf("sent to WhatsApp = %+v, want only message without note prefix", sent)
+	}
+
+	b.send(t, testOpChat, testOperator, "/leave", "Leave chats")
+	b.srv.Reset()
+	b.send(t, testOpChat, testOther, "/join +7(911) 113-59-00", "Join 'Maxim(79111135900)' OK")
+	call, ok := b.srv.WaitCall("sendMessage", testChat, "📝 Notes on Maxim(79111135900):", testTimeout)
+	if !ok {
+		t.Fatalf("notes not shown on join, calls: %+v", b.srv.Calls(""))
+	}
+	text := call.Params.Get("text")
+	for _, want := range []string{"@operator: prefers calls", "@operator: VIP", "@operator: call after 6pm"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("notes %q does not contain %q", text, want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package tg
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"tgwabr/pkg/wa/bridge"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	defaultOutboxAttempts = 10
+	outboxIdle            = time.Minute
+	// outboxTick shortest wait of worker between passes, not to spin on items due right now
+	outboxTick = 100 * time.Millisecond
+)
+
+type outboxConfig struct {
+	min      time.Duration
+	max      time.Duration
+	attempts int
+	campaign time.Duration
+}
+
+func newOutboxConfig() outboxConfig {
+	config := outboxConfig{min: bridge.DefaultBackoffMin, max: bridge.DefaultBackoffMax, attempts: defaultOutboxAttempts, campaign: defaultCampaignInterval}
+	if v, err := time.ParseDuration(os.Getenv("OUTBOX_RETRY_MIN")); err == nil {
+		config.min = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("OUTBOX_RETRY_MAX")); err == nil {
+		config.max = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("OUTBOX_MAX_ATTEMPTS")); err == nil && v > 0 {
+		config.attempts = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("CAMPAIGN_INTERVAL")); err == nil && v > 0 {
+		config.campaign = v
+	}
+	return config
+}
+
+// kickOutbox wake workers of main group to send new items and check timers
+func (s *Service) kickOutbox(mgChatID int64) {
+	for _, kick := range []chan struct{}{s.outbox[mgChatID], s.timers[mgChatID]} {
+		if kick == nil {
+			continue
+		}
+		select {
+		case kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// startOutbox start workers of main groups. Sends may block on slow WhatsApp or Telegram file
+// transfer, so assignments, SLA and reminders run in own worker not to miss their time
+func (s *Service) startOutbox() {
+	s.outboxOnce.Do(func() {
+		for mgChatID := range s.outbox {
+			go s.outboxLoop(mgChatID, s.outbox[mgChatID], s.processSchedule, s.processOutbox, s.processUndelivered, s.processCampaigns)
+			go s.outboxLoop(mgChatID, s.timers[mgChatID], s.processAssignments, s.processSLA, s.processReminders)
+		}
+	})
+}
+
+// outboxLoop run processors of main group until stop, wait the nearest delay they return but not
+// less than outboxTick, or kick
+func (s *Service) outboxLoop(mgChatID int64, kick chan struct{}, processors ...func(mgChatID int64) time.Duration) {
+	for {
+		delay := outboxIdle
+		for _, process := range processors {
+			if wait := process(mgChatID); wait < delay {
+				delay = wait
+			}
+		}
+		if delay < outboxTick {
+			delay = outboxTick
+		}
+		select {
+		case <-kick:
+		case <-time.After(delay):
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// processOutbox send due items in order, item of client waits while previous one of the client
+// is pending, return delay until next due item
+func (s *Service) processOutbox(mgChatID int64) time.Duration {
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return outboxIdle
+	}
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		return outboxIdle
+	}
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		return outboxIdle
+	}
+
+	items, err := db.GetOutboxPending(wac.GetID())
+	if err != nil {
+		log.Println("Error get outbox store: ", err)
+		return s.outboxConfig.min
+	}
+
+	delay := outboxIdle
+	blocked := map[string]bool{}
+	for _, item := range items {
+		if blocked[item.WAClient] {
+			continue
+		}
+		if wait := time.Until(item.NextAt); wait > 0 {
+			blocked[item.WAClient] = true
+			if wait < delay {
+				delay = wait
+			}
+			continue
+		}
+		if s.sendOutbox(db, wac, item) {
+			continue
+		}
+		blocked[item.WAClient] = true
+		if wait := time.Until(item.NextAt); item.Status == api.OutboxPending && wait < delay {
+			delay = wait
+		}
+	}
+	return delay
+}
+
+// processUndelivered retry wa2tg messages failed to deliver to Telegram, return delay until next due item
+func (s *Service) processUndelivered(mgChatID int64) time.Duration {
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return outboxIdle
+	}
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		return outboxIdle
+	}
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		return outboxIdle
+	}
+
+	items, err := db.GetUndelivered(wac.GetID())
+	if err != nil {
+		log.Println("Error get undelivered store: ", err)
+		return s.outboxConfig.min
+	}
+
+	delay := outboxIdle
+	for _, item := range items {
+		if time.Until(item.NextAt) <= 0 {
+			if err = bridge.Redeliver(s.ctx, wac, item, s.outboxConfig.min, s.outboxConfig.max, s.outboxConfig.attempts); err != nil {
+				log.Println("Error redeliver message: ", err)
+			}
+		}
+		if wait := time.Until(item.NextAt); item.Status == api.UndeliveredPending && wait < delay {
+			delay = wait
+		}
+	}
+	return delay
+}
+
+// sendOutbox try send item, return true when client queue can continue
+func (s *Service) sendOutbox(db api.Store, wac api.WAInstance, item *api.Outbox) bool {
+
+	resp, err := s.sendWA(wac, item)
+	item.Attempts++
+
+	if err != nil {
+		log.Println("Error Send message WAInstance: ", err)
+		item.Error = err.Error()
+		note := ""
+		if item.Attempts >= s.outboxConfig.attempts {
+			item.Status = api.OutboxDead
+			note = fmt.Sprintf("Message not delivered to WhatsApp after %d attempts, please send admin this error: %s", item.Attempts, err)
+		} else {
+			item.NextAt = time.Now().Add(bridge.Backoff(item.Attempts, s.outboxConfig.min, s.outboxConfig.max))
+			if item.Attempts == 1 {
+				note = fmt.Sprintf("Message queued, WhatsApp not available: %s", err)
+			}
+		}
+		if err = db.SaveOutbox(item); err != nil {
+			log.Println("Error save outbox store: ", err)
+		}
+		if note != "" {
+			s.replyOutbox(item, note)
+		}
+		return item.Status == api.OutboxDead
+	}
+
+	message := &api.Message{
+		MGID:           wac.GetID(),
+		WAClient:       resp.Client,
+		WAMessageID:    resp.MessageID,
+		WAName:         resp.Name,
+		WAFwdMessageID: resp.FwdMessageID,
+		WATimestamp:    resp.Timestamp,
+		TGChatID:       item.TGChatID,
+		TGUserName:     item.TGUserName,
+		TGMessageID:    item.TGMessageID,
+		TGTimestamp:    item.TGTimestamp,
+		TGFwdMessageID: item.TGFwdMessageID,
+		TGFwdChatID:    item.TGFwdChatID,
+		Chatted:        api.ChattedYes,
+		Direction:      api.DirectionTg2wa,
+		MessageStatus:  api.MessageStatusServerAck,
+		Text:           item.Text,
+		Session:        item.Session,
+	}
+	if message.WAFwdMessageID == "" {
+		message.WAFwdMessageID = item.QuotedID
+	}
+
+	item.Status = api.OutboxSent
+	item.Error = ""
+	if err = db.SaveOutbox(item); err != nil {
+		log.Println("Error save outbox store: ", err)
+	}
+
+	if err = db.SaveMessage(message); err != nil {
+		s.replyOutbox(item, fmt.Sprintf("Fail send message, please send admin this error: %s", err))
+		log.Println("Error save Message store: ", err)
+		return true
+	}
+
+	s.MirrorMessage(message)
+
+	if err = s.ReactMessage(item.TGChatID, item.TGMessageID, bridge.StatusReactions[message.MessageStatus]); err != nil {
+		log.Println("Error react message: ", err)
+	}
+
+	if item.Attempts > 1 {
+		s.replyOutbox(item, fmt.Sprintf("Message delivered to WhatsApp after %d attempts", item.Attempts))
+	}
+	return true
+}
+
+func (s *Service) replyOutbox(item *api.Outbox, text string) {
+	msg := tgbotapi.NewMessage(item.TGChatID, text)
+	msg.ReplyToMessageID = item.TGMessageID
+	_, _ = s.BotSend(msg)
+}
+
+func (s *Service) sendWA(wac api.WAInstance, item *api.Outbox) (resp *api.WAMessage, err error) {
+
+	var respFile *http.Response
+	if item.FileID != "" {
+		err, respFile = s.getFileResponse(item.FileID)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = respFile.Body.Close() }()
+	}
+
+	switch item.Kind {
+	case bridge.KindAudio:
+		return wac.SendAudio(item.WAClient, respFile.Body, item.Mime, item.QuotedID, item.Quoted)
+	case bridge.KindVideo:
+		return wac.SendVideo(item.WAClient, respFile.Body, item.Mime, item.QuotedID, item.Quoted)
+	case bridge.KindImage:
+		return wac.SendImage(item.WAClient, respFile.Body, item.Mime, item.QuotedID, item.Quoted)
+	case bridge.KindDocument:
+		return wac.SendDocument(item.WAClient, respFile.Body, item.Mime, item.FileName, item.QuotedID, item.Quoted)
+	case bridge.KindLocation:
+		return wac.SendLocation(item.WAClient, item.Lat, item.Lon, item.QuotedID, item.Quoted)
+	case bridge.KindContact:
+		return wac.SendContact(item.WAClient, item.Name, item.Phone, item.QuotedID, item.Quoted)
+	default:
+		return wac.SendMessage(item.WAClient, item.Text, item.QuotedID, item.Quoted)
+	}
+}
+
+// retryUndelivered force retry of undelivered messages of main group
+func (s *Service) retryUndelivered(mgChatID int64) {
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return
+	}
+	if err := db.RetryUndelivered(strconv.FormatInt(mgChatID, 10)); err != nil {
+		log.Println("Error retry undelivered store: ", err)
+		return
+	}
+	s.kickOutbox(mgChatID)
+}
@@ -0,0 +1,52 @@
+package tg
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestService_Outbox(t *testing.T) {
+	_ = os.Setenv("OUTBOX_RETRY_MIN", "20ms")
+	_ = os.Setenv("OUTBOX_RETRY_MAX", "40ms")
+	_ = os.Setenv("OUTBOX_MAX_ATTEMPTS", "3")
+	defer func() {
+		_ = os.Unsetenv("OUTBOX_RETRY_MIN")
+		_ = os.Unsetenv("OUTBOX_RETRY_MAX")
+		_ = os.Unsetenv("OUTBOX_MAX_ATTEMPTS")
+	}()
+	b := newTestBridge(t)
+	b.join(t)
+
+	_, _ = b.wac.DoLogout()
+	b.srv.Reset()
+	b.srv.PushMessage(testOpChat, testOperator, "first")
+	if _, ok := b.srv.WaitCall("sendMessage", testChat, "Message queued, WhatsApp not available", testTimeout); !ok {
+		t.Fatalf("failed send not queued, calls: %+v", b.srv.Calls(""))
+	}
+	b.srv.PushMessage(testOpChat, testOperator, "second")
+	time.Sleep(10 * time.Millisecond)
+	_, _ = b.wac.DoLogin()
+
+	if _, ok := b.srv.WaitCall("sendMessage", testChat, "Message delivered to WhatsApp after", testTimeout); !ok {
+		t.Fatalf("retry not notified, calls: %+v", b.srv.Calls(""))
+	}
+	deadline := time.Now().Add(testTimeout)
+	for len(b.wac.Sent()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sent := b.wac.Sent()
+	if len(sent) != 2 || sent[0].Text != "first" || sent[1].Text != "second" {
+		t.Fatalf("Sent() = %+v, want first, second", sent)
+	}
+
+	_, _ = b.wac.DoLogout()
+	b.srv.Reset()
+	b.srv.PushMessage(testOpChat, testOperator, "lost")
+	if _, ok := b.srv.WaitCall("sendMessage", testChat, "Message not delivered to WhatsApp after 3 attempts", testTimeout); !ok {
+		t.Fatalf("dead letter not notified, calls: %+v", b.srv.Calls(""))
+	}
+	if items, err := b.db.GetOutboxPending(b.wac.GetID()); err != nil || len(items) != 0 {
+		t.Errorf("GetOutboxPending() = %+v, %v", items, err)
+	}
+}
@@ -0,0 +1,162 @@
+package tg
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// activeThrottle operator activity in bridged chats is saved no more often than this
+const activeThrottle = time.Minute
+
+var presenceIcons = map[string]string{
+	api.PresenceOnline:  "🟢",
+	api.PresenceAway:    "🟡",
+	api.PresenceOffline: "⚪",
+}
+
+// CommandPresence set presence of operator, /online takes optional auto away duration, e.g. /online 15m
+func (s *Service) CommandPresence(update tgbotapi.Update, presence string) {
+
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+
+	from := update.Message.From
+	operator, err := db.GetOperator(from.ID)
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail set presence, please send admin this error: %s", err)
+		return
+	}
+	if operator == nil {
+		operator = &api.Operator{TGUserID: from.ID}
+	}
+	operator.TGUserName = from.UserName
+
+	arg := strings.TrimSpace(update.Message.CommandArguments())
+	if arg != "" {
+		if presence != api.PresenceOnline {
+			msg.Text = "Auto away duration is only for /online, e.g. /online 15m"
+			return
+		}
+		awayAfter, err := time.ParseDuration(arg)
+		if err != nil || awayAfter < 0 {
+			msg.Text = fmt.Sprintf("Fail parse auto away '%s', e.g. /online 15m or /online 0 to disable", arg)
+			return
+		}
+		operator.AwayAfter = awayAfter
+	}
+
+	operator.Presence = presence
+	operator.PresenceAt = time.Now()
+	if err = db.SaveOperator(operator); err != nil {
+		msg.Text = fmt.Sprintf("Fail set presence, please send admin this error: %s", err)
+		return
+	}
+
+	msg.Text = fmt.Sprintf("%s @%s is %s", presenceIcons[presence], from.UserName, presence)
+	if presence == api.PresenceOnline && operator.AwayAfter > 0 {
+		msg.Text += fmt.Sprintf(", auto away after %s", operator.AwayAfter)
+	}
+}
+
+// CommandRoster show presence and open chats of operators of main group
+func (s *Service) CommandRoster(update tgbotapi.Update) {
+
+	chatID := update.Message.Chat.ID
+
+	msg := tgbotapi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	if !s.IsMainGroup(chatID) {
+		msg.Text = "Command work only 'Main group'"
+		return
+	}
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+
+	operators, err := db.GetOperators()
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get operators, please send admin this error: %s", err)
+		return
+	}
+	chats, err := db.GetChatsByMGID(fmt.Sprintf("%d", chatID))
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get chats, please send admin this error: %s", err)
+		return
+	}
+	load := map[string]int{}
+	for _, v := range chats {
+		load[v.TGUserName]++
+	}
+
+	now := time.Now()
+	lines := []string{}
+	for _, state := range []string{api.PresenceOnline, api.PresenceAway, api.PresenceOffline} {
+		for _, v := range operators {
+			if v.State(now) != state || !s.IsMemberMainGroup(v.TGUserID, chatID) {
+				continue
+			}
+			line := fmt.Sprintf("%s @%s %s", presenceIcons[state], v.TGUserName, state)
+			if since := v.Since(now); !since.IsZero() {
+				line += fmt.Sprintf(" for %s", now.Sub(since).Round(time.Minute))
+			}
+			lines = append(lines, fmt.Sprintf("%s, chats: %d", line, load[v.TGUserName]))
+		}
+	}
+	if len(lines) == 0 {
+		msg.Text = "No operators, send /online to bot"
+		return
+	}
+	msg.Text = "Operators:\n" + strings.Join(lines, "\n")
+}
+
+// touchOperator save activity of registered operator in bridged chat for auto away
+func (s *Service) touchOperator(db api.Store, from *tgbotapi.User) {
+	operator, err := db.GetOperator(from.ID)
+	if err != nil {
+		log.Println("Error get operator store: ", err)
+		return
+	}
+	if operator == nil || time.Since(operator.LastActiveAt) < activeThrottle {
+		return
+	}
+	operator.LastActiveAt = time.Now()
+	if err = db.SaveOperator(operator); err != nil {
+		log.Println("Error save operator store: ", err)
+	}
+}
+
+// offlineOperators user names of operators with presence offline
+func (s *Service) offlineOperators(db api.Store) map[string]bool {
+	res := map[string]bool{}
+	now := time.Now()
+	for _, v := range s.operators(db) {
+		if v.State(now) == api.PresenceOffline {
+			res[v.TGUserName] = true
+		}
+	}
+	return res
+}
@@ -0,0 +1,40 @@
+package tg
+
+import (
+	"testing"
+	"tgwabr/api"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestService_Presence(t *testing.T) {
+	b := newTestBridge(t)
+	b.send(t, testMGChat, testAdmin, "/set dubai", "MainGroup Set: OK")
+	b.send(t, testOpChat, testOperator, "/leave", "Leave chats")
+
+	otherChat := &tgbotapi.Chat{ID: int64(testOther.ID), Type: "private"}
+	operatorChat := &tgbotapi.Chat{ID: int64(testOperator.ID), Type: "private"}
+	b.send(t, otherChat, testOther, "/start", "New clients assigned to you will come here")
+	b.send(t, otherChat, testOther, "/away 5m", "Auto away duration is only for /online")
+	b.send(t, otherChat, testOther, "/offline", "@other is offline")
+	b.send(t, operatorChat, testOperator, "/online 15m", "@operator is online, auto away after 15m")
+	b.send(t, testMGChat, testAdmin, "/roster", "Operators:\n🟢 @operator online for 0s, chats: 0\n⚪ @other offline for 0s, chats: 0")
+
+	b.send(t, testMGChat, testAdmin, "/assign roundrobin", "Assign Set: OK")
+	b.srv.Reset()
+	b.wac.ReceiveText("79111135900", "Hello")
+	if _, ok := b.srv.WaitCall("sendMessage", operatorChat.ID, "New client Maxim(79111135900) assigned to you", testTimeout); !ok {
+		t.Fatalf("client not assigned to online operator, calls: %+v", b.srv.Calls(""))
+	}
+	for _, v := range b.srv.Calls("sendMessage") {
+		if v.ChatID() == otherChat.ID {
+			t.Errorf("client assigned to offline operator: %+v", v.Params)
+		}
+	}
+
+	operator, err := b.db.GetOperator(testOperator.ID)
+	if err != nil || operator == nil || operator.AwayAfter != 15*time.Minute || operator.State(time.Now().Add(time.Hour)) != api.PresenceAway {
+		t.Errorf("GetOperator() = %+v, %v, want auto away after 15m", operator, err)
+	}
+}
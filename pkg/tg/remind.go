@@ -0,0 +1,280 @@
+package tg
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// reminderSnoozes snooze buttons of reminder, tomorrow is 9:00 of main group timezone
+var reminderSnoozes = []string{"15m", "1h", "3h", "tomorrow"}
+
+// processReminders ping operators about due reminders, return delay until next due reminder
+func (s *Service) processReminders(mgChatID int64) time.Duration {
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return outboxIdle
+	}
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		return outboxIdle
+	}
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		return outboxIdle
+	}
+
+	items, err := db.GetRemindersPending(wac.GetID())
+	if err != nil {
+		log.Println("Error get reminders store: ", err)
+		return s.outboxConfig.min
+	}
+
+	delay := outboxIdle
+	for _, item := range items {
+		if wait := time.Until(item.RemindAt); wait > 0 {
+			if wait < delay {
+				delay = wait
+			}
+			continue
+		}
+		item.Status = api.ReminderSent
+		if err = db.SaveReminder(item); err != nil {
+			log.Println("Error save reminder store: ", err)
+			continue
+		}
+		s.sendReminder(db, wac, mgChatID, item)
+	}
+	return delay
+}
+
+// sendReminder ping operator in chat of reminder while client is still joined there, otherwise in main group
+func (s *Service) sendReminder(db api.Store, wac api.WAInstance, mgChatID int64, item *api.Reminder) {
+
+	client := fmt.Sprintf("%s(%s)", wac.GetClientName(item.WAClient), wac.GetShortClient(item.WAClient))
+	text := fmt.Sprintf("⏰ @%s reminder about client %s", item.TGUserName, client)
+	if item.Note != "" {
+		text += ": " + item.Note
+	}
+
+	inChat := item.TGChatID == mgChatID
+	if !inChat {
+		chat, err := db.GetChatByClient(item.WAClient, item.MGID)
+		if err != nil {
+			log.Println("Error get chat store: ", err)
+		}
+		inChat = chat != nil && chat.TGChatID == item.TGChatID
+	}
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, v := range reminderSnoozes {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(v, fmt.Sprintf("remind.snooze#%d#%s", item.ID, v)))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("Done", fmt.Sprintf("remind.done#%d", item.ID)))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(s.chunkedInlineButtons(buttons, 5)...)
+
+	if inChat {
+		msg := tgbotapi.NewMessage(item.TGChatID, text)
+		msg.ReplyToMessageID = item.TGMessageID
+		msg.ReplyMarkup = keyboard
+		_, err := s.BotSend(msg)
+		if err == nil {
+			return
+		}
+		log.Println("Error send reminder to chat: ", err)
+	}
+
+	msg := tgbotapi.NewMessage(mgChatID, text+", chat left")
+	msg.ReplyMarkup = keyboard
+	if _, err := s.BotSend(msg); err != nil {
+		log.Println("Error send reminder: ", err)
+	}
+}
+
+// CommandRemind remind operator about client of joined chat later, time is in timezone of main group /hours,
+// e.g. /remind 2h call back about delivery, /remind tomorrow 9:00, /remind to list
+func (s *Service) CommandRemind(update tgbotapi.Update) {
+
+	chatID := update.Message.Chat.ID
+	from := update.Message.From
+
+	msg := tgbotapi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		msg.Text = "Module WhatsApp not ready"
+		return
+	}
+
+	chat, replyTo := s.joinedChat(db, update.Message)
+	mgChatID := chatID
+	if chat != nil {
+		mgChatID, _ = strconv.ParseInt(chat.MGID, 10, 64)
+		msg.ReplyToMessageID = replyTo
+	} else if !s.IsMainGroup(chatID) {
+		msg.Text = "Chat not joined!"
+		return
+	}
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		msg.Text = "Instance WhatsApp not ready"
+		return
+	}
+	loc := s.location(db, wac.GetID())
+
+	args := strings.TrimSpace(update.Message.CommandArguments())
+	if args == "" {
+		items, err := db.GetRemindersPending(wac.GetID())
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get reminders, please send admin this error: %s", err)
+			return
+		}
+		builder := strings.Builder{}
+		for _, v := range items {
+			if v.TGUserID != from.ID {
+				continue
+			}
+			builder.WriteString(fmt.Sprintf("\n#%d %s %s(%s) %s", v.ID, v.RemindAt.In(loc).Format("2006-01-02 15:04"),
+				wac.GetClientName(v.WAClient), wac.GetShortClient(v.WAClient), v.Note))
+		}
+		if builder.Len() == 0 {
+			msg.Text = "No reminders, e.g. /remind 2h call back about delivery"
+			return
+		}
+		msg.Text = fmt.Sprintf("Your reminders, %s:%s", loc, builder.String())
+		return
+	}
+
+	if chat == nil {
+		msg.Text = "Chat not joined!"
+		return
+	}
+	at, note, err := api.ParseWhen(args, time.Now(), loc)
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail set reminder: %s", err)
+		return
+	}
+
+	item := &api.Reminder{
+		MGID:        wac.GetID(),
+		WAClient:    chat.WAClient,
+		TGChatID:    chatID,
+		TGMessageID: update.Message.MessageID,
+		TGUserID:    from.ID,
+		TGUserName:  from.UserName,
+		Note:        note,
+		Status:      api.ReminderPending,
+		RemindAt:    at,
+	}
+	if err = db.SaveReminder(item); err != nil {
+		msg.Text = fmt.Sprintf("Fail set reminder, please send admin this error: %s", err)
+		log.Println("Error save reminder store: ", err)
+		return
+	}
+	msg.Text = fmt.Sprintf("⏰ Reminder #%d at %s %s", item.ID, at.Format("2006-01-02 15:04"), loc)
+	s.kickOutbox(mgChatID)
+}
+
+// CallbackQueryRemind snooze or finish reminder by its operator
+func (s *Service) CallbackQueryRemind(query *tgbotapi.CallbackQuery, parts []string) {
+	if len(parts) == 1 {
+		return
+	}
+	args := strings.Split(parts[1], "#")
+	if len(args) < 2 || (args[0] == "snooze" && len(args) != 3) || (args[0] != "snooze" && args[0] != "done") {
+		return
+	}
+	answer := func(text string) {
+		_, _ = s.bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, text))
+	}
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		answer("Module Store not ready")
+		return
+	}
+
+	id, _ := strconv.Atoi(args[1])
+	item, err := db.GetReminder(uint(id))
+	if err != nil {
+		answer(fmt.Sprintf("Fail get reminder, please send admin this error: %s", err))
+		return
+	}
+	if item == nil {
+		answer("Reminder not found")
+		return
+	}
+	if item.TGUserID != query.From.ID {
+		answer(fmt.Sprintf("Reminder of @%s", item.TGUserName))
+		return
+	}
+	if item.Status != api.ReminderSent {
+		answer("Reminder is over")
+		return
+	}
+
+	text := strings.TrimPrefix(query.Message.Text, "⏰ ")
+	if args[0] == "done" {
+		item.Status = api.ReminderDone
+		text = "✅ " + text
+	} else {
+		now := time.Now()
+		loc := s.location(db, item.MGID)
+		if args[2] == "tomorrow" {
+			item.RemindAt, _, err = api.ParseWhen("tomorrow 9:00", now, loc)
+		} else {
+			var snooze time.Duration
+			if snooze, err = time.ParseDuration(args[2]); err == nil {
+				item.RemindAt = now.Add(snooze)
+			}
+		}
+		if err != nil {
+			answer(fmt.Sprintf("Fail snooze reminder: %s", err))
+			return
+		}
+		item.Status = api.ReminderPending
+		text = fmt.Sprintf("💤 Till %s: %s", item.RemindAt.In(loc).Format("2006-01-02 15:04"), text)
+	}
+
+	if err = db.SaveReminder(item); err != nil {
+		answer(fmt.Sprintf("Fail save reminder, please send admin this error: %s", err))
+		return
+	}
+	answer("OK")
+	if err = s.EditMessage(query.Message.Chat.ID, query.Message.MessageID, text, ""); err != nil {
+		log.Println("Error edit reminder message: ", err)
+	}
+	if item.Status == api.ReminderPending {
+		mgChatID, _ := strconv.ParseInt(item.MGID, 10, 64)
+		s.kickOutbox(mgChatID)
+	}
+}
+
+// location timezone of main group calendar, UTC when not set
+func (s *Service) location(db api.Store, mgID string) *time.Location {
+	calendar, err := db.GetCalendar(mgID)
+	if err != nil {
+		log.Println("Error get calendar store: ", err)
+	}
+	if calendar == nil {
+		return time.UTC
+	}
+	return calendar.Location()
+}
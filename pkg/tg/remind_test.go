@@ -0,0 +1,46 @@
+package tg
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestService_Remind(t *testing.T) {
+	b := newTestBridge(t)
+	b.join(t)
+
+	b.send(t, testOpChat, testOperator, "/remind", "No reminders")
+	b.send(t, testOpChat, testOperator, "/remind soon", "Fail set reminder")
+	b.send(t, testOpChat, testOperator, "/remind 1s call back", "⏰ Reminder #1 at")
+	call, ok := b.srv.WaitCall("sendMessage", testChat, "⏰ @operator reminder about client Maxim(79111135900): call back", testTimeout)
+	if !ok {
+		t.Fatalf("reminder not sent, calls: %+v", b.srv.Calls(""))
+	}
+	if !strings.Contains(call.Params.Get("reply_markup"), "remind.snooze#1#15m") {
+		t.Errorf("keyboard = %s", call.Params.Get("reply_markup"))
+	}
+
+	reminder := &tgbotapi.Message{MessageID: 1000, Chat: testOpChat, From: &b.srv.Bot, Text: call.Params.Get("text")}
+	callback := func(from *tgbotapi.User, data, method, want string) {
+		t.Helper()
+		b.srv.Reset()
+		b.srv.PushCallback(reminder, from, data)
+		if _, ok := b.srv.WaitCall(method, 0, want, testTimeout); !ok {
+			t.Fatalf("%s: no %s containing %q, calls: %+v", data, method, want, b.srv.Calls(""))
+		}
+	}
+	callback(testOther, "remind.done#1", "answerCallbackQuery", "Reminder of @operator")
+	callback(testOperator, "remind.snooze#1#15m", "editMessageText", "💤 Till")
+	b.send(t, testOpChat, testOperator, "/remind", "#1 ")
+	callback(testOperator, "remind.done#1", "answerCallbackQuery", "Reminder is over")
+
+	// client left, reminder comes to main group
+	b.send(t, testOpChat, testOperator, "/remind 2s send invoice", "⏰ Reminder #2 at")
+	b.send(t, testOpChat, testOperator, "/leave", "Leave chats")
+	if _, ok := b.srv.WaitCall("sendMessage", testMainGroup, "Maxim(79111135900): send invoice, chat left", testTimeout); !ok {
+		t.Fatalf("reminder not sent to main group, calls: %+v", b.srv.Calls(""))
+	}
+	callback(testOperator, "remind.done#2", "editMessageText", "✅ @operator reminder")
+}
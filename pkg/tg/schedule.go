@@ -0,0 +1,179 @@
+package tg
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"tgwabr/pkg/wa/bridge"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// processSchedule turn due scheduled messages into pending outbox items, return delay until next due item
+func (s *Service) processSchedule(mgChatID int64) time.Duration {
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return outboxIdle
+	}
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		return outboxIdle
+	}
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		return outboxIdle
+	}
+
+	items, err := db.GetOutboxScheduled(wac.GetID())
+	if err != nil {
+		log.Println("Error get scheduled outbox store: ", err)
+		return s.outboxConfig.min
+	}
+
+	delay := outboxIdle
+	for _, item := range items {
+		if wait := time.Until(item.NextAt); wait > 0 {
+			if wait < delay {
+				delay = wait
+			}
+			continue
+		}
+		item.Status = api.OutboxPending
+		item.NextAt = time.Now()
+		if err = db.SaveOutbox(item); err != nil {
+			log.Println("Error save outbox store: ", err)
+		}
+	}
+	return delay
+}
+
+// CommandSchedule schedule message to client of joined chat, time is in timezone of main group /hours,
+// e.g. /schedule tomorrow 9:00 Text, /schedule to list and /schedule cancel 12
+func (s *Service) CommandSchedule(update tgbotapi.Update) {
+
+	chatID := update.Message.Chat.ID
+
+	msg := tgbotapi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		msg.Text = "Module WhatsApp not ready"
+		return
+	}
+
+	// in main group outside of topic list and cancel work for all clients
+	chat, replyTo := s.joinedChat(db, update.Message)
+	mgChatID := chatID
+	if chat != nil {
+		mgChatID, _ = strconv.ParseInt(chat.MGID, 10, 64)
+		msg.ReplyToMessageID = replyTo
+	} else if !s.IsMainGroup(chatID) {
+		msg.Text = "Chat not joined!"
+		return
+	}
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		msg.Text = "Instance WhatsApp not ready"
+		return
+	}
+
+	loc := s.location(db, wac.GetID())
+
+	args := strings.TrimSpace(update.Message.CommandArguments())
+	fields := strings.Fields(strings.ToLower(args))
+	switch {
+	case len(fields) == 0 || fields[0] == "list":
+		items, err := db.GetOutboxScheduled(wac.GetID())
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get scheduled messages, please send admin this error: %s", err)
+			return
+		}
+		builder := strings.Builder{}
+		for _, v := range items {
+			if chat != nil && v.WAClient != chat.WAClient {
+				continue
+			}
+			builder.WriteString(fmt.Sprintf("\n#%d %s %s(%s) @%s: %s", v.ID, v.NextAt.In(loc).Format("2006-01-02 15:04"),
+				wac.GetClientName(v.WAClient), wac.GetShortClient(v.WAClient), v.TGUserName, v.Text))
+		}
+		if builder.Len() == 0 {
+			msg.Text = "No scheduled messages, e.g. /schedule tomorrow 9:00 Hello"
+			return
+		}
+		msg.Text = fmt.Sprintf("Scheduled messages, %s:%s", loc, builder.String())
+	case fields[0] == "cancel":
+		if len(fields) != 2 {
+			msg.Text = "Use /schedule cancel <number>, e.g. /schedule cancel 12"
+			return
+		}
+		id, err := strconv.ParseUint(strings.TrimPrefix(fields[1], "#"), 10, 64)
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail parse number '%s'", fields[1])
+			return
+		}
+		item, err := db.GetOutbox(uint(id))
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get scheduled message, please send admin this error: %s", err)
+			return
+		}
+		if item == nil || item.MGID != wac.GetID() || item.Status != api.OutboxScheduled || (chat != nil && item.WAClient != chat.WAClient) {
+			msg.Text = fmt.Sprintf("Scheduled message #%d not found", id)
+			return
+		}
+		item.Status = api.OutboxCanceled
+		if err = db.SaveOutbox(item); err != nil {
+			msg.Text = fmt.Sprintf("Fail cancel scheduled message, please send admin this error: %s", err)
+			return
+		}
+		msg.Text = fmt.Sprintf("Scheduled message #%d canceled", id)
+	default:
+		if chat == nil {
+			msg.Text = "Chat not joined!"
+			return
+		}
+		at, text, err := api.ParseWhen(args, time.Now(), loc)
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail schedule message: %s", err)
+			return
+		}
+		if text == "" {
+			msg.Text = "Text required, e.g. /schedule tomorrow 9:00 Hello"
+			return
+		}
+		out := &api.Outbox{
+			MGID:        wac.GetID(),
+			WAClient:    chat.WAClient,
+			TGChatID:    chatID,
+			TGUserName:  update.Message.From.UserName,
+			TGMessageID: update.Message.MessageID,
+			TGTimestamp: update.Message.Date,
+			Session:     chat.Session,
+			Kind:        bridge.KindText,
+			Text:        text,
+			Status:      api.OutboxScheduled,
+			NextAt:      at,
+		}
+		if err = db.SaveOutbox(out); err != nil {
+			msg.Text = fmt.Sprintf("Fail schedule message, please send admin this error: %s", err)
+			log.Println("Error save outbox store: ", err)
+			return
+		}
+		msg.Text = fmt.Sprintf("Message #%d scheduled at %s %s, cancel with /schedule cancel %d", out.ID, at.Format("2006-01-02 15:04"), loc, out.ID)
+		s.kickOutbox(mgChatID)
+	}
+}
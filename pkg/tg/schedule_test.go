@@ -0,0 +1,72 @@
+package tg
+
+import (
+	"fmt"
+	"testing"
+	"tgwabr/api"
+	"tgwabr/pkg/wa/bridge"
+	"time"
+)
+
+func TestService_Schedule(t *testing.T) {
+	b := newTestBridge(t)
+	b.join(t)
+
+	b.send(t, testOpChat, testOperator, "/schedule", "No scheduled messages")
+	b.send(t, testOpChat, testOperator, "/schedule 9:99 Hello", "Fail schedule message: fail parse time '9:99'")
+	b.send(t, testOpChat, testOperator, "/schedule 2h", "Text required")
+	b.send(t, testOpChat, testOperator, "/schedule tomorrow 9:00 See you", "scheduled at")
+	b.send(t, testOpChat, testOperator, "/schedule", "@operator: See you")
+	b.send(t, testMGChat, testAdmin, "/schedule", "Maxim(79111135900) @operator: See you")
+	b.send(t, testOpChat, testOperator, "/schedule cancel 1", "Scheduled message #1 canceled")
+	b.send(t, testOpChat, testOperator, "/schedule cancel 1", "Scheduled message #1 not found")
+
+	b.send(t, testOpChat, testOperator, "/schedule 1s Hello\nlater", "Message #2 scheduled")
+	last := b.waitSent(t, "Hello\nlater")
+	deadline := time.Now().Add(testTimeout)
+	msg, err := b.db.GetMessageByWA(last.MessageID)
+	for msg == nil && err == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		msg, err = b.db.GetMessageByWA(last.MessageID)
+	}
+	if err != nil || msg == nil || msg.Direction != api.DirectionTg2wa || msg.TGUserName != "operator" || msg.TGChatID != testChat {
+		t.Errorf("GetMessageByWA() = %+v, %v", msg, err)
+	}
+
+	// item persisted before start of worker is sent when due
+	item := &api.Outbox{
+		MGID:        b.wac.GetID(),
+		WAClient:    last.Client,
+		TGChatID:    testChat,
+		TGUserName:  "other",
+		TGMessageID: 5000,
+		Kind:        bridge.KindText,
+		Text:        "Before restart",
+		Status:      api.OutboxScheduled,
+		NextAt:      time.Now().Add(-time.Minute),
+	}
+	if err = b.db.SaveOutbox(item); err != nil {
+		t.Fatalf("SaveOutbox() error = %v", err)
+	}
+	b.tg.kickOutbox(testMainGroup)
+	b.waitSent(t, "Before restart")
+	b.send(t, testOpChat, testOperator, "/schedule", "No scheduled messages")
+
+	// message to other client is not canceled from joined chat
+	other := &api.Outbox{
+		MGID:       b.wac.GetID(),
+		WAClient:   "79111135901@s.whatsapp.net",
+		TGChatID:   testMainGroup,
+		TGUserName: "other",
+		Kind:       bridge.KindText,
+		Text:       "Other client",
+		Status:     api.OutboxScheduled,
+		NextAt:     time.Now().Add(time.Hour),
+	}
+	if err = b.db.SaveOutbox(other); err != nil {
+		t.Fatalf("SaveOutbox() error = %v", err)
+	}
+	cancel := fmt.Sprintf("/schedule cancel %d", other.ID)
+	b.send(t, testOpChat, testOperator, cancel, fmt.Sprintf("Scheduled message #%d not found", other.ID))
+	b.send(t, testMGChat, testAdmin, cancel, fmt.Sprintf("Scheduled message #%d canceled", other.ID))
+}
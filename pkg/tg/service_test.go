@@ -0,0 +1,417 @@
+package tg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"tgwabr/pkg/store"
+	"tgwabr/pkg/tg/tgtest"
+	"tgwabr/pkg/wa/bridge"
+	"tgwabr/pkg/wa/fake"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	testMainGroup = int64(-100)
+	testChat      = int64(-200)
+	testTimeout   = 3 * time.Second
+)
+
+var (
+	testAdmin    = &tgbotapi.User{ID: 10, UserName: "admin"}
+	testOperator = &tgbotapi.User{ID: 11, UserName: "operator"}
+	testOther    = &tgbotapi.User{ID: 12, UserName: "other"}
+	testMGChat   = &tgbotapi.Chat{ID: testMainGroup, Type: "supergroup"}
+	testOpChat   = &tgbotapi.Chat{ID: testChat, Type: "group"}
+)
+
+type testBridge struct {
+	srv *tgtest.Server
+	tg  *Service
+	wa  *fake.Service
+	wac *fake.Instance
+	db  api.Store
+}
+
+func newTestBridge(t *testing.T) *testBridge {
+	t.Helper()
+	srv := tgtest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.SetMember(testMainGroup, testAdmin.ID, "administrator")
+	srv.SetMember(testChat, testAdmin.ID, "administrator")
+
+	_ = os.Setenv("TYPE_DB", "sqlite3")
+	_ = os.Setenv("NAME_INSTANCE", filepath.Join(t.TempDir(), "test"))
+	_ = os.Setenv("TG_MAIN_GROUPS", "-100")
+	_ = os.Setenv("TG_API_TOKEN", "test")
+	_ = os.Setenv("TG_API_ENDPOINT", srv.Endpoint())
+
+	ctx := context.Background()
+	db, err := store.New(ctx)
+	if err != nil {
+		t.Fatalf("store.New() error = %v", err)
+	}
+	ctx = appCtx.NewDB(ctx, db)
+
+	tg, err := New(ctx)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx = appCtx.NewTG(ctx, tg)
+
+	wa := fake.New(ctx, testMainGroup)
+	ctx = appCtx.NewWA(ctx, wa)
+	wa.UpdateCTX(ctx)
+	tg.UpdateCTX(ctx)
+
+	t.Cleanup(func() {
+		_ = tg.ShutDown()
+		_ = db.ShutDown()
+	})
+
+	wac := wa.Instance(testMainGroup)
+	wac.AddContact("79111135900", "Maxim")
+
+	return &testBridge{srv: srv, tg: tg, wa: wa, wac: wac, db: db}
+}
+
+func (b *testBridge) send(t *testing.T, chat *tgbotapi.Chat, from *tgbotapi.User, text string, want string) tgtest.Call {
+	t.Helper()
+	b.srv.Reset()
+	b.srv.PushMessage(chat, from, text)
+	call, ok := b.srv.WaitCall("", chat.ID, want, testTimeout)
+	if !ok {
+		t.Fatalf("%s: no reply containing %q in chat %d, calls: %+v", text, want, chat.ID, b.srv.Calls(""))
+	}
+	return call
+}
+
+// waitSent wait last message sent to WhatsApp has text
+func (b *testBridge) waitSent(t *testing.T, want string) *fake.Sent {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for time.Now().Before(deadline) {
+		if last := b.wac.LastSent(); last != nil && last.Text == want {
+			return last
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("sent to WhatsApp = %+v, want %q", b.wac.LastSent(), want)
+	return nil
+}
+
+// waitStored wait message sent to WhatsApp is stored
+func (b *testBridge) waitStored(t *testing.T, sent *fake.Sent) *api.Message {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for time.Now().Before(deadline) {
+		msg, err := b.db.GetMessageByWA(sent.MessageID)
+		if err != nil {
+			t.Fatalf("GetMessageByWA() error = %v", err)
+		}
+		if msg != nil {
+			return msg
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("message %s sent to WhatsApp not stored", sent.MessageID)
+	return nil
+}
+
+func (b *testBridge) join(t *testing.T) {
+	t.Helper()
+	b.send(t, testMGChat, testAdmin, "/set dubai", "MainGroup Set: OK")
+	b.send(t, testOpChat, testOperator, "/join +7(911) 113-59-00", "Join 'Maxim(79111135900)' OK")
+}
+
+func TestService_Commands(t *testing.T) {
+	b := newTestBridge(t)
+	b.join(t)
+
+	tests := []struct {
+		name string
+		chat *tgbotapi.Chat
+		from *tgbotapi.User
+		text string
+		want string
+	}{
+		{name: "status", chat: testMGChat, from: testOperator, text: "/status", want: "Login: Online"},
+		{name: "status connection", chat: testMGChat, from: testOperator, text: "/status", want: "Connection: connected since"},
+		{name: "status not main group", chat: testOpChat, from: testOperator, text: "/status", want: "Command work only 'Main group'"},
+		{name: "set forbidden", chat: testMGChat, from: testOperator, text: "/set minsk", want: "Forbbiden, only Admin or Owner"},
+		{name: "sync", chat: testMGChat, from: testOperator, text: "/sync", want: "Sync contact OK, Sync chat OK"},
+		{name: "check_client", chat: testOpChat, from: testOperator, text: "/check_client +7 911 113 59 00", want: "name: Maxim, mg: dubai"},
+		{name: "check_client main group", chat: testMGChat, from: testOperator, text: "/check_client 79111135900", want: "Main group not check client"},
+		{name: "alias", chat: testMGChat, from: testOperator, text: "/alias 79111135900 max", want: "Client '79111135900' save as 'max'"},
+		{name: "contact", chat: testMGChat, from: testOperator, text: "/contact 79111135900 maxim", want: "Client '79111135900' save as 'maxim'"},
+		{name: "join already joined", chat: testOpChat, from: testOperator, text: "/join max", want: "Chat already joined"},
+		{name: "join main group", chat: testMGChat, from: testOperator, text: "/join max", want: "Main group not join client"},
+		{name: "stat", chat: testOpChat, from: testOperator, text: "/stat 2020-01-01", want: "Stat"},
+		{name: "stat main group", chat: testMGChat, from: testOperator, text: "/stat", want: "Command not work in Main group"},
+		{name: "set_logger forbidden", chat: testOpChat, from: testOperator, text: "/set_logger dubai", want: "Forbbiden, only Admin"},
+		{name: "set_logger", chat: testOpChat, from: testAdmin, text: "/set_logger dubai", want: "Set Logger: OK"},
+		{name: "somethingelse", chat: testOpChat, from: testOperator, text: "/somethingelse", want: "Join chat helper"},
+		{name: "somethingelse main group", chat: testMGChat, from: testOperator, text: "/somethingelse", want: "Command not for main group"},
+		{name: "restart not main group", chat: testOpChat, from: testOperator, text: "/restart", want: "Command work only 'Main group'"},
+		{name: "autoreply not main group", chat: testOpChat, from: testOperator, text: "/autoreply", want: "Command work only 'Main group'"},
+		{name: "receipts", chat: testOpChat, from: testOperator, text: "/receipts", want: "All sent messages are read"},
+		{name: "receipts main group", chat: testMGChat, from: testOperator, text: "/receipts", want: "Command not work in Main group"},
+		{name: "unknown", chat: testOpChat, from: testOperator, text: "/unknown", want: "Command 'unknown' not implement"},
+		{name: "logout", chat: testMGChat, from: testOperator, text: "/logout", want: "Logout OK"},
+		{name: "login", chat: testMGChat, from: testOperator, text: "/login", want: "Login OK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b.send(t, tt.chat, tt.from, tt.text, tt.want)
+		})
+	}
+}
+
+func TestService_Bridge(t *testing.T) {
+	b := newTestBridge(t)
+
+	b.srv.Reset()
+	b.wac.ReceiveText("79111135900", "Hello from client")
+	if _, ok := b.srv.WaitCall("sendMessage", testMainGroup, "Client Maxim(79111135900):\nHello from client", testTimeout); !ok {
+		t.Fatalf("ReceiveText() not relayed to main group, calls: %+v", b.srv.Calls(""))
+	}
+
+	b.join(t)
+	if _, ok := b.srv.WaitCall("sendMessage", testChat, "Hello from client", testTimeout); !ok {
+		t.Fatalf("join not transfer not chatted messages, calls: %+v", b.srv.Calls(""))
+	}
+	if _, ok := b.srv.WaitCall("setChatTitle", testChat, "", testTimeout); !ok {
+		t.Errorf("join not set chat title")
+	}
+
+	b.srv.Reset()
+	b.srv.PushMessage(testOpChat, testOperator, "Hello from operator")
+	deadline := time.Now().Add(testTimeout)
+	for b.wac.LastSent() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	last := b.wac.LastSent()
+	if last == nil || last.Text != "Hello from operator" || last.Client != "79111135900@s.whatsapp.net" {
+		t.Fatalf("HandleTextMessage() sent = %+v", last)
+	}
+	// outbox saves message after it is sent to WhatsApp
+	msg, err := b.db.GetMessageByWA(last.MessageID)
+	for msg == nil && err == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		msg, err = b.db.GetMessageByWA(last.MessageID)
+	}
+	if err != nil || msg == nil || msg.Direction != api.DirectionTg2wa || msg.TGUserName != "operator" {
+		t.Errorf("GetMessageByWA() = %+v, %v", msg, err)
+	}
+
+	b.srv.Reset()
+	b.wac.ReceiveText("79111135900", "Thanks")
+	if _, ok := b.srv.WaitCall("sendMessage", testChat, "Thanks", testTimeout); !ok {
+		t.Errorf("ReceiveText() not relayed to joined chat, calls: %+v", b.srv.Calls(""))
+	}
+
+	b.send(t, testOpChat, testOperator, "/history 1", "Client: Thanks")
+
+	b.send(t, testOpChat, testOperator, "/leave", "'Maxim(79111135900@s.whatsapp.net)' OK")
+	if _, ok := b.srv.WaitCall("sendMessage", testMainGroup, "@operator leave chat Maxim(79111135900)", testTimeout); !ok {
+		t.Errorf("leave not announced in main group")
+	}
+	if call, ok := b.srv.WaitCall("setChatTitle", testChat, "", testTimeout); !ok || call.Params.Get("title") != "H.W.Bot Free chat" {
+		t.Errorf("leave not reset chat title: %+v", call)
+	}
+}
+
+func TestService_Contact(t *testing.T) {
+	b := newTestBridge(t)
+	b.join(t)
+
+	b.srv.Reset()
+	b.wac.ReceiveContact("79111135900", "Ivan", "+7 911 000-00-01")
+	call, ok := b.srv.WaitCall("sendContact", testChat, "", testTimeout)
+	if !ok {
+		t.Fatalf("ReceiveContact() not relayed, calls: %+v", b.srv.Calls(""))
+	}
+	if call.Params.Get("phone_number") != "+7 911 000-00-01" || call.Params.Get("first_name") != "Ivan" {
+		t.Errorf("sendContact params = %v", call.Params)
+	}
+
+	b.srv.Reset()
+	b.wac.ReceiveContact("79111135901", "Olga", "+7 911 000-00-03")
+	if _, ok = b.srv.WaitCall("sendContact", testMainGroup, "", testTimeout); !ok {
+		t.Fatalf("ReceiveContact() in main group not relayed, calls: %+v", b.srv.Calls(""))
+	}
+	calls := b.srv.Calls("")
+	if len(calls) < 2 || calls[0].Method != "sendMessage" || !strings.HasPrefix(calls[0].Params.Get("text"), "Client ") ||
+		calls[1].Method != "sendContact" || calls[1].Params.Get("reply_to_message_id") == "" {
+		t.Errorf("ReceiveContact() in main group not labelled, calls: %+v", calls)
+	}
+
+	b.srv.PushUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: 1000,
+		From:      testOperator,
+		Chat:      testOpChat,
+		Date:      int(time.Now().Unix()),
+		Contact:   &tgbotapi.Contact{PhoneNumber: "+79110000002", FirstName: "Petr", LastName: "Petrov"},
+	}})
+	deadline := time.Now().Add(testTimeout)
+	for (b.wac.LastSent() == nil || b.wac.LastSent().Kind != "contact") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	last := b.wac.LastSent()
+	if last == nil || last.Text != "Petr Petrov" || !strings.Contains(last.VCard, "waid=79110000002:+79110000002") {
+		t.Errorf("SendContact() sent = %+v", last)
+	}
+}
+
+func TestService_Reply(t *testing.T) {
+	b := newTestBridge(t)
+	b.join(t)
+
+	b.srv.Reset()
+	questionID := b.wac.ReceiveText("79111135900", "Question")
+	call, ok := b.srv.WaitCall("sendMessage", testChat, "Question", testTimeout)
+	if !ok {
+		t.Fatalf("ReceiveText() not relayed, calls: %+v", b.srv.Calls(""))
+	}
+	var tgQuestionID int
+	if q, err := b.db.GetMessageByWA(questionID); err == nil && q != nil {
+		tgQuestionID = q.TGMessageID
+	}
+	if tgQuestionID == 0 {
+		t.Fatalf("GetMessageByWA() question not bridged: %+v", call)
+	}
+
+	b.srv.PushUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID:      1000,
+		From:           testOperator,
+		Chat:           testOpChat,
+		Date:           int(time.Now().Unix()),
+		Text:           "Answer",
+		ReplyToMessage: &tgbotapi.Message{MessageID: tgQuestionID, Chat: testOpChat},
+	}})
+	deadline := time.Now().Add(testTimeout)
+	for (b.wac.LastSent() == nil || b.wac.LastSent().Text != "Answer") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	answer := b.wac.LastSent()
+	if answer == nil || answer.QuotedID != questionID || answer.Quoted != "Question" {
+		t.Fatalf("SendMessage() quoted = %+v", answer)
+	}
+	b.waitStored(t, answer)
+
+	b.srv.Reset()
+	b.wac.Receive(&bridge.Inbound{Kind: bridge.KindText, Client: "79111135900", Text: "Thanks", QuotedID: answer.MessageID})
+	call, ok = b.srv.WaitCall("sendMessage", testChat, "Thanks", testTimeout)
+	if !ok || call.Params.Get("reply_to_message_id") != "1000" {
+		t.Errorf("Receive() quoted reply = %+v, %v", call, ok)
+	}
+}
+
+func TestService_Receipts(t *testing.T) {
+	b := newTestBridge(t)
+	b.join(t)
+
+	b.srv.Reset()
+	b.srv.PushMessage(testOpChat, testOperator, "Hello from operator")
+	if _, ok := b.srv.WaitCall("setMessageReaction", testChat, "", testTimeout); !ok {
+		t.Fatalf("sent message not marked, calls: %+v", b.srv.Calls(""))
+	}
+	last := b.wac.LastSent()
+
+	b.send(t, testOpChat, testOperator, "/receipts", "Hello from operator (sent)")
+
+	tests := []struct {
+		status   int
+		reaction string
+		want     string
+	}{
+		{status: api.MessageStatusDeliveryAck, reaction: "👌", want: "Hello from operator (delivered)"},
+		{status: api.MessageStatusServerAck, reaction: "", want: "Hello from operator (delivered)"},
+		{status: api.MessageStatusFailed, reaction: "💔", want: "Hello from operator (failed)"},
+		{status: api.MessageStatusRead, reaction: "👀", want: "All sent messages are read"},
+	}
+	for _, tt := range tests {
+		b.srv.Reset()
+		b.wac.Ack(last.MessageID, tt.status)
+		calls := b.srv.Calls("setMessageReaction")
+		if tt.reaction == "" && len(calls) != 0 {
+			t.Errorf("Ack(%d) reaction = %v, want none", tt.status, calls)
+		}
+		if tt.reaction != "" && (len(calls) != 1 || !strings.Contains(calls[0].Params.Get("reaction"), tt.reaction)) {
+			t.Errorf("Ack(%d) reaction = %v, want %s", tt.status, calls, tt.reaction)
+		}
+		b.send(t, testOpChat, testOperator, "/receipts", tt.want)
+	}
+
+	// messages stored without status are not reported as failed
+	chat, err := b.db.GetChatByClient("79111135900@s.whatsapp.net", "-100")
+	if err != nil || chat == nil {
+		t.Fatalf("GetChatByClient() = %+v, %v", chat, err)
+	}
+	err = b.db.SaveMessage(&api.Message{MGID: "-100", WAClient: chat.WAClient, WAMessageID: "legacy", TGChatID: testChat,
+		Session: chat.Session, Direction: api.DirectionTg2wa, Text: "Legacy"})
+	if err != nil {
+		t.Fatalf("SaveMessage() error = %v", err)
+	}
+	b.send(t, testOpChat, testOperator, "/receipts", "All sent messages are read")
+}
+
+func TestService_Revoke(t *testing.T) {
+	b := newTestBridge(t)
+	b.join(t)
+
+	b.srv.Reset()
+	id := b.wac.ReceiveText("79111135900", "Wrong <chat>")
+	if _, ok := b.srv.WaitCall("sendMessage", testChat, "Wrong <chat>", testTimeout); !ok {
+		t.Fatalf("ReceiveText() not relayed, calls: %+v", b.srv.Calls(""))
+	}
+	b.wac.ReceiveRevoke(id)
+	call, ok := b.srv.WaitCall("editMessageText", testChat, "<s>Wrong &lt;chat&gt;</s>", testTimeout)
+	if !ok || call.Params.Get("parse_mode") != "HTML" {
+		t.Errorf("ReceiveRevoke() not annotated, calls: %+v", b.srv.Calls(""))
+	}
+	if msg, _ := b.db.GetMessageByWA(id); msg == nil || msg.RevokeStatus != api.RevokeStatusRevoked || msg.RevokedBy != "client" {
+		t.Errorf("GetMessageByWA() = %+v", msg)
+	}
+
+	b.srv.Reset()
+	sent := b.srv.PushMessage(testOpChat, testOperator, "Sorry")
+	if _, ok = b.srv.WaitCall("setMessageReaction", testChat, "", testTimeout); !ok {
+		t.Fatalf("operator message not sent")
+	}
+
+	unsend := func(from *tgbotapi.User, replyTo *tgbotapi.Message, want string) {
+		t.Helper()
+		b.srv.Reset()
+		b.srv.PushUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+			MessageID:      sent.MessageID + 100,
+			From:           from,
+			Chat:           testOpChat,
+			Date:           int(time.Now().Unix()),
+			Text:           "/unsend",
+			Entities:       &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 7}},
+			ReplyToMessage: replyTo,
+		}})
+		if _, ok := b.srv.WaitCall("sendMessage", testChat, want, testTimeout); !ok {
+			t.Errorf("/unsend reply %v: want %q, calls: %+v", replyTo, want, b.srv.Calls(""))
+		}
+	}
+	unsend(testOther, sent, "Forbbiden, only author of message, Admin or Owner")
+	unsend(testOperator, sent, "Message unsent")
+	unsend(testAdmin, sent, "Message already unsent")
+	unsend(testOperator, nil, "Reply /unsend to your message")
+
+	last := b.wac.LastSent()
+	if revoked := b.wac.Revoked(); len(revoked) != 1 || revoked[0] != last.MessageID {
+		t.Errorf("Revoked() = %v, want [%s]", revoked, last.MessageID)
+	}
+	if msg, _ := b.db.GetMessageByWA(last.MessageID); msg == nil || msg.RevokeStatus != api.RevokeStatusRevoked || msg.RevokedBy != "operator" {
+		t.Errorf("GetMessageByWA() = %+v", msg)
+	}
+}
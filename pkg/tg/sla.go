@@ -0,0 +1,294 @@
+package tg
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// processSLA mention responsible operator or main group about clients waiting answer longer than
+// SLA and admins at escalation, return delay until next threshold. Waiting counts only working hours
+func (s *Service) processSLA(mgChatID int64) time.Duration {
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return outboxIdle
+	}
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		return outboxIdle
+	}
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		return outboxIdle
+	}
+
+	mg, err := db.GetMainGroupByTGID(mgChatID)
+	if err != nil {
+		log.Println("Error get MainGroup store: ", err)
+		return outboxIdle
+	}
+	if mg == nil || (mg.SLAFirst <= 0 && mg.SLANext <= 0 && mg.SLAEscalate <= 0) {
+		return outboxIdle
+	}
+	calendar, err := db.GetCalendar(wac.GetID())
+	if err != nil {
+		log.Println("Error get calendar store: ", err)
+		return outboxIdle
+	}
+
+	// not joined clients wait first answer, or next one when operator answered them before;
+	// clients of joined chats wait next answer since their first message after the last answer
+	type waiting struct {
+		client   string
+		operator string
+		kind     string
+		limit    time.Duration
+		first    *api.Message
+	}
+	var clients []waiting
+
+	items, err := db.GetNotChatted(mgChatID, s.bot.Self.UserName)
+	if err != nil {
+		log.Println("Error get not chatted store: ", err)
+		return outboxIdle
+	}
+	for _, item := range items {
+		if item == nil || strings.HasSuffix(item.WAClient, "@g.us") {
+			continue
+		}
+		chat, err := db.GetChatByClient(item.WAClient, wac.GetID())
+		if err != nil {
+			log.Println("Error get chat store: ", err)
+			continue
+		}
+		if chat != nil {
+			continue
+		}
+		first, err := s.waitingSince(db, wac.GetID(), item.WAClient)
+		if err != nil {
+			log.Println("Error get not chatted messages store: ", err)
+			continue
+		}
+		if first == nil {
+			continue
+		}
+		if item.TGUserName == "" {
+			clients = append(clients, waiting{item.WAClient, "", api.SLAFirst, mg.SLAFirst, first})
+		} else {
+			clients = append(clients, waiting{item.WAClient, item.TGUserName, api.SLANext, mg.SLANext, first})
+		}
+	}
+
+	chats, err := db.GetChatsByMGID(wac.GetID())
+	if err != nil {
+		log.Println("Error get chats store: ", err)
+		return outboxIdle
+	}
+	for _, chat := range chats {
+		if strings.HasSuffix(chat.WAClient, "@g.us") {
+			continue
+		}
+		first, err := db.GetWaitingInSession(wac.GetID(), chat.WAClient, chat.Session)
+		if err != nil {
+			log.Println("Error get waiting message store: ", err)
+			continue
+		}
+		if first == nil {
+			continue
+		}
+		clients = append(clients, waiting{chat.WAClient, chat.TGUserName, api.SLANext, mg.SLANext, first})
+	}
+
+	now := time.Now()
+	delay := outboxIdle
+	var offline map[string]bool
+	for _, item := range clients {
+		waited := calendar.WorkDuration(time.Unix(int64(item.first.WATimestamp), 0), now)
+		client := fmt.Sprintf("%s(%s)", wac.GetClientName(item.client), wac.GetShortClient(item.client))
+		for _, level := range []struct {
+			name  string
+			limit time.Duration
+		}{{api.SLABreached, item.limit}, {api.SLAEscalated, mg.SLAEscalate}} {
+			if level.limit <= 0 {
+				continue
+			}
+			if waited < level.limit {
+				// rest of the limit counts only working hours, wake up when they pass
+				if deadline := calendar.WorkDeadline(now, level.limit-waited); !deadline.IsZero() && deadline.Sub(now) < delay {
+					delay = deadline.Sub(now)
+				}
+				continue
+			}
+
+			created, err := db.SaveSLABreach(&api.SLABreach{
+				MGID:        wac.GetID(),
+				WAClient:    item.client,
+				WAMessageID: item.first.WAMessageID,
+				Kind:        item.kind,
+				Level:       level.name,
+				TGUserName:  item.operator,
+				Waited:      waited,
+			})
+			if err != nil {
+				log.Println("Error save SLA breach store: ", err)
+				continue
+			}
+			if !created {
+				continue
+			}
+
+			text := ""
+			if level.name == api.SLAEscalated {
+				text = fmt.Sprintf("🚨 %s client %s waits %s answer %s, SLA escalated", s.mentionAdmins(mgChatID), client, item.kind, waited.Round(time.Second))
+			} else {
+				if offline == nil {
+					offline = s.offlineOperators(db)
+				}
+				who := "Anyone?"
+				if item.operator != "" && !offline[item.operator] {
+					who = "@" + item.operator
+				}
+				text = fmt.Sprintf("⏰ %s client %s waits %s answer %s, SLA %s", who, client, item.kind, waited.Round(time.Second), level.limit)
+			}
+			if _, err = s.BotSend(tgbotapi.NewMessage(mgChatID, text)); err != nil {
+				log.Println("Error send SLA breach: ", err)
+			}
+		}
+	}
+	return delay
+}
+
+// waitingSince first not chatted message of client in main group
+func (s *Service) waitingSince(db api.Store, mgID, client string) (*api.Message, error) {
+	items, err := db.GetMessagesNotChattedByClient(client)
+	if err != nil {
+		return nil, err
+	}
+	var first *api.Message
+	for _, v := range items {
+		if v.MGID != mgID || v.Direction == api.DirectionTg2wa {
+			continue
+		}
+		if first == nil || v.WATimestamp < first.WATimestamp {
+			first = v
+		}
+	}
+	return first, nil
+}
+
+// mentionAdmins mention of human admins of main group
+func (s *Service) mentionAdmins(mgChatID int64) string {
+	members, err := s.bot.GetChatAdministrators(tgbotapi.ChatConfig{ChatID: mgChatID})
+	if err != nil {
+		log.Println("Error get admins of main group: ", err)
+	}
+	names := []string{}
+	for _, v := range members {
+		if v.User == nil || v.User.IsBot || v.User.UserName == "" {
+			continue
+		}
+		names = append(names, "@"+v.User.UserName)
+	}
+	if len(names) == 0 {
+		return "Admins,"
+	}
+	return strings.Join(names, " ")
+}
+
+func (s *Service) CommandSLA(update tgbotapi.Update) {
+
+	chatID := update.Message.Chat.ID
+
+	msg := tgbotapi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	if !s.IsMainGroup(chatID) {
+		msg.Text = "Command work only 'Main group'"
+		return
+	}
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+
+	mg, err := db.GetMainGroupByTGID(chatID)
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get main group, please send admin this error: %s", err)
+		return
+	}
+	if mg == nil {
+		msg.Text = "MainGroup not set, please /set name first"
+		return
+	}
+
+	args := strings.Fields(strings.ToLower(update.Message.CommandArguments()))
+	if len(args) == 0 {
+		if mg.SLAFirst <= 0 && mg.SLANext <= 0 && mg.SLAEscalate <= 0 {
+			msg.Text = "SLA: off"
+			return
+		}
+		msg.Text = fmt.Sprintf("SLA: first answer %s, next answer %s, escalate %s", slaLimit(mg.SLAFirst), slaLimit(mg.SLANext), slaLimit(mg.SLAEscalate))
+		return
+	}
+
+	if len(args) == 1 && args[0] == "off" {
+		mg.SLAFirst, mg.SLANext, mg.SLAEscalate = 0, 0, 0
+	} else if len(args) > 3 {
+		msg.Text = "Too many arguments, use /sla <first> <next> [escalate], e.g. /sla 15m 30m 2h or /sla off"
+		return
+	} else {
+		limits := []time.Duration{0, 0, 0}
+		for i, v := range args {
+			if v == "-" || v == "off" {
+				continue
+			}
+			limit, err := time.ParseDuration(v)
+			if err != nil || limit < 0 {
+				msg.Text = fmt.Sprintf("Fail parse SLA '%s', e.g. 15m, or - to skip", v)
+				return
+			}
+			limits[i] = limit
+		}
+		mg.SLAFirst, mg.SLANext, mg.SLAEscalate = limits[0], limits[1], limits[2]
+	}
+
+	member, err := s.bot.GetChatMember(tgbotapi.ChatConfigWithUser{
+		ChatID: chatID,
+		UserID: update.Message.From.ID,
+	})
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get member of main group, please send admin this error: %s", err)
+		return
+	}
+	if !(member.IsCreator() || member.IsAdministrator()) {
+		msg.Text = fmt.Sprintf("Forbbiden, only Admin or Owner")
+		return
+	}
+
+	if err = db.SaveMainGroup(mg); err != nil {
+		msg.Text = fmt.Sprintf("Fail set SLA, please send admin this error: %s", err)
+		log.Println("Error save mainGroup store: ", err)
+		return
+	}
+	msg.Text = "SLA Set: OK"
+	s.kickOutbox(chatID)
+}
+
+func slaLimit(limit time.Duration) string {
+	if limit <= 0 {
+		return "off"
+	}
+	return limit.String()
+}
@@ -0,0 +1,70 @@
+package tg
+
+import (
+	"strings"
+	"testing"
+	"tgwabr/pkg/wa/bridge"
+	"time"
+)
+
+func TestService_SLA(t *testing.T) {
+	b := newTestBridge(t)
+	b.send(t, testMGChat, testAdmin, "/set dubai", "MainGroup Set: OK")
+	b.wac.AddContact("79111135901", "Olga")
+
+	b.send(t, testMGChat, testAdmin, "/sla", "SLA: off")
+	b.send(t, testMGChat, testOperator, "/sla 15m 30m 1h", "Forbbiden, only Admin or Owner")
+	b.send(t, testMGChat, testAdmin, "/sla soon", "Fail parse SLA 'soon'")
+
+	now := time.Now()
+	b.wac.Receive(&bridge.Inbound{Kind: bridge.KindText, Client: "79111135900", Text: "Hello", Timestamp: uint64(now.Add(-20 * time.Minute).Unix())})
+	b.wac.Receive(&bridge.Inbound{Kind: bridge.KindText, Client: "79111135901", Text: "Hi", Timestamp: uint64(now.Add(-2 * time.Hour).Unix())})
+
+	b.send(t, testMGChat, testAdmin, "/sla 15m 30m 1h", "SLA Set: OK")
+	if _, ok := b.srv.WaitCall("sendMessage", testMainGroup, "⏰ Anyone? client Maxim(79111135900) waits first answer 20m", testTimeout); !ok {
+		t.Errorf("first answer breach not reported, calls: %+v", b.srv.Calls(""))
+	}
+	if _, ok := b.srv.WaitCall("sendMessage", testMainGroup, "🚨 @user10 client Olga(79111135901) waits first answer 2h", testTimeout); !ok {
+		t.Errorf("breach not escalated to admins, calls: %+v", b.srv.Calls(""))
+	}
+
+	b.send(t, testMGChat, testAdmin, "/sla", "SLA: first answer 15m0s, next answer 30m0s, escalate 1h0m0s")
+	b.send(t, testMGChat, testAdmin, "/sla 15m 30m 1h", "SLA Set: OK")
+	time.Sleep(100 * time.Millisecond)
+	for _, v := range b.srv.Calls("sendMessage") {
+		if strings.Contains(v.Params.Get("text"), "waits") {
+			t.Errorf("breach reported twice: %s", v.Params.Get("text"))
+		}
+	}
+
+	b.send(t, testOpChat, testAdmin, "/stat "+now.Format("2006-01-02"), "SLA compliance 0%: 2 clients, 1 breached, 1 escalated")
+}
+
+func TestService_SLANext(t *testing.T) {
+	b := newTestBridge(t)
+	b.join(t)
+
+	b.wac.ReceiveText("79111135900", "Hello")
+	b.srv.PushMessage(testOpChat, testOperator, "Hi, how can I help?")
+	b.waitStored(t, b.waitSent(t, "Hi, how can I help?"))
+
+	now := time.Now()
+	b.wac.Receive(&bridge.Inbound{Kind: bridge.KindText, Client: "79111135900", Text: "Where is my order?", Timestamp: uint64(now.Add(-40 * time.Minute).Unix())})
+	b.wac.Receive(&bridge.Inbound{Kind: bridge.KindText, Client: "79111135900", Text: "Hello?", Timestamp: uint64(now.Add(-35 * time.Minute).Unix())})
+
+	b.send(t, testMGChat, testAdmin, "/sla 15m 30m 1h", "SLA Set: OK")
+	if _, ok := b.srv.WaitCall("sendMessage", testMainGroup, "⏰ @operator client Maxim(79111135900) waits next answer 40m", testTimeout); !ok {
+		t.Fatalf("next answer breach of joined client not reported, calls: %+v", b.srv.Calls(""))
+	}
+
+	b.srv.Reset()
+	b.srv.PushMessage(testOpChat, testOperator, "On the way")
+	b.waitStored(t, b.waitSent(t, "On the way"))
+	b.send(t, testMGChat, testAdmin, "/sla 15m 30m 1h", "SLA Set: OK")
+	time.Sleep(100 * time.Millisecond)
+	for _, v := range b.srv.Calls("sendMessage") {
+		if strings.Contains(v.Params.Get("text"), "waits") {
+			t.Errorf("breach reported after answer: %s", v.Params.Get("text"))
+		}
+	}
+}
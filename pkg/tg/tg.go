@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"tgwabr/api"
 	"time"
 
@@ -15,15 +17,22 @@ import (
 )
 
 type Service struct {
-	ctx        context.Context
-	bot        *tgbotapi.BotAPI
-	mainGroups []int64
+	ctx          context.Context
+	bot          *tgbotapi.BotAPI
+	mainGroups   []int64
+	stop         chan struct{}
+	outbox       map[int64]chan struct{}
+	timers       map[int64]chan struct{}
+	outboxOnce   sync.Once
+	outboxConfig outboxConfig
+	threads      map[threadKey]thread
+	threadsMu    sync.Mutex
 	api.TG
 }
 
 func New(ctx context.Context) (service *Service, err error) {
 
-	service = &Service{ctx: ctx}
+	service = &Service{ctx: ctx, stop: make(chan struct{}), outbox: map[int64]chan struct{}{}, timers: map[int64]chan struct{}{}, outboxConfig: newOutboxConfig(), threads: map[threadKey]thread{}}
 
 	// return nil, nil
 
@@ -34,9 +43,15 @@ func New(ctx context.Context) (service *Service, err error) {
 			return service, fmt.Errorf("error parse ID: %w", err)
 		}
 		service.mainGroups = append(service.mainGroups, g)
+		service.outbox[g] = make(chan struct{}, 1)
+		service.timers[g] = make(chan struct{}, 1)
 	}
 
-	service.bot, err = tgbotapi.NewBotAPI(os.Getenv("TG_API_TOKEN"))
+	endpoint := os.Getenv("TG_API_ENDPOINT")
+	if endpoint == "" {
+		endpoint = tgbotapi.APIEndpoint
+	}
+	service.bot, err = tgbotapi.NewBotAPIWithClient(os.Getenv("TG_API_TOKEN"), endpoint, &threadsClient{service: service, client: &http.Client{}})
 	if err != nil {
 		return
 	}
@@ -57,6 +72,25 @@ func New(ctx context.Context) (service *Service, err error) {
 		{Command: "join", Description: "Join chat with WhatsApp client, e.g. /join +7(911) 113-59-00 minsk or /join Maxim dubai"},
 		{Command: "history", Description: "Show recent messages (by default 10 ones) from chat with WhatsApp client, e.g. /history or /history 20"},
 		{Command: "leave", Description: "Leave chat"},
+		{Command: "r", Description: "Send canned response to client, e.g. /r hi, or /r to choose from keyboard"},
+		{Command: "canned", Description: "Canned responses of main group, e.g. /canned add hi Hello {{.Client}}, I am {{.Operator}}, /canned del hi or /canned"},
+		{Command: "schedule", Description: "Send message to client later, time of main group /hours, e.g. /schedule tomorrow 9:00 Hello, /schedule 2h Hello, /schedule or /schedule cancel 12"},
+		{Command: "remind", Description: "Remind you about client later with snooze buttons, time of main group /hours, e.g. /remind 2h call back, /remind tomorrow 9:00 or /remind to list"},
+		{Command: "note", Description: "Add internal note on client not sent to WhatsApp, e.g. /note VIP, or /note to show notes; messages starting with // are notes too"},
+		{Command: "transfer", Description: "Hand over chat to another operator keeping the session, e.g. /transfer @username Client asks about delivery"},
+		{Command: "start", Description: "Register as operator in private chat with bot to get assigned clients"},
+		{Command: "online", Description: "Set you online to get clients, optionally away after inactivity, e.g. /online or /online 15m"},
+		{Command: "away", Description: "Set you away, new clients are not assigned to you"},
+		{Command: "offline", Description: "Set you offline, new clients are not assigned and your chats are offered to others"},
+		{Command: "roster", Description: "Show presence and open chats of operators of main group"},
+		{Command: "watch", Description: "Supervisor gets read-only copy of chats with client or of operator in private chat with bot, e.g. /watch +971 55 995 02 03 or /watch @username"},
+		{Command: "unwatch", Description: "Stop watch client or operator, e.g. /unwatch @username or /unwatch all"},
+		{Command: "supervisor", Description: "Grant supervisor role to operator, e.g. /supervisor @username or /supervisor @username off"},
+		{Command: "sla", Description: "Set answer SLA of main group, e.g. /sla 15m 30m 2h for first answer, next answer and escalation to admins, or /sla off"},
+		{Command: "campaign", Description: "Broadcast to clients of main group, e.g. /campaign preview active 30d tag vip, /campaign new active 30d tag vip; Text, /campaign start 1 or /campaign optout STOP"},
+		{Command: "assign", Description: "Auto-assign new clients to operators, e.g. /assign roundrobin 5m, /assign leastloaded, /assign last or /assign off"},
+		{Command: "unsend", Description: "Reply to your message to delete it in WhatsApp, Telegram does not tell bots about deleted messages"},
+		{Command: "receipts", Description: "Show sent messages not read by WhatsApp client yet"},
 		{Command: "status", Description: "Show connection status of Telegram main group to WhatsApp account"},
 		{Command: "login", Description: "Login to definite WhatsApp account"},
 		{Command: "set", Description: "Set Telegram main group name, e.g. /set dubai"},
@@ -65,7 +99,9 @@ func New(ctx context.Context) (service *Service, err error) {
 		{Command: "restart", Description: "Restart bot"},
 		{Command: "repined", Description: "Restore statistics in a pin"},
 		{Command: "somethingelse", Description: "Add keyboard for fast call join chat, e.g. /somethingelse [me|all|new|<username>] [all|<main group name>]"},
-		{Command: "autoreply", Description: "Set auto reply to incoming messages from not joined WhatsApp client, e.g. /autoreply all \"Autoreply text here\" or /autoreply +971 55 995 02 03 \"Autoreply text here\""},
+		{Command: "topics", Description: "Switch main group forum to one topic per WhatsApp client instead of joined chats, e.g. /topics on or /topics off"},
+		{Command: "hours", Description: "Show or set working hours of main group, e.g. /hours tz Asia/Dubai, /hours set 1-5 09:00-18:00; 6 10:00-14:00, /hours holiday add 2022-12-31"},
+		{Command: "autoreply", Description: "Auto reply to not joined WhatsApp clients, e.g. /autoreply add 17:30-8:00|1-5|*|1h; We are closed or /autoreply del 1, rule is time|weekdays|client|cooldown"},
 	})
 	if err != nil {
 		return
@@ -83,9 +119,11 @@ func New(ctx context.Context) (service *Service, err error) {
 
 func (s *Service) UpdateCTX(ctx context.Context) {
 	s.ctx = ctx
+	s.startOutbox()
 }
 
 func (s *Service) ShutDown() error {
+	close(s.stop)
 	s.bot.StopReceivingUpdates()
 	return nil
 }
@@ -202,7 +240,17 @@ func (s *Service) mainLoop(updates tgbotapi.UpdatesChannel) {
 			continue
 		}
 
+		if update.Message.NewChatMembers != nil || update.Message.LeftChatMember != nil {
+			s.HandleChatMembers(update)
+			continue
+		}
+
 		s.HandleTextMessage(update)
 	}
-	panic("Exit main loop")
+	select {
+	case <-s.stop:
+		return
+	default:
+		panic("Exit main loop")
+	}
 }
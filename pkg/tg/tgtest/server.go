@@ -0,0 +1,363 @@
+package tgtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Call request received by the fake Bot API
+type Call struct {
+	Method    string
+	Params    url.Values
+	File      []byte
+	MessageID int
+}
+
+// ChatID parse chat_id param of call
+func (c Call) ChatID() int64 {
+	id, _ := strconv.ParseInt(c.Params.Get("chat_id"), 10, 64)
+	return id
+}
+
+// Server fake Telegram Bot API server for end-to-end tests
+type Server struct {
+	*httptest.Server
+	Bot tgbotapi.User
+
+	mu        sync.Mutex
+	calls     []Call
+	updates   []tgbotapi.Update
+	notify    chan struct{}
+	updateID  int
+	messageID int
+	members   map[int64]map[int]string
+	threads   map[int]int
+}
+
+func NewServer() *Server {
+	s := &Server{
+		Bot:     tgbotapi.User{ID: 1, FirstName: "Bot", UserName: "test_bot", IsBot: true},
+		notify:  make(chan struct{}, 1),
+		members: map[int64]map[int]string{},
+		threads: map[int]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Endpoint API endpoint format for tgbotapi.NewBotAPIWithAPIEndpoint
+func (s *Server) Endpoint() string {
+	return s.URL + "/bot%s/%s"
+}
+
+// SetMember set member status ("member", "administrator", "creator", "left") of user in chat
+func (s *Server) SetMember(chatID int64, userID int, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.members[chatID] == nil {
+		s.members[chatID] = map[int]string{}
+	}
+	s.members[chatID][userID] = status
+}
+
+// PushUpdate queue update for getUpdates
+func (s *Server) PushUpdate(update tgbotapi.Update) {
+	s.mu.Lock()
+	s.updateID++
+	update.UpdateID = s.updateID
+	s.updates = append(s.updates, update)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// PushMessage queue incoming message, commands like Telegram ones get bot_command entity
+func (s *Server) PushMessage(chat *tgbotapi.Chat, from *tgbotapi.User, text string) *tgbotapi.Message {
+	s.mu.Lock()
+	s.messageID++
+	msg := &tgbotapi.Message{
+		MessageID: s.messageID,
+		From:      from,
+		Chat:      chat,
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+	s.mu.Unlock()
+	msg.Entities = commandEntities(text)
+	s.PushUpdate(tgbotapi.Update{Message: msg})
+	return msg
+}
+
+// commandEntities bot_command entity of text starting with command, like Telegram adds
+func commandEntities(text string) *[]tgbotapi.MessageEntity {
+	if len(text) > 1 && text[0] == '/' && (text[1] >= 'a' && text[1] <= 'z' || text[1] >= 'A' && text[1] <= 'Z') {
+		length := strings.IndexByte(text, ' ')
+		if length < 0 {
+			length = len(text)
+		}
+		return &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: length}}
+	}
+	return nil
+}
+
+// PushTopicMessage queue incoming message sent to forum topic, like Telegram it replies to the topic
+// root message and has message_thread_id
+func (s *Server) PushTopicMessage(chat *tgbotapi.Chat, from *tgbotapi.User, text string, threadID int) *tgbotapi.Message {
+	s.mu.Lock()
+	s.messageID++
+	msg := &tgbotapi.Message{
+		MessageID:      s.messageID,
+		From:           from,
+		Chat:           chat,
+		Date:           int(time.Now().Unix()),
+		Text:           text,
+		Entities:       commandEntities(text),
+		ReplyToMessage: &tgbotapi.Message{MessageID: threadID, Chat: chat},
+	}
+	s.threads[msg.MessageID] = threadID
+	s.mu.Unlock()
+	s.PushUpdate(tgbotapi.Update{Message: msg})
+	return msg
+}
+
+// PushReply queue incoming message replied to message
+func (s *Server) PushReply(chat *tgbotapi.Chat, from *tgbotapi.User, text string, replyToID int) *tgbotapi.Message {
+	s.mu.Lock()
+	s.messageID++
+	msg := &tgbotapi.Message{
+		MessageID:      s.messageID,
+		From:           from,
+		Chat:           chat,
+		Date:           int(time.Now().Unix()),
+		Text:           text,
+		ReplyToMessage: &tgbotapi.Message{MessageID: replyToID, Chat: chat},
+	}
+	s.mu.Unlock()
+	s.PushUpdate(tgbotapi.Update{Message: msg})
+	return msg
+}
+
+// PushCallback queue callback query pressed on message
+func (s *Server) PushCallback(message *tgbotapi.Message, from *tgbotapi.User, data string) {
+	s.mu.Lock()
+	s.updateID++
+	id := fmt.Sprintf("cb%d", s.updateID)
+	s.mu.Unlock()
+	s.PushUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      id,
+		From:    from,
+		Message: message,
+		Data:    data,
+	}})
+}
+
+// Calls return calls of method, all calls if method is empty
+func (s *Server) Calls(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []Call
+	for _, v := range s.calls {
+		if method == "" || v.Method == method {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// WaitCall wait call of method to chat matching text, return false on timeout
+func (s *Server) WaitCall(method string, chatID int64, contains string, timeout time.Duration) (Call, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		for _, v := range s.Calls(method) {
+			if chatID != 0 && v.ChatID() != chatID {
+				continue
+			}
+			if strings.Contains(v.Params.Get("text")+v.Params.Get("caption"), contains) {
+				return v, true
+			}
+		}
+		if time.Now().After(deadline) {
+			return Call{}, false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Reset forget recorded calls
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.URL.Path, "/")
+	method := parts[len(parts)-1]
+
+	call := Call{Method: method}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err == nil {
+			call.Params = url.Values(r.MultipartForm.Value)
+			for _, files := range r.MultipartForm.File {
+				if f, err := files[0].Open(); err == nil {
+					call.File, _ = ioutil.ReadAll(f)
+					_ = f.Close()
+				}
+			}
+		}
+	} else {
+		_ = r.ParseForm()
+		call.Params = r.PostForm
+	}
+
+	var result interface{} = true
+	switch method {
+	case "getMe":
+		result = s.Bot
+	case "getUpdates":
+		result = s.getUpdates(call.Params)
+	case "getChatMember":
+		result = s.getChatMember(call.Params)
+	case "getChatAdministrators":
+		result = s.getChatAdministrators(call.Params)
+	case "exportChatInviteLink":
+		result = fmt.Sprintf("https://t.me/joinchat/%s", call.Params.Get("chat_id"))
+	case "createChatInviteLink":
+		s.mu.Lock()
+		s.messageID++
+		result = map[string]interface{}{
+			"invite_link":  fmt.Sprintf("https://t.me/+%s-%d", call.Params.Get("chat_id"), s.messageID),
+			"member_limit": call.Params.Get("member_limit"),
+		}
+		s.mu.Unlock()
+	case "createForumTopic":
+		s.mu.Lock()
+		s.messageID++
+		result = map[string]interface{}{"message_thread_id": s.messageID, "name": call.Params.Get("name")}
+		s.mu.Unlock()
+	case "sendMessage", "sendPhoto", "sendDocument", "sendAudio", "sendVideo", "sendLocation", "sendContact", "editMessageText":
+		message := s.message(call)
+		call.MessageID = message.MessageID
+		result = message
+	}
+
+	if method != "getUpdates" {
+		s.mu.Lock()
+		s.calls = append(s.calls, call)
+		s.mu.Unlock()
+	}
+
+	raw, _ := json.Marshal(result)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: raw})
+}
+
+func (s *Server) getUpdates(params url.Values) []map[string]interface{} {
+	offset, _ := strconv.Atoi(params.Get("offset"))
+	deadline := time.After(100 * time.Millisecond)
+	for {
+		s.mu.Lock()
+		var res []tgbotapi.Update
+		for _, v := range s.updates {
+			if v.UpdateID >= offset {
+				res = append(res, v)
+			}
+		}
+		s.mu.Unlock()
+		if len(res) > 0 {
+			return s.withThreads(res)
+		}
+		select {
+		case <-s.notify:
+		case <-deadline:
+			return []map[string]interface{}{}
+		}
+	}
+}
+
+// withThreads add message_thread_id tgbotapi does not know to messages in forum topics
+func (s *Server) withThreads(updates []tgbotapi.Update) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]map[string]interface{}, 0, len(updates))
+	for _, v := range updates {
+		raw, _ := json.Marshal(v)
+		update := map[string]interface{}{}
+		_ = json.Unmarshal(raw, &update)
+		message, _ := update["message"].(map[string]interface{})
+		if query, ok := update["callback_query"].(map[string]interface{}); ok {
+			message, _ = query["message"].(map[string]interface{})
+		}
+		if message != nil {
+			id, _ := message["message_id"].(float64)
+			if threadID, ok := s.threads[int(id)]; ok {
+				message["message_thread_id"] = threadID
+				message["is_topic_message"] = true
+			}
+		}
+		res = append(res, update)
+	}
+	return res
+}
+
+func (s *Server) getChatMember(params url.Values) tgbotapi.ChatMember {
+	chatID, _ := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+	userID, _ := strconv.Atoi(params.Get("user_id"))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := "member"
+	if v, ok := s.members[chatID][userID]; ok {
+		status = v
+	}
+	return tgbotapi.ChatMember{User: &tgbotapi.User{ID: userID}, Status: status}
+}
+
+func (s *Server) getChatAdministrators(params url.Values) []tgbotapi.ChatMember {
+	chatID, _ := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := []tgbotapi.ChatMember{}
+	for userID, status := range s.members[chatID] {
+		if status == "administrator" || status == "creator" {
+			res = append(res, tgbotapi.ChatMember{User: &tgbotapi.User{ID: userID, UserName: fmt.Sprintf("user%d", userID)}, Status: status})
+		}
+	}
+	return res
+}
+
+func (s *Server) message(call Call) *tgbotapi.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messageID, _ := strconv.Atoi(call.Params.Get("message_id"))
+	if messageID == 0 {
+		s.messageID++
+		messageID = s.messageID
+		// replies land in topic of replied message
+		threadID, _ := strconv.Atoi(call.Params.Get("message_thread_id"))
+		if replyToID, _ := strconv.Atoi(call.Params.Get("reply_to_message_id")); threadID == 0 {
+			threadID = s.threads[replyToID]
+		}
+		if threadID != 0 {
+			s.threads[messageID] = threadID
+		}
+	}
+	return &tgbotapi.Message{
+		MessageID: messageID,
+		From:      &s.Bot,
+		Chat:      &tgbotapi.Chat{ID: call.ChatID()},
+		Date:      int(time.Now().Unix()),
+		Text:      call.Params.Get("text"),
+	}
+}
@@ -0,0 +1,180 @@
+package tg
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// threadTTL how long forum topic of received message is remembered, enough to handle the update
+const threadTTL = time.Hour
+
+// threadKey message of chat
+type threadKey struct {
+	chatID    int64
+	messageID int
+}
+
+// thread forum topic of message
+type thread struct {
+	id int
+	at time.Time
+}
+
+// threadMessage fields of message the Bot API library does not know about
+type threadMessage struct {
+	MessageID       int  `json:"message_id"`
+	MessageThreadID int  `json:"message_thread_id"`
+	IsTopicMessage  bool `json:"is_topic_message"`
+	Chat            struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+}
+
+// threadUpdate update with messages the Bot API library does not know forum topic of
+type threadUpdate struct {
+	Message       *threadMessage `json:"message"`
+	CallbackQuery *struct {
+		Message *threadMessage `json:"message"`
+	} `json:"callback_query"`
+}
+
+// threadsClient HTTP client of Bot API which remembers forum topics of received messages, as the
+// Bot API library does not know message_thread_id
+type threadsClient struct {
+	service *Service
+	client  *http.Client
+}
+
+func (c *threadsClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil || !strings.HasSuffix(req.URL.Path, "/getUpdates") {
+		return resp, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	var updates struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(body, &updates); err == nil && len(updates.Result) > 0 {
+		c.service.rememberThreads(updates.Result)
+	}
+	return resp, nil
+}
+
+// rememberThreads remember forum topics of messages of raw getUpdates result
+func (s *Service) rememberThreads(raw json.RawMessage) {
+	var updates []threadUpdate
+	if err := json.Unmarshal(raw, &updates); err != nil {
+		log.Println("Error parse topics of updates: ", err)
+		return
+	}
+	for _, v := range updates {
+		message := v.Message
+		if v.CallbackQuery != nil {
+			message = v.CallbackQuery.Message
+		}
+		if message != nil && message.IsTopicMessage {
+			s.rememberThread(message.Chat.ID, message.MessageID, message.MessageThreadID)
+		}
+	}
+}
+
+// rememberThread remember forum topic of message, forget expired ones
+func (s *Service) rememberThread(chatID int64, messageID, threadID int) {
+	if threadID == 0 {
+		return
+	}
+	s.threadsMu.Lock()
+	defer s.threadsMu.Unlock()
+	now := time.Now()
+	for k, v := range s.threads {
+		if now.Sub(v.at) > threadTTL {
+			delete(s.threads, k)
+		}
+	}
+	s.threads[threadKey{chatID: chatID, messageID: messageID}] = thread{id: threadID, at: now}
+}
+
+// messageThread forum topic of message, 0 when message is not in topic
+func (s *Service) messageThread(message *tgbotapi.Message) int {
+	s.threadsMu.Lock()
+	defer s.threadsMu.Unlock()
+	return s.threads[threadKey{chatID: message.Chat.ID, messageID: message.MessageID}].id
+}
+
+// topicChat chat with WhatsApp client for message sent to forum topic of main group, nil when
+// message is not in topic of client
+func (s *Service) topicChat(update tgbotapi.Update) *api.Chat {
+
+	threadID := s.messageThread(update.Message)
+	if threadID == 0 {
+		return nil
+	}
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return nil
+	}
+
+	chatID := update.Message.Chat.ID
+	mg, err := db.GetMainGroupByTGID(chatID)
+	if err != nil || mg == nil || !mg.Topics {
+		return nil
+	}
+
+	mgID := strconv.FormatInt(chatID, 10)
+	topic, err := db.GetTopicByThread(mgID, threadID)
+	if err != nil {
+		log.Println("Error get topic store: ", err)
+		return nil
+	}
+	if topic == nil {
+		return nil
+	}
+
+	return &api.Chat{
+		MGID:       mgID,
+		WAClient:   topic.WAClient,
+		TGChatID:   chatID,
+		TGUserName: update.Message.From.UserName,
+	}
+}
+
+// answerTopic mark messages of client answered by operator of topic, same as join does
+func (s *Service) answerTopic(db api.Store, chat *api.Chat) {
+
+	messages, err := db.GetMessagesNotChattedByClient(chat.WAClient)
+	if err != nil {
+		log.Println("Error get not chatted messages store: ", err)
+		return
+	}
+
+	for _, v := range messages {
+		if v.MGID != chat.MGID {
+			continue
+		}
+		v.TGUserName = chat.TGUserName
+		v.Chatted = api.ChattedYes
+		v.Answered = uint64(time.Now().Unix() - int64(v.WATimestamp))
+		if err = db.SaveMessage(v); err != nil {
+			log.Println("Error save topic message store: ", err)
+		}
+	}
+	if len(messages) > 0 {
+		s.UpdateStatMessage(1)
+	}
+}
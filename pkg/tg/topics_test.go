@@ -0,0 +1,69 @@
+package tg
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestService_Topics(t *testing.T) {
+	b := newTestBridge(t)
+	b.send(t, testMGChat, testAdmin, "/set dubai", "MainGroup Set: OK")
+	b.send(t, testMGChat, testOperator, "/topics on", "Forbbiden")
+	b.send(t, testMGChat, testAdmin, "/topics on", "Topics Set: OK")
+	b.send(t, testMGChat, testAdmin, "/set dubai", "MainGroup Set: OK")
+	b.send(t, testMGChat, testAdmin, "/topics", "Topics: on")
+
+	b.srv.Reset()
+	b.wac.ReceiveText("79111135900", "Hello")
+	call, ok := b.srv.WaitCall("sendMessage", testMainGroup, "Hello", testTimeout)
+	if !ok {
+		t.Fatalf("ReceiveText() not relayed, calls: %+v", b.srv.Calls(""))
+	}
+	topics := b.srv.Calls("createForumTopic")
+	if len(topics) != 1 || topics[0].Params.Get("name") != "Maxim(79111135900)" {
+		t.Fatalf("createForumTopic calls = %+v", topics)
+	}
+	if call.Params.Get("text") != "Hello" {
+		t.Errorf("topic message text = %q, want without client header", call.Params.Get("text"))
+	}
+	topic, err := b.db.GetTopicByClient("-100", "79111135900@s.whatsapp.net")
+	if err != nil || topic == nil || call.Params.Get("message_thread_id") != strconv.Itoa(topic.ThreadID) {
+		t.Fatalf("topic = %+v, %v, message message_thread_id = %s", topic, err, call.Params.Get("message_thread_id"))
+	}
+	if call.Params.Get("reply_to_message_id") != "" {
+		t.Errorf("topic message reply_to_message_id = %s, want none", call.Params.Get("reply_to_message_id"))
+	}
+
+	b.srv.Reset()
+	b.wac.ReceiveText("79111135900", "Are you there?")
+	if _, ok = b.srv.WaitCall("sendMessage", testMainGroup, "Are you there?", testTimeout); !ok || len(b.srv.Calls("createForumTopic")) != 0 {
+		t.Fatalf("second message not relayed to same topic, calls: %+v", b.srv.Calls(""))
+	}
+
+	b.srv.Reset()
+	b.srv.PushTopicMessage(testMGChat, testOperator, "Hi from topic", topic.ThreadID)
+	if _, ok = b.srv.WaitCall("setMessageReaction", testMainGroup, "", testTimeout); !ok {
+		t.Fatalf("topic message not sent, calls: %+v", b.srv.Calls(""))
+	}
+	last := b.wac.LastSent()
+	if last == nil || last.Text != "Hi from topic" || last.Client != "79111135900@s.whatsapp.net" {
+		t.Errorf("LastSent() = %+v, want topic message to client", last)
+	}
+
+	b.srv.Reset()
+	b.srv.PushTopicMessage(testMGChat, testOperator, "/r", topic.ThreadID)
+	if _, ok = b.srv.WaitCall("sendMessage", testMainGroup, "Canned responses not set", testTimeout); !ok {
+		t.Fatalf("/r in topic not answered, calls: %+v", b.srv.Calls(""))
+	}
+
+	b.srv.Reset()
+	b.srv.PushTopicMessage(testMGChat, testOperator, "Unknown topic", 999)
+	// reply to client message outside of topic is not routed by guess
+	b.srv.PushReply(testMGChat, testOperator, "Reply to client message", call.MessageID)
+	b.srv.PushMessage(testMGChat, testOperator, "Plain chatter")
+	time.Sleep(100 * time.Millisecond)
+	if got := len(b.wac.Sent()); got != 1 {
+		t.Errorf("main group chatter sent to WhatsApp, sent = %d", got)
+	}
+}
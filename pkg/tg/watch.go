@@ -0,0 +1,316 @@
+package tg
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// MirrorMessage send read-only copy of bridged message to private chats of supervisors watching client or operator
+func (s *Service) MirrorMessage(message *api.Message) {
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return
+	}
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		return
+	}
+	mgChatID, _ := strconv.ParseInt(message.MGID, 10, 64)
+	wac, ok := waSvc.GetInstance(mgChatID)
+	if !ok {
+		return
+	}
+
+	watches, err := db.GetWatches(message.MGID)
+	if err != nil {
+		log.Println("Error get watches store: ", err)
+		return
+	}
+	if len(watches) == 0 {
+		return
+	}
+
+	operator := ""
+	if message.Direction == api.DirectionTg2wa {
+		operator = message.TGUserName
+	} else {
+		chat, err := db.GetChatByClient(message.WAClient, message.MGID)
+		if err != nil {
+			log.Println("Error get chat store: ", err)
+		} else if chat != nil {
+			operator = chat.TGUserName
+		}
+	}
+
+	client := fmt.Sprintf("%s(%s)", wac.GetClientName(message.WAClient), wac.GetShortClient(message.WAClient))
+	to := "main group"
+	if operator != "" {
+		to = "@" + operator
+	}
+	header := fmt.Sprintf("👁 %s → %s", client, to)
+	if message.Direction == api.DirectionTg2wa {
+		header = fmt.Sprintf("👁 %s → %s", to, client)
+	}
+
+	sent := map[int]bool{}
+	for _, v := range watches {
+		if sent[v.TGUserID] {
+			continue
+		}
+		if v.WAClient != message.WAClient && (v.Operator == "" || !strings.EqualFold(v.Operator, operator)) {
+			continue
+		}
+		sent[v.TGUserID] = true
+		if _, err = s.BotSend(tgbotapi.NewMessage(int64(v.TGUserID), fmt.Sprintf("%s:\n%s", header, message.Text))); err != nil {
+			log.Println("Error mirror message: ", err)
+		}
+	}
+}
+
+// isSupervisor admin of main group or operator granted supervisor by admin
+func (s *Service) isSupervisor(db api.Store, mgChatID int64, userID int) bool {
+	member, err := s.bot.GetChatMember(tgbotapi.ChatConfigWithUser{
+		ChatID: mgChatID,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Println("Fail get member of main group", err)
+		return false
+	}
+	if member.IsCreator() || member.IsAdministrator() {
+		return true
+	}
+	if !member.IsMember() {
+		return false
+	}
+	operator, err := db.GetOperator(userID)
+	if err != nil {
+		log.Println("Error get operator store: ", err)
+		return false
+	}
+	return operator != nil && operator.Supervisor
+}
+
+// CommandSupervisor grant or revoke supervisor role to registered operator, e.g. /supervisor @username [off]
+func (s *Service) CommandSupervisor(update tgbotapi.Update) {
+
+	chatID := update.Message.Chat.ID
+
+	msg := tgbotapi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	if !s.IsMainGroup(chatID) {
+		msg.Text = "Command work only 'Main group'"
+		return
+	}
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+
+	operators, err := db.GetOperators()
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get operators, please send admin this error: %s", err)
+		return
+	}
+
+	args := strings.Fields(strings.ToLower(update.Message.CommandArguments()))
+	if len(args) == 0 {
+		names := []string{}
+		for _, v := range operators {
+			if v.Supervisor {
+				names = append(names, "@"+v.TGUserName)
+			}
+		}
+		msg.Text = fmt.Sprintf("Supervisors: admins of main group and %s", strings.Join(names, ", "))
+		if len(names) == 0 {
+			msg.Text = "Supervisors: admins of main group"
+		}
+		return
+	}
+	if len(args) > 2 || !strings.HasPrefix(args[0], "@") || (len(args) == 2 && args[1] != "off") {
+		msg.Text = "Use /supervisor @username to grant or /supervisor @username off to revoke"
+		return
+	}
+
+	member, err := s.bot.GetChatMember(tgbotapi.ChatConfigWithUser{
+		ChatID: chatID,
+		UserID: update.Message.From.ID,
+	})
+	if err != nil {
+		msg.Text = fmt.Sprintf("Fail get member of main group, please send admin this error: %s", err)
+		return
+	}
+	if !(member.IsCreator() || member.IsAdministrator()) {
+		msg.Text = fmt.Sprintf("Forbbiden, only Admin or Owner")
+		return
+	}
+
+	userName := strings.TrimPrefix(args[0], "@")
+	var operator *api.Operator
+	for _, v := range operators {
+		if strings.ToLower(v.TGUserName) == userName {
+			operator = v
+		}
+	}
+	if operator == nil {
+		msg.Text = fmt.Sprintf("Operator @%s not found, ask to send /start to bot", userName)
+		return
+	}
+
+	operator.Supervisor = len(args) == 1
+	if err = db.SaveOperator(operator); err != nil {
+		msg.Text = fmt.Sprintf("Fail set supervisor, please send admin this error: %s", err)
+		return
+	}
+	if !operator.Supervisor {
+		// revoked supervisor keeps watches only in main groups administered by the operator
+		for _, v := range s.mainGroups {
+			if s.isSupervisor(db, v, operator.TGUserID) {
+				continue
+			}
+			if _, err = db.DeleteWatches(strconv.FormatInt(v, 10), operator.TGUserID, "", ""); err != nil {
+				msg.Text = fmt.Sprintf("Fail stop watches of supervisor, please send admin this error: %s", err)
+				return
+			}
+		}
+	}
+	msg.Text = "Supervisor Set: OK"
+}
+
+// CommandWatch watch client or operator from main group, e.g. /watch +971 55 995 02 03 or /watch @username
+func (s *Service) CommandWatch(update tgbotapi.Update) {
+	s.watch(update, true)
+}
+
+// CommandUnwatch stop watch client or operator, /unwatch all stops all watches
+func (s *Service) CommandUnwatch(update tgbotapi.Update) {
+	s.watch(update, false)
+}
+
+func (s *Service) watch(update tgbotapi.Update, on bool) {
+
+	chatID := update.Message.Chat.ID
+	from := update.Message.From
+
+	msg := tgbotapi.NewMessage(chatID, "")
+	defer func() {
+		if msg.Text != "" {
+			_, _ = s.BotSend(msg)
+		}
+	}()
+
+	if !s.IsMainGroup(chatID) {
+		msg.Text = "Command work only 'Main group'"
+		return
+	}
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		msg.Text = "Module Store not ready"
+		return
+	}
+	waSvc, ok := appCtx.FromWA(s.ctx)
+	if !ok {
+		msg.Text = "Module WhatsApp not ready"
+		return
+	}
+	wac, ok := waSvc.GetInstance(chatID)
+	if !ok {
+		msg.Text = "Instance WhatsApp not ready"
+		return
+	}
+
+	if !s.isSupervisor(db, chatID, from.ID) {
+		msg.Text = "Forbbiden, only Admin, Owner or Supervisor"
+		return
+	}
+
+	args := strings.TrimSpace(update.Message.CommandArguments())
+	if args == "" {
+		watches, err := db.GetWatches(wac.GetID())
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail get watches, please send admin this error: %s", err)
+			return
+		}
+		names := []string{}
+		for _, v := range watches {
+			if v.TGUserID != from.ID {
+				continue
+			}
+			if v.Operator != "" {
+				names = append(names, "@"+v.Operator)
+			} else {
+				names = append(names, fmt.Sprintf("%s(%s)", wac.GetClientName(v.WAClient), wac.GetShortClient(v.WAClient)))
+			}
+		}
+		if len(names) == 0 {
+			msg.Text = "No watches, use /watch +971 55 995 02 03 or /watch @username"
+			return
+		}
+		msg.Text = "Watch: " + strings.Join(names, ", ")
+		return
+	}
+
+	watch := &api.Watch{MGID: wac.GetID(), TGUserID: from.ID, TGUserName: from.UserName}
+	target := ""
+	if strings.HasPrefix(args, "@") {
+		watch.Operator = strings.ToLower(strings.TrimPrefix(strings.Fields(args)[0], "@"))
+		target = "@" + watch.Operator
+	} else if !on && strings.ToLower(args) == "all" {
+		target = "all"
+	} else {
+		client := s.prepareClient(strings.ToLower(args))
+		if !wac.ClientExist(client) {
+			aliases, err := db.GetAliasesByName(client)
+			if err != nil {
+				msg.Text = fmt.Sprintf("Fail get Alias '%s', please send admin this error: %s", client, err)
+				return
+			}
+			for _, v := range aliases {
+				if v.MGID == wac.GetID() {
+					client = v.WAClient
+				}
+			}
+		}
+		if !wac.ClientExist(client) {
+			msg.Text = fmt.Sprintf("Client '%s' not found", client)
+			return
+		}
+		watch.WAClient = wac.PrepareClientJID(client)
+		target = fmt.Sprintf("%s(%s)", wac.GetClientName(watch.WAClient), wac.GetShortClient(watch.WAClient))
+	}
+
+	if !on {
+		count, err := db.DeleteWatches(watch.MGID, watch.TGUserID, watch.WAClient, watch.Operator)
+		if err != nil {
+			msg.Text = fmt.Sprintf("Fail unwatch, please send admin this error: %s", err)
+			return
+		}
+		if count == 0 {
+			msg.Text = fmt.Sprintf("Watch %s not found", target)
+			return
+		}
+		msg.Text = fmt.Sprintf("Unwatch %s OK", target)
+		return
+	}
+
+	if err := db.SaveWatch(watch); err != nil {
+		msg.Text = fmt.Sprintf("Fail watch, please send admin this error: %s", err)
+		return
+	}
+	msg.Text = fmt.Sprintf("Watch %s OK, messages come to private chat with bot, send /start there first", target)
+}
@@ -0,0 +1,56 @@
+package tg
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestService_Watch(t *testing.T) {
+	b := newTestBridge(t)
+	b.join(t)
+	adminChat := int64(testAdmin.ID)
+	operatorChat := &tgbotapi.Chat{ID: int64(testOperator.ID), Type: "private"}
+
+	b.send(t, testMGChat, testOperator, "/watch @other", "Forbbiden, only Admin, Owner or Supervisor")
+	b.send(t, testMGChat, testAdmin, "/watch +7(911)113-59-00", "Watch Maxim(79111135900) OK")
+	b.send(t, testMGChat, testAdmin, "/watch", "Watch: Maxim(79111135900)")
+
+	b.srv.Reset()
+	b.wac.ReceiveText("79111135900", "Hello")
+	if _, ok := b.srv.WaitCall("sendMessage", adminChat, "👁 Maxim(79111135900) → @operator:\nHello", testTimeout); !ok {
+		t.Fatalf("wa2tg message not mirrored, calls: %+v", b.srv.Calls(""))
+	}
+	b.srv.PushMessage(testOpChat, testOperator, "Answer")
+	if _, ok := b.srv.WaitCall("sendMessage", adminChat, "👁 @operator → Maxim(79111135900):\nAnswer", testTimeout); !ok {
+		t.Fatalf("tg2wa message not mirrored, calls: %+v", b.srv.Calls(""))
+	}
+
+	b.send(t, testMGChat, testAdmin, "/supervisor @operator", "Operator @operator not found")
+	b.send(t, operatorChat, testOperator, "/start", "New clients assigned to you will come here")
+	b.send(t, testMGChat, testAdmin, "/supervisor @operator", "Supervisor Set: OK")
+	b.send(t, testMGChat, testAdmin, "/supervisor", "Supervisors: admins of main group and @operator")
+	b.send(t, testMGChat, testOperator, "/watch @other", "Watch @other OK")
+	b.send(t, testMGChat, testAdmin, "/supervisor @operator off", "Supervisor Set: OK")
+	b.send(t, testMGChat, testOperator, "/watch", "Forbbiden, only Admin, Owner or Supervisor")
+	if watches, err := b.db.GetWatches("-100"); err != nil || len(watches) != 1 || watches[0].TGUserID != testAdmin.ID {
+		t.Fatalf("GetWatches() after revoke = %+v, %v, want only watch of admin", watches, err)
+	}
+	b.send(t, testMGChat, testAdmin, "/supervisor @operator", "Supervisor Set: OK")
+	b.send(t, testMGChat, testOperator, "/watch @Other", "Watch @other OK")
+	b.send(t, testMGChat, testAdmin, "/unwatch all", "Unwatch all OK")
+	b.send(t, testMGChat, testAdmin, "/unwatch all", "Watch all not found")
+	b.send(t, &tgbotapi.Chat{ID: int64(testOther.ID), Type: "private"}, testOther, "/start", "New clients assigned to you will come here")
+	b.send(t, testOpChat, testOperator, "/transfer @other", "@other takes it over by invite link")
+
+	b.srv.Reset()
+	b.wac.ReceiveText("79111135900", "Again")
+	if _, ok := b.srv.WaitCall("sendMessage", operatorChat.ID, "👁 Maxim(79111135900) → @other:\nAgain", testTimeout); !ok {
+		t.Fatalf("message of watched operator not mirrored, calls: %+v", b.srv.Calls(""))
+	}
+	for _, v := range b.srv.Calls("sendMessage") {
+		if v.ChatID() == adminChat {
+			t.Errorf("message mirrored after unwatch: %s", v.Params.Get("text"))
+		}
+	}
+}
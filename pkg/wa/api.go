@@ -9,6 +9,7 @@ import (
 	"tgwabr/api"
 	appCtx "tgwabr/context"
 	"tgwabr/pkg"
+	"tgwabr/pkg/wa/bridge"
 	"time"
 
 	"github.com/cristalinojr/go-whatsapp"
@@ -16,7 +17,7 @@ import (
 	waproto "go.mau.fi/whatsmeow/binary/proto"
 )
 
-func (s *Instance) ReadMessage(client, messageID string) (err error) {
+func (s *Instance) ReadMessage(client, _, messageID string) (err error) {
 	jid := s.PrepareClientJID(client)
 	ch, err := s.conn.Read(jid, messageID)
 	if err != nil {
@@ -93,6 +94,9 @@ func (s *Instance) DoLogout() (bool, error) {
 			err = s.writeSession(session)
 		}
 	}
+	if err == nil {
+		s.supervisor.LoggedOut(nil)
+	}
 	if err != nil {
 		log.Println("WAInstance error logout: ", err)
 		return false, err
@@ -100,6 +104,10 @@ func (s *Instance) DoLogout() (bool, error) {
 	return true, nil
 }
 
+func (s *Instance) GetConnectionState() api.ConnectionState {
+	return s.supervisor.State()
+}
+
 func (s *Instance) ClientExist(client string) bool {
 	jid := s.PrepareClientJID(client)
 	_, ok := s.conn.Store.Contacts[jid]
@@ -381,6 +389,49 @@ func (s *Instance) SendLocation(client string, lat, lon float64, QuotedID string
 	}, nil
 }
 
+func (s *Instance) SendContact(client, name, phone string, QuotedID string, Quoted string) (msg *api.WAMessage, err error) {
+
+	client = s.PrepareClientJID(client)
+	card := bridge.VCard{Name: name, Phones: []string{phone}}
+	item := whatsapp.ContactMessage{
+		Info: whatsapp.MessageInfo{
+			RemoteJid: client,
+		},
+		DisplayName: name,
+		Vcard:       card.String(),
+	}
+	if len(QuotedID) != 0 {
+		msgQuotedProto := waproto.Message{
+			Conversation: &Quoted,
+		}
+
+		ctxQuotedInfo := whatsapp.ContextInfo{
+			QuotedMessageID: QuotedID,
+			QuotedMessage:   &msgQuotedProto,
+			Participant:     client,
+		}
+
+		item.ContextInfo = ctxQuotedInfo
+	}
+
+	msgId, err := s.conn.Send(item)
+	if err != nil {
+		return nil, err
+	}
+	name = s.GetClientName(client)
+	return &api.WAMessage{
+		Client:    client,
+		Name:      name,
+		MessageID: msgId,
+		Timestamp: uint64(time.Now().Unix()),
+	}, nil
+}
+
+func (s *Instance) RevokeMessage(client, messageID string, fromMe bool) (err error) {
+	_, err = s.conn.RevokeMessage(s.PrepareClientJID(client), messageID, fromMe)
+	return
+}
+
 type historyHandler struct {
 	s *Instance
 }
@@ -613,5 +664,5 @@ func (s *Instance) sendStatusReady() {
 		return
 	}
 
-	_, _ = tg.SendMessage(s.id, "Bot is sync... check /status")
+	_, _ = tg.SendMessage(s.id, "Bot is sync... check /status", 0, 0)
 }
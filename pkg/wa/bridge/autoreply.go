@@ -0,0 +1,206 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"time"
+)
+
+// DefaultAutoReplyCooldown client gets no more than one auto reply in this period
+const DefaultAutoReplyCooldown = time.Hour
+
+// AutoReplyRule parsed rule "window|weekdays|client|cooldown", every part may be "*"
+//
+//	17:30-8:00|1-5|*|1h  - working days from 17:30 till 8:00 to all clients, once per hour
+//	*|6,7|971559950203|* - weekend to one client, once per default cooldown
+type AutoReplyRule struct {
+	From     time.Duration
+	To       time.Duration
+	AnyTime  bool
+	Weekdays map[time.Weekday]bool
+	Client   string
+	Cooldown time.Duration
+}
+
+// ParseAutoReplyRule parse rule, missed tail parts are "*"
+func ParseAutoReplyRule(spec string) (*AutoReplyRule, error) {
+	rule := &AutoReplyRule{AnyTime: true, Cooldown: DefaultAutoReplyCooldown}
+
+	parts := strings.Split(strings.TrimSpace(spec), "|")
+	if len(parts) > 4 {
+		return nil, fmt.Errorf("rule '%s' has more than 4 parts", spec)
+	}
+	for len(parts) < 4 {
+		parts = append(parts, "*")
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	if parts[0] != "*" {
+		bounds := strings.Split(parts[0], "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("time window '%s' is not in format HH:MM-HH:MM", parts[0])
+		}
+		var err error
+		if rule.From, err = api.ParseClock(bounds[0]); err != nil {
+			return nil, err
+		}
+		if rule.To, err = api.ParseClock(bounds[1]); err != nil {
+			return nil, err
+		}
+		rule.AnyTime = false
+	}
+
+	if parts[1] != "*" {
+		rule.Weekdays = map[time.Weekday]bool{}
+		for _, item := range strings.Split(parts[1], ",") {
+			bounds := strings.Split(strings.TrimSpace(item), "-")
+			if len(bounds) > 2 {
+				return nil, fmt.Errorf("weekdays '%s' is not in format 1-5 or 1,3,5", parts[1])
+			}
+			start, err := strconv.Atoi(bounds[0])
+			if err != nil || start < 1 || start > 7 {
+				return nil, fmt.Errorf("weekday '%s' is not between 1 and 7", bounds[0])
+			}
+			end := start
+			if len(bounds) == 2 {
+				end, err = strconv.Atoi(bounds[1])
+				if err != nil || end < start || end > 7 {
+					return nil, fmt.Errorf("weekday '%s' is not between %d and 7", bounds[1], start)
+				}
+			}
+			for day := start; day <= end; day++ {
+				rule.Weekdays[time.Weekday(day%7)] = true
+			}
+		}
+	}
+
+	if parts[2] != "*" {
+		rule.Client = digits(parts[2])
+		if rule.Client == "" {
+			return nil, fmt.Errorf("client '%s' is not a phone number", parts[2])
+		}
+	}
+
+	if parts[3] != "*" {
+		cooldown, err := time.ParseDuration(parts[3])
+		if err != nil || cooldown < 0 {
+			return nil, fmt.Errorf("cooldown '%s' is not a duration, e.g. 30m or 24h", parts[3])
+		}
+		rule.Cooldown = cooldown
+	}
+
+	return rule, nil
+}
+
+// Match rule for message of client (JID or phone) at now, window wraps over midnight when From > To
+func (r *AutoReplyRule) Match(now time.Time, client string) bool {
+	if r.Client != "" && r.Client != digits(strings.Split(client, "@")[0]) {
+		return false
+	}
+
+	day := now.Weekday()
+	clock := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	if !r.AnyTime && r.From > r.To && clock < r.To {
+		// night part of window belongs to the day it started
+		day = (day + 6) % 7
+	}
+	if r.Weekdays != nil && !r.Weekdays[day] {
+		return false
+	}
+
+	if r.AnyTime {
+		return true
+	}
+	if r.From <= r.To {
+		return clock >= r.From && clock < r.To
+	}
+	return clock >= r.From || clock < r.To
+}
+
+func digits(value string) string {
+	builder := strings.Builder{}
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// AutoReply send text of first matched rule to client without joined chat, client gets one reply of rule per cooldown
+func AutoReply(ctx context.Context, wac api.WAInstance, in *Inbound) {
+
+	if in.FromMe || strings.HasSuffix(in.Client, "@g.us") {
+		return
+	}
+
+	db, ok := appCtx.FromDB(ctx)
+	if !ok {
+		return
+	}
+
+	chat, err := db.GetChatByClient(in.Client, wac.GetID())
+	if err != nil {
+		log.Println("Get chat store error: ", err)
+		return
+	}
+	if chat != nil {
+		return
+	}
+
+	items, err := db.GetAutoReplies(wac.GetID())
+	if err != nil {
+		log.Println("Get auto replies store error: ", err)
+		return
+	}
+
+	// windows and weekdays of rules are in timezone of main group /hours
+	now := time.Now()
+	calendar, err := db.GetCalendar(wac.GetID())
+	if err != nil {
+		log.Println("Get calendar store error: ", err)
+	}
+	if calendar != nil {
+		now = now.In(calendar.Location())
+	}
+	for _, item := range items {
+		rule, err := ParseAutoReplyRule(item.Rule)
+		if err != nil {
+			log.Println("Parse auto reply rule error: ", err)
+			continue
+		}
+		if !rule.Match(now, in.Client) {
+			continue
+		}
+
+		sent, err := db.GetAutoReplySent(wac.GetID(), in.Client, item.ID)
+		if err != nil {
+			log.Println("Get auto reply sent store error: ", err)
+			return
+		}
+		if sent != nil && now.Sub(sent.At) < rule.Cooldown {
+			return
+		}
+
+		// cooldown starts only with delivered reply, failed one is tried again on next message
+		if _, err = wac.SendMessage(in.Client, item.Text, "", ""); err != nil {
+			log.Println("Send auto reply error: ", err)
+			return
+		}
+		if sent == nil {
+			sent = &api.AutoReplySent{MGID: wac.GetID(), WAClient: in.Client, AutoReplyID: item.ID}
+		}
+		sent.At = now
+		if err = db.SaveAutoReplySent(sent); err != nil {
+			log.Println("Save auto reply sent store error: ", err)
+		}
+		return
+	}
+}
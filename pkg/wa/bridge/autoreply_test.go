@@ -0,0 +1,74 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAutoReplyRule_Match(t *testing.T) {
+	// 2022-03-07 is Monday
+	at := func(day int, clock string) time.Time {
+		v, _ := time.Parse("15:04", clock)
+		return time.Date(2022, 3, day, v.Hour(), v.Minute(), 0, 0, time.Local)
+	}
+	tests := []struct {
+		name   string
+		spec   string
+		now    time.Time
+		client string
+		want   bool
+	}{
+		{name: "all", spec: "*", now: at(7, "12:00"), client: "79111135900@s.whatsapp.net", want: true},
+		{name: "day window inside", spec: "9:00-18:00", now: at(7, "17:59"), want: true},
+		{name: "day window end", spec: "9:00-18:00", now: at(7, "18:00"), want: false},
+		{name: "night window evening", spec: "17:30-8:00|1-5", now: at(7, "20:00"), want: true},
+		{name: "night window morning", spec: "17:30-8:00|1-5", now: at(8, "07:00"), want: true},
+		{name: "night window day", spec: "17:30-8:00|1-5", now: at(8, "12:00"), want: false},
+		{name: "night of friday on saturday", spec: "17:30-8:00|5", now: at(12, "07:00"), want: true},
+		{name: "night of friday on friday morning", spec: "17:30-8:00|5", now: at(11, "07:00"), want: false},
+		{name: "weekend sunday", spec: "*|6,7", now: at(13, "12:00"), want: true},
+		{name: "weekend monday", spec: "*|6,7", now: at(7, "12:00"), want: false},
+		{name: "client match", spec: "*|*|+7 (911) 113-59-00", client: "79111135900@s.whatsapp.net", now: at(7, "12:00"), want: true},
+		{name: "client other", spec: "*|*|+7 (911) 113-59-00", client: "79111135901@s.whatsapp.net", now: at(7, "12:00"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseAutoReplyRule(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseAutoReplyRule() error = %v", err)
+			}
+			if got := rule.Match(tt.now, tt.client); got != tt.want {
+				t.Errorf("Match(%s) = %v, want %v", tt.now.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAutoReplyRule(t *testing.T) {
+	tests := []struct {
+		spec     string
+		cooldown time.Duration
+		wantErr  bool
+	}{
+		{spec: "17:30-8:00|1-7|*|*", cooldown: DefaultAutoReplyCooldown},
+		{spec: "*|*|*|30m", cooldown: 30 * time.Minute},
+		{spec: "25:00-8:00", wantErr: true},
+		{spec: "17:30", wantErr: true},
+		{spec: "*|0-5", wantErr: true},
+		{spec: "*|5-1", wantErr: true},
+		{spec: "*|*|maxim", wantErr: true},
+		{spec: "*|*|*|soon", wantErr: true},
+		{spec: "*|*|*|*|*", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			rule, err := ParseAutoReplyRule(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAutoReplyRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && rule.Cooldown != tt.cooldown {
+				t.Errorf("ParseAutoReplyRule() cooldown = %v, want %v", rule.Cooldown, tt.cooldown)
+			}
+		})
+	}
+}
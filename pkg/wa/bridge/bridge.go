@@ -0,0 +1,267 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"time"
+)
+
+// Kinds of WhatsApp messages relayed to Telegram
+const (
+	KindText     = "text"
+	KindImage    = "image"
+	KindDocument = "document"
+	KindAudio    = "audio"
+	KindVideo    = "video"
+	KindLocation = "location"
+	KindContact  = "contact"
+)
+
+// Inbound WhatsApp message normalized by a backend before relay to Telegram
+type Inbound struct {
+	Kind      string
+	ID        string
+	Client    string
+	Name      string
+	From      string
+	FromName  string
+	FromMe    bool
+	Owner     string
+	Timestamp uint64
+	Status    int
+	QuotedID  string
+	Text      string
+	Caption   string
+	FileName  string
+	Lat       float64
+	Lon       float64
+	VCard     string
+	Download  func() ([]byte, error)
+}
+
+// Handle store inbound message and relay it to the joined chat or the main group
+func Handle(ctx context.Context, wac api.WAInstance, in *Inbound, doSave bool) {
+
+	msg := &api.Message{
+		MGID:           wac.GetID(),
+		WAClient:       in.Client,
+		WAName:         in.Name,
+		WAFromName:     in.FromName,
+		WAFromClient:   in.From,
+		WAMessageID:    in.ID,
+		WATimestamp:    in.Timestamp,
+		WAFwdMessageID: in.QuotedID,
+		Chatted:        api.ChattedNo,
+		MessageStatus:  in.Status,
+		Text:           in.Text,
+	}
+
+	if in.FromMe {
+		msg.WAName = "Self"
+		msg.WAClient = in.Owner
+	}
+
+	db, ok := appCtx.FromDB(ctx)
+	if !ok {
+		log.Println("Store not ready")
+		return
+	}
+
+	if doSave {
+		if db.ExistMessageByWA(msg.WAMessageID) {
+			return
+		}
+
+		if !in.FromMe {
+			calendar, err := db.GetCalendar(wac.GetID())
+			if err != nil {
+				log.Println("Get calendar store error: ", err)
+			}
+			msg.AfterHours = !calendar.IsOpen(time.Unix(int64(in.Timestamp), 0))
+		}
+
+		err := db.SaveMessage(msg)
+		if err != nil {
+			log.Println("Save store error: ", err)
+		}
+	}
+
+	if err := relay(ctx, wac, in, msg, doSave); err != nil {
+		log.Println("Send message tg error: ", err)
+		if doSave {
+			enqueue(ctx, wac, in, err)
+		}
+	}
+
+	if doSave {
+		OptOut(ctx, wac, in)
+		AutoReply(ctx, wac, in)
+	}
+}
+
+// relay send message to joined chat or main group, when doSave mark it read and store Telegram ids
+func relay(ctx context.Context, wac api.WAInstance, in *Inbound, msg *api.Message, doSave bool) error {
+
+	db, ok := appCtx.FromDB(ctx)
+	if !ok {
+		return fmt.Errorf("module Store not ready")
+	}
+
+	tg, ok := appCtx.FromTG(ctx)
+	if !ok {
+		log.Println("Module Telegram not ready")
+		return fmt.Errorf("module Telegram not ready")
+	}
+
+	chat, err := db.GetChatByClient(in.Client, wac.GetID())
+	if err != nil {
+		log.Println("Get chat store error: ", err)
+	}
+	chatID, _ := strconv.ParseInt(wac.GetID(), 10, 64)
+	if chat != nil {
+		chatID = chat.TGChatID
+		msg.Chatted = api.ChattedYes
+		msg.TGUserName = chat.TGUserName
+		msg.Session = chat.Session
+	} else if in.FromMe {
+		return nil
+	}
+
+	threadID := 0
+	if chat == nil {
+		if threadID, err = topic(ctx, wac, in.Client, msg.WAName, chatID); err != nil {
+			return err
+		}
+	}
+
+	replyTo := 0
+	if in.QuotedID != "" {
+		quoted, err := db.GetMessageByWA(in.QuotedID)
+		if err != nil {
+			log.Println("Get quoted message store error: ", err)
+		} else if quoted != nil && quoted.TGChatID == chatID {
+			replyTo = quoted.TGMessageID
+		}
+	}
+
+	tgMsg := &api.TGMessage{}
+	switch in.Kind {
+	case KindText:
+		txt := msg.Text
+		if chat == nil && threadID == 0 {
+			builder := strings.Builder{}
+			builder.WriteString(fmt.Sprintf("Client %s(%s):\n", msg.WAName, wac.GetShortClient(msg.WAClient)))
+			builder.WriteString(txt)
+			txt = builder.String()
+		}
+		tgMsg, err = tg.SendMessage(chatID, txt, replyTo, threadID)
+	case KindImage:
+		var raw []byte
+		raw, err = in.Download()
+		if err == nil {
+			tgMsg, err = tg.SendImage(chatID, bytes.NewReader(raw), in.Caption, replyTo, threadID)
+		}
+	case KindDocument:
+		var raw []byte
+		raw, err = in.Download()
+		if err == nil {
+			tgMsg, err = tg.SendDocument(chatID, bytes.NewReader(raw), in.FileName, replyTo, threadID)
+		}
+	case KindAudio:
+		var raw []byte
+		raw, err = in.Download()
+		if err == nil {
+			tgMsg, err = tg.SendAudio(chatID, bytes.NewReader(raw), replyTo, threadID)
+		}
+	case KindVideo:
+		var raw []byte
+		raw, err = in.Download()
+		if err == nil {
+			tgMsg, err = tg.SendVideo(chatID, bytes.NewReader(raw), replyTo, threadID)
+		}
+	case KindLocation:
+		tgMsg, err = tg.SendLocation(chatID, in.Lat, in.Lon, replyTo, threadID)
+	case KindContact:
+		card := ParseVCard(in.VCard)
+		if card.Name == "" {
+			card.Name = msg.Text
+		}
+		if card.Phone() == "" {
+			txt := fmt.Sprintf("Contact: %s", card.Name)
+			if chat == nil && threadID == 0 {
+				txt = fmt.Sprintf("Client %s(%s):\n%s", msg.WAName, wac.GetShortClient(msg.WAClient), txt)
+			}
+			tgMsg, err = tg.SendMessage(chatID, txt, replyTo, threadID)
+		} else {
+			if chat == nil && threadID == 0 {
+				var label *api.TGMessage
+				label, err = tg.SendMessage(chatID, fmt.Sprintf("Client %s(%s):", msg.WAName, wac.GetShortClient(msg.WAClient)), replyTo, threadID)
+				if err != nil {
+					break
+				}
+				replyTo = label.MessageID
+			}
+			tgMsg, err = tg.SendContact(chatID, card.Phone(), card.Name, replyTo, threadID)
+		}
+	default:
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	msg.TGChatID = tgMsg.ChatID
+	msg.TGMessageID = tgMsg.MessageID
+	msg.TGTimestamp = tgMsg.Timestamp
+	msg.TGFwdMessageID = tgMsg.FwdMessageID
+	msg.Direction = api.DirectionWa2tg
+	if msg.TGUserName == "" {
+		msg.TGUserName = tgMsg.UserName
+	}
+
+	if doSave {
+		err = wac.ReadMessage(msg.WAClient, msg.WAFromClient, msg.WAMessageID)
+		if err != nil {
+			log.Println("Error read message: ", err)
+		}
+
+		err = db.SaveMessage(msg)
+		if err != nil {
+			log.Println("Save store error: ", err)
+		}
+		if chat == nil && threadID == 0 {
+			notifyNewClient(db, tg, wac, msg, chatID)
+		}
+		tg.MirrorMessage(msg)
+		tg.UpdateStatMessage(1)
+	}
+	return nil
+}
+
+// notifyNewClient offer main group to take free chat for client on first not chatted message
+func notifyNewClient(db api.Store, tg api.TG, wac api.WAInstance, msg *api.Message, mgChatID int64) {
+	items, err := db.GetMessagesNotChattedByClient(msg.WAClient)
+	if err != nil {
+		log.Println("Get not chatted messages store error: ", err)
+		return
+	}
+	count := 0
+	for _, v := range items {
+		if v.MGID == msg.MGID {
+			count++
+		}
+	}
+	if count != 1 {
+		return
+	}
+	if _, err = tg.SendNewClient(mgChatID, wac.GetShortClient(msg.WAClient), msg.WAName); err != nil {
+		log.Println("Send new client tg error: ", err)
+	}
+}
@@ -0,0 +1,54 @@
+package bridge
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+)
+
+// OptOutKeyword opt-out keyword of main group set by admin with /campaign optout, empty when disabled as by default
+func OptOutKeyword(mg *api.MainGroup) string {
+	if mg == nil || mg.OptOutKeyword == "-" {
+		return ""
+	}
+	return mg.OptOutKeyword
+}
+
+// OptOut exclude client sent opt-out keyword of main group from future campaigns
+func OptOut(ctx context.Context, wac api.WAInstance, in *Inbound) {
+
+	if in.FromMe || in.Kind != KindText || strings.HasSuffix(in.Client, "@g.us") {
+		return
+	}
+
+	db, ok := appCtx.FromDB(ctx)
+	if !ok {
+		return
+	}
+
+	mgChatID, _ := strconv.ParseInt(wac.GetID(), 10, 64)
+	mg, err := db.GetMainGroupByTGID(mgChatID)
+	if err != nil {
+		log.Println("Get main group store error: ", err)
+		return
+	}
+	keyword := OptOutKeyword(mg)
+	if keyword == "" || !strings.EqualFold(strings.TrimSpace(in.Text), keyword) {
+		return
+	}
+
+	created, err := db.SaveOptOut(&api.OptOut{MGID: wac.GetID(), WAClient: in.Client})
+	if err != nil {
+		log.Println("Save opt-out store error: ", err)
+		return
+	}
+	if !created {
+		return
+	}
+	if _, err = wac.SendMessage(in.Client, "You are unsubscribed from our campaigns", "", ""); err != nil {
+		log.Println("Send opt-out confirmation error: ", err)
+	}
+}
@@ -0,0 +1,185 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"time"
+)
+
+// downloads media loaders of undelivered messages failed to download, lost on restart
+var downloads = struct {
+	sync.Mutex
+	items map[string]func() ([]byte, error)
+}{items: map[string]func() ([]byte, error){}}
+
+// enqueue record failed delivery for retry by the queue worker
+func enqueue(ctx context.Context, wac api.WAInstance, in *Inbound, cause error) {
+
+	db, ok := appCtx.FromDB(ctx)
+	if !ok {
+		log.Println("Store not ready")
+		return
+	}
+
+	item := &api.Undelivered{
+		MGID:          wac.GetID(),
+		WAMessageID:   in.ID,
+		Kind:          in.Kind,
+		Client:        in.Client,
+		Name:          in.Name,
+		From:          in.From,
+		FromName:      in.FromName,
+		FromMe:        in.FromMe,
+		Owner:         in.Owner,
+		Timestamp:     in.Timestamp,
+		MessageStatus: in.Status,
+		QuotedID:      in.QuotedID,
+		Text:          in.Text,
+		Caption:       in.Caption,
+		FileName:      in.FileName,
+		Lat:           in.Lat,
+		Lon:           in.Lon,
+		VCard:         in.VCard,
+		Status:        api.UndeliveredPending,
+		Attempts:      1,
+		NextAt:        time.Now(),
+		Error:         cause.Error(),
+	}
+	// media is stored with message to survive restart, loader is kept only when WhatsApp download failed
+	var download func() ([]byte, error)
+	if in.Download != nil {
+		raw, err := in.Download()
+		if err != nil {
+			log.Println("Download undelivered media error: ", err)
+			download = in.Download
+		}
+		item.Media = raw
+	}
+	if err := db.SaveUndelivered(item); err != nil {
+		log.Println("Save undelivered store error: ", err)
+		return
+	}
+
+	if download != nil {
+		downloads.Lock()
+		downloads.items[in.ID] = download
+		downloads.Unlock()
+	}
+
+	if tg, ok := appCtx.FromTG(ctx); ok {
+		tg.UpdateStatMessage(1)
+	}
+}
+
+// Redeliver retry delivery of undelivered message, on failure next attempt is planned with backoff,
+// after attempts the message is dead and reported to the main group
+func Redeliver(ctx context.Context, wac api.WAInstance, item *api.Undelivered, min, max time.Duration, attempts int) error {
+
+	db, ok := appCtx.FromDB(ctx)
+	if !ok {
+		return fmt.Errorf("module Store not ready")
+	}
+
+	in := &Inbound{
+		Kind:      item.Kind,
+		ID:        item.WAMessageID,
+		Client:    item.Client,
+		Name:      item.Name,
+		From:      item.From,
+		FromName:  item.FromName,
+		FromMe:    item.FromMe,
+		Owner:     item.Owner,
+		Timestamp: item.Timestamp,
+		Status:    item.MessageStatus,
+		QuotedID:  item.QuotedID,
+		Text:      item.Text,
+		Caption:   item.Caption,
+		FileName:  item.FileName,
+		Lat:       item.Lat,
+		Lon:       item.Lon,
+		VCard:     item.VCard,
+	}
+
+	switch in.Kind {
+	case KindImage, KindDocument, KindAudio, KindVideo:
+		if len(item.Media) > 0 {
+			media := item.Media
+			in.Download = func() ([]byte, error) { return media, nil }
+		} else {
+			downloads.Lock()
+			in.Download = downloads.items[in.ID]
+			downloads.Unlock()
+		}
+		if in.Download == nil {
+			in.Text = fmt.Sprintf("%s\n(%s is not available anymore, please check the phone)", in.Text, in.Kind)
+			in.Kind = KindText
+		}
+	}
+
+	msg, err := db.GetMessageByWA(item.WAMessageID)
+	if err != nil {
+		return err
+	}
+	if msg == nil {
+		msg = &api.Message{
+			MGID:           item.MGID,
+			WAClient:       in.Client,
+			WAName:         in.Name,
+			WAFromName:     in.FromName,
+			WAFromClient:   in.From,
+			WAMessageID:    in.ID,
+			WATimestamp:    in.Timestamp,
+			WAFwdMessageID: in.QuotedID,
+			Chatted:        api.ChattedNo,
+			MessageStatus:  in.Status,
+			Text:           item.Text,
+		}
+	}
+
+	err = relay(ctx, wac, in, msg, true)
+	if err != nil {
+		item.Attempts++
+		item.NextAt = time.Now().Add(Backoff(item.Attempts, min, max))
+		item.Error = err.Error()
+		if item.Attempts >= attempts {
+			item.Status = api.UndeliveredDead
+		}
+	} else {
+		item.Status = api.UndeliveredDelivered
+		item.Error = ""
+	}
+	if item.Status != api.UndeliveredPending {
+		item.Media = nil
+		downloads.Lock()
+		delete(downloads.items, item.WAMessageID)
+		downloads.Unlock()
+	}
+	if errSave := db.SaveUndelivered(item); errSave != nil {
+		log.Println("Save undelivered store error: ", errSave)
+	}
+	if item.Status == api.UndeliveredDead {
+		reportDead(ctx, wac, item)
+	}
+	return err
+}
+
+// reportDead tell main group about message given up after max attempts
+func reportDead(ctx context.Context, wac api.WAInstance, item *api.Undelivered) {
+
+	tg, ok := appCtx.FromTG(ctx)
+	if !ok {
+		return
+	}
+	chatID, _ := strconv.ParseInt(item.MGID, 10, 64)
+	text := fmt.Sprintf("Message of client %s(%s) not delivered to Telegram after %d attempts, please check the phone: %s",
+		wac.GetClientName(item.Client), wac.GetShortClient(item.Client), item.Attempts, item.Error)
+	if _, err := tg.SendMessage(chatID, text, 0, 0); err != nil {
+		log.Println("Send dead undelivered notice error: ", err)
+	}
+	tg.UpdateStatMessage(1)
+}
@@ -0,0 +1,58 @@
+package bridge
+
+import (
+	"context"
+	"log"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+)
+
+// StatusReactions emoji put on operator message in Telegram for WhatsApp status
+var StatusReactions = map[int]string{
+	api.MessageStatusFailed:      "💔",
+	api.MessageStatusServerAck:   "🕊",
+	api.MessageStatusDeliveryAck: "👌",
+	api.MessageStatusRead:        "👀",
+	api.MessageStatusPlayed:      "👀",
+}
+
+// Receipt update status of tg2wa message, statuses only move forward except failed
+func Receipt(ctx context.Context, messageID string, status int) {
+
+	db, ok := appCtx.FromDB(ctx)
+	if !ok {
+		log.Println("Store not ready")
+		return
+	}
+
+	msg, err := db.GetMessageByWA(messageID)
+	if err != nil {
+		log.Println("Get message store error: ", err)
+		return
+	}
+	if msg == nil || msg.Direction != api.DirectionTg2wa {
+		return
+	}
+	if status != api.MessageStatusFailed && status <= msg.MessageStatus {
+		return
+	}
+
+	prev := StatusReactions[msg.MessageStatus]
+	msg.MessageStatus = status
+	if err = db.SaveMessage(msg); err != nil {
+		log.Println("Save store error: ", err)
+		return
+	}
+
+	tg, ok := appCtx.FromTG(ctx)
+	if !ok || msg.TGChatID == 0 {
+		return
+	}
+	reaction, ok := StatusReactions[status]
+	if !ok || reaction == prev {
+		return
+	}
+	if err = tg.ReactMessage(msg.TGChatID, msg.TGMessageID, reaction); err != nil {
+		log.Println("React message tg error: ", err)
+	}
+}
@@ -0,0 +1,61 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+)
+
+// Revoke mark message deleted in WhatsApp and annotate its Telegram copy,
+// by is "client" or "self" when deleted from the phone of the instance
+func Revoke(ctx context.Context, wac api.WAInstance, messageID string, by string) {
+
+	db, ok := appCtx.FromDB(ctx)
+	if !ok {
+		log.Println("Store not ready")
+		return
+	}
+
+	msg, err := db.GetMessageByWA(messageID)
+	if err != nil {
+		log.Println("Get message store error: ", err)
+		return
+	}
+	if msg == nil || msg.RevokeStatus == api.RevokeStatusRevoked {
+		return
+	}
+
+	msg.RevokeStatus = api.RevokeStatusRevoked
+	msg.RevokedBy = by
+	if err = db.SaveMessage(msg); err != nil {
+		log.Println("Save store error: ", err)
+		return
+	}
+
+	tg, ok := appCtx.FromTG(ctx)
+	if !ok || msg.TGMessageID == 0 {
+		return
+	}
+
+	note := fmt.Sprintf("Message deleted by %s", by)
+	if msg.Direction == api.DirectionWa2tg {
+		txt := msg.Text
+		mgID, _ := strconv.ParseInt(msg.MGID, 10, 64)
+		if msg.TGChatID == mgID {
+			txt = fmt.Sprintf("Client %s(%s):\n%s", msg.WAName, wac.GetShortClient(msg.WAClient), txt)
+		}
+		err = tg.EditMessage(msg.TGChatID, msg.TGMessageID, fmt.Sprintf("<s>%s</s>\n<i>%s</i>", html.EscapeString(txt), note), "HTML")
+		if err == nil {
+			return
+		}
+	}
+
+	// media and operator messages can not be edited by bot
+	if _, err = tg.SendMessage(msg.TGChatID, note, msg.TGMessageID, 0); err != nil {
+		log.Println("Send message tg error: ", err)
+	}
+}
@@ -0,0 +1,164 @@
+package bridge
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"tgwabr/api"
+	"time"
+)
+
+// ErrLoggedOut returned by reconnect func when session is gone and retry is useless
+var ErrLoggedOut = errors.New("logged out")
+
+const (
+	DefaultBackoffMin = 5 * time.Second
+	DefaultBackoffMax = 5 * time.Minute
+)
+
+// Supervisor keep connection state of instance and reconnect it with capped exponential backoff
+type Supervisor struct {
+	Min time.Duration
+	Max time.Duration
+
+	mu       sync.Mutex
+	state    api.ConnectionState
+	running  bool
+	connect  func() error
+	notify   func(state api.ConnectionState)
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSupervisor connect is called on every attempt, notify on every transition between
+// connected, reconnecting and logged out
+func NewSupervisor(connect func() error, notify func(state api.ConnectionState)) *Supervisor {
+	return &Supervisor{
+		Min:     DefaultBackoffMin,
+		Max:     DefaultBackoffMax,
+		state:   api.ConnectionState{State: api.ConnectionConnecting, Since: time.Now()},
+		connect: connect,
+		notify:  notify,
+		stop:    make(chan struct{}),
+	}
+}
+
+// Backoff delay before attempt, doubles from min up to max, half of it is random jitter
+func Backoff(attempt int, min, max time.Duration) time.Duration {
+	delay := min
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (s *Supervisor) State() api.ConnectionState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Connected instance online, reset attempts
+func (s *Supervisor) Connected() {
+	s.set(api.ConnectionState{State: api.ConnectionConnected})
+}
+
+// LoggedOut session is gone, no reconnect until next Connected
+func (s *Supervisor) LoggedOut(err error) {
+	state := api.ConnectionState{State: api.ConnectionLoggedOut}
+	if err != nil {
+		state.Error = err.Error()
+	}
+	s.set(state)
+}
+
+// Disconnected start reconnect loop if it is not running and instance not logged out
+func (s *Supervisor) Disconnected(err error) {
+	s.mu.Lock()
+	if s.running || s.state.State == api.ConnectionLoggedOut {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.mu.Unlock()
+	go s.run(s.backoff(1, err), err)
+}
+
+func (s *Supervisor) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+func (s *Supervisor) backoff(attempt int, cause error) time.Duration {
+	delay := Backoff(attempt, s.Min, s.Max)
+	state := api.ConnectionState{State: api.ConnectionBackoff, Attempt: attempt, NextAt: time.Now().Add(delay)}
+	if cause != nil {
+		state.Error = cause.Error()
+	}
+	s.set(state)
+	return delay
+}
+
+func (s *Supervisor) run(delay time.Duration, cause error) {
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			delay = s.backoff(attempt, cause)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-s.stop:
+			return
+		}
+		if s.State().State != api.ConnectionBackoff {
+			return
+		}
+
+		s.set(api.ConnectionState{State: api.ConnectionConnecting, Attempt: attempt})
+		cause = s.connect()
+		if cause == nil {
+			s.Connected()
+			return
+		}
+		if errors.Is(cause, ErrLoggedOut) {
+			s.LoggedOut(cause)
+			return
+		}
+	}
+}
+
+func phase(state string) string {
+	if state == api.ConnectionBackoff {
+		return api.ConnectionConnecting
+	}
+	return state
+}
+
+func (s *Supervisor) set(state api.ConnectionState) {
+	s.mu.Lock()
+	prev := s.state
+	state.Since = time.Now()
+	if phase(prev.State) == phase(state.State) {
+		state.Since = prev.Since
+	}
+	s.state = state
+	changed := phase(prev.State) != phase(state.State)
+	startup := prev.State == api.ConnectionConnecting && prev.Attempt == 0 && state.State == api.ConnectionConnected
+	s.mu.Unlock()
+
+	if changed && !startup && s.notify != nil {
+		s.notify(state)
+	}
+}
@@ -0,0 +1,84 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"tgwabr/api"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{attempt: 1, min: 2 * time.Second, max: 2 * time.Second},
+		{attempt: 2, min: 4 * time.Second, max: 4 * time.Second},
+		{attempt: 5, min: 32 * time.Second, max: 32 * time.Second},
+		{attempt: 20, min: time.Minute, max: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("attempt %d", tt.attempt), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := Backoff(tt.attempt, 2*time.Second, time.Minute)
+				if got < tt.min/2 || got > tt.max {
+					t.Fatalf("Backoff() = %v, want in [%v, %v]", got, tt.min/2, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		notified []string
+	)
+	s := NewSupervisor(func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts < 3 {
+			return errors.New("connection failed")
+		}
+		return nil
+	}, func(state api.ConnectionState) {
+		mu.Lock()
+		defer mu.Unlock()
+		notified = append(notified, state.State)
+	})
+	s.Min, s.Max = time.Millisecond, 4*time.Millisecond
+	defer s.Stop()
+
+	s.Connected()
+	s.Disconnected(errors.New("connection failed"))
+	s.Disconnected(errors.New("connection failed"))
+
+	deadline := time.Now().Add(time.Second)
+	for s.State().State != api.ConnectionConnected {
+		if time.Now().After(deadline) {
+			t.Fatalf("State() = %+v", s.State())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	got := fmt.Sprint(notified)
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+	mu.Unlock()
+	if got != "[backoff connected]" {
+		t.Errorf("notified = %s, want [backoff connected]", got)
+	}
+
+	s.LoggedOut(ErrLoggedOut)
+	s.Disconnected(errors.New("connection failed"))
+	if st := s.State(); st.State != api.ConnectionLoggedOut || st.Error != "logged out" {
+		t.Errorf("State() after logout = %+v", st)
+	}
+}
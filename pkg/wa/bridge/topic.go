@@ -0,0 +1,54 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+)
+
+var topicMu sync.Mutex
+
+// topic find or create forum topic of client when main group works in topics mode, 0 when it does not
+func topic(ctx context.Context, wac api.WAInstance, client, name string, mgChatID int64) (int, error) {
+
+	db, ok := appCtx.FromDB(ctx)
+	if !ok {
+		return 0, fmt.Errorf("module Store not ready")
+	}
+	tg, ok := appCtx.FromTG(ctx)
+	if !ok {
+		return 0, fmt.Errorf("module Telegram not ready")
+	}
+
+	mg, err := db.GetMainGroupByTGID(mgChatID)
+	if err != nil {
+		return 0, err
+	}
+	if mg == nil || !mg.Topics {
+		return 0, nil
+	}
+
+	topicMu.Lock()
+	defer topicMu.Unlock()
+
+	item, err := db.GetTopicByClient(wac.GetID(), client)
+	if err != nil {
+		return 0, err
+	}
+	if item != nil {
+		return item.ThreadID, nil
+	}
+
+	title := wac.GetShortClient(client)
+	if name != "" {
+		title = fmt.Sprintf("%s(%s)", name, title)
+	}
+	threadID, err := tg.CreateTopic(mgChatID, title)
+	if err != nil {
+		return 0, err
+	}
+	err = db.SaveTopic(&api.Topic{MGID: wac.GetID(), WAClient: client, ThreadID: threadID, Name: title})
+	return threadID, err
+}
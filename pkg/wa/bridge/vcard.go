@@ -0,0 +1,91 @@
+package bridge
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VCard contact card carried by WhatsApp contact messages
+type VCard struct {
+	Name   string
+	Phones []string
+}
+
+// ParseVCard read name and phones of vCard, unknown fields are ignored
+func ParseVCard(data string) VCard {
+	card := VCard{}
+	name := ""
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	// unfold continuation lines, RFC 6350 3.2
+	data = strings.ReplaceAll(data, "\n ", "")
+	for _, line := range strings.Split(data, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		// property may be grouped ("item1.TEL") and has params ("TEL;type=CELL")
+		key := strings.ToUpper(strings.SplitN(parts[0], ";", 2)[0])
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			key = key[i+1:]
+		}
+		value := strings.TrimSpace(unescapeVCard(parts[1]))
+		switch key {
+		case "FN":
+			card.Name = value
+		case "N":
+			// family;given;additional;prefix;suffix
+			items := strings.Split(parts[1], ";")
+			if len(items) > 1 {
+				items[0], items[1] = items[1], items[0]
+			}
+			name = strings.Join(strings.Fields(unescapeVCard(strings.Join(items, " "))), " ")
+		case "TEL":
+			if phone := strings.TrimSpace(value); phone != "" {
+				card.Phones = append(card.Phones, phone)
+			}
+		}
+	}
+	if card.Name == "" {
+		card.Name = name
+	}
+	return card
+}
+
+// Phone first phone of card or empty
+func (c VCard) Phone() string {
+	if len(c.Phones) == 0 {
+		return ""
+	}
+	return c.Phones[0]
+}
+
+// String encode card as vCard 3.0, WhatsApp links phone with waid parameter
+func (c VCard) String() string {
+	builder := strings.Builder{}
+	builder.WriteString("BEGIN:VCARD\nVERSION:3.0\n")
+	builder.WriteString(fmt.Sprintf("N:;%s;;;\n", escapeVCard(c.Name)))
+	builder.WriteString(fmt.Sprintf("FN:%s\n", escapeVCard(c.Name)))
+	for _, v := range c.Phones {
+		waID := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, v)
+		builder.WriteString(fmt.Sprintf("TEL;type=CELL;waid=%s:%s\n", waID, v))
+	}
+	builder.WriteString("END:VCARD")
+	return builder.String()
+}
+
+var vCardEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+var vCardUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func escapeVCard(value string) string {
+	return vCardEscaper.Replace(value)
+}
+
+func unescapeVCard(value string) string {
+	return vCardUnescaper.Replace(value)
+}
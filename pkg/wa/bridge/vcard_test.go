@@ -0,0 +1,53 @@
+package bridge
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVCard(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want VCard
+	}{
+		{
+			name: "whatsapp",
+			data: "BEGIN:VCARD\nVERSION:3.0\nN:Ivanov;Maxim;;;\nFN:Maxim Ivanov\nitem1.TEL;waid=79111135900:+7 911 113-59-00\nitem1.X-ABLabel:Mobile\nEND:VCARD",
+			want: VCard{Name: "Maxim Ivanov", Phones: []string{"+7 911 113-59-00"}},
+		},
+		{
+			name: "only N, crlf, two phones",
+			data: "BEGIN:VCARD\r\nVERSION:2.1\r\nN:Ivanov;Maxim\r\nTEL;CELL:+79111135900\r\nTEL;HOME:+74950000000\r\nEND:VCARD",
+			want: VCard{Name: "Maxim Ivanov", Phones: []string{"+79111135900", "+74950000000"}},
+		},
+		{
+			name: "escaped and folded",
+			data: "BEGIN:VCARD\nFN:Shop\\, Dubai\nTEL:+971\n 500000000\nEND:VCARD",
+			want: VCard{Name: "Shop, Dubai", Phones: []string{"+971500000000"}},
+		},
+		{
+			name: "empty",
+			data: "",
+			want: VCard{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseVCard(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseVCard() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVCard_String(t *testing.T) {
+	card := VCard{Name: "Shop, Dubai", Phones: []string{"+971 50 000 0000"}}
+	want := "BEGIN:VCARD\nVERSION:3.0\nN:;Shop\\, Dubai;;;\nFN:Shop\\, Dubai\nTEL;type=CELL;waid=971500000000:+971 50 000 0000\nEND:VCARD"
+	if got := card.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := ParseVCard(card.String()); !reflect.DeepEqual(got, card) {
+		t.Errorf("ParseVCard(String()) = %+v, want %+v", got, card)
+	}
+}
@@ -0,0 +1,463 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"tgwabr/api"
+	"tgwabr/pkg"
+	"tgwabr/pkg/wa/bridge"
+	"time"
+)
+
+// Sent message recorded by the fake instance
+type Sent struct {
+	MessageID string
+	Kind      string
+	Client    string
+	Text      string
+	Mime      string
+	FileName  string
+	Data      []byte
+	Lat       float64
+	Lon       float64
+	VCard     string
+	QuotedID  string
+	Quoted    string
+}
+
+// Service in-memory implementation of api.WA
+type Service struct {
+	instances map[int64]*Instance
+	api.WA
+}
+
+// Instance in-memory implementation of api.WAInstance
+type Instance struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	id       int64
+	self     string
+	seq      int
+	loggedIn bool
+	state    api.ConnectionState
+	contacts map[string]string
+	chats    map[string]int
+	clients  []string
+	sent     []*Sent
+	read     []string
+	revoked  []string
+	history  map[string][]*bridge.Inbound
+	api.WAInstance
+}
+
+func New(ctx context.Context, ids ...int64) *Service {
+	service := &Service{instances: map[int64]*Instance{}}
+	for _, id := range ids {
+		instance := &Instance{
+			ctx:      ctx,
+			id:       id,
+			self:     fmt.Sprintf("%d@s.whatsapp.net", id),
+			loggedIn: true,
+			state:    api.ConnectionState{State: api.ConnectionConnected, Since: time.Now()},
+			contacts: map[string]string{},
+			chats:    map[string]int{},
+			history:  map[string][]*bridge.Inbound{},
+		}
+		instance.WAInstance = instance
+		service.instances[id] = instance
+	}
+	return service
+}
+
+func (s *Service) UpdateCTX(ctx context.Context) {
+	for _, v := range s.instances {
+		v.mu.Lock()
+		v.ctx = ctx
+		v.mu.Unlock()
+	}
+}
+
+func (s *Service) ShutDown() error {
+	return nil
+}
+
+func (s *Service) GetInstance(id int64) (api.WAInstance, bool) {
+	item, ok := s.instances[id]
+	if !ok {
+		return nil, false
+	}
+	return item, true
+}
+
+// Instance return fake instance of the main group for scripting
+func (s *Service) Instance(id int64) *Instance {
+	return s.instances[id]
+}
+
+// AddContact simulate address book entry
+func (s *Instance) AddContact(client, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contacts[s.PrepareClientJID(client)] = name
+}
+
+// SetUnread simulate unread counter of chat
+func (s *Instance) SetUnread(client string, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chats[s.PrepareClientJID(client)] = count
+}
+
+// SetConnectionState simulate connection state reported by the supervisor
+func (s *Instance) SetConnectionState(state api.ConnectionState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+}
+
+// Sent return messages sent to WhatsApp
+func (s *Instance) Sent() []*Sent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Sent{}, s.sent...)
+}
+
+// LastSent return last message sent to WhatsApp or nil
+func (s *Instance) LastSent() *Sent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.sent) == 0 {
+		return nil
+	}
+	return s.sent[len(s.sent)-1]
+}
+
+// Read return IDs of messages marked as read
+func (s *Instance) Read() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.read...)
+}
+
+// Receive inject inbound message through the bridge as a live message
+func (s *Instance) Receive(in *bridge.Inbound) string {
+	s.mu.Lock()
+	in.Client = s.PrepareClientJID(in.Client)
+	if in.ID == "" {
+		in.ID = s.nextID()
+	}
+	if in.Timestamp == 0 {
+		in.Timestamp = uint64(time.Now().Unix())
+	}
+	if in.Name == "" {
+		in.Name = s.contacts[in.Client]
+	}
+	if in.From == "" {
+		in.From = in.Client
+		in.FromName = in.Name
+	}
+	if in.FromMe {
+		in.Owner = s.self
+	}
+	if !in.FromMe {
+		s.chats[in.Client]++
+	}
+	if !pkg.StringInSlice(in.Client, s.clients) {
+		s.clients = append(s.clients, in.Client)
+	}
+	s.history[in.Client] = append(s.history[in.Client], in)
+	ctx := s.ctx
+	s.mu.Unlock()
+
+	bridge.Handle(ctx, s, in, true)
+	return in.ID
+}
+
+// ReceiveText inject inbound text message
+func (s *Instance) ReceiveText(client, text string) string {
+	return s.Receive(&bridge.Inbound{Kind: bridge.KindText, Client: client, Text: text})
+}
+
+// ReceiveImage inject inbound image message
+func (s *Instance) ReceiveImage(client string, data []byte, caption string) string {
+	return s.Receive(&bridge.Inbound{
+		Kind:     bridge.KindImage,
+		Client:   client,
+		Text:     fmt.Sprintf("%s (%s)", caption, "image/jpeg"),
+		Caption:  caption,
+		Download: func() ([]byte, error) { return data, nil },
+	})
+}
+
+// ReceiveDocument inject inbound document message
+func (s *Instance) ReceiveDocument(client string, data []byte, fileName string) string {
+	return s.Receive(&bridge.Inbound{
+		Kind:     bridge.KindDocument,
+		Client:   client,
+		Text:     fmt.Sprintf("%s (%s)", fileName, "application/octet-stream"),
+		FileName: fileName,
+		Download: func() ([]byte, error) { return data, nil },
+	})
+}
+
+// ReceiveLocation inject inbound location message
+func (s *Instance) ReceiveLocation(client string, lat, lon float64) string {
+	return s.Receive(&bridge.Inbound{Kind: bridge.KindLocation, Client: client, Lat: lat, Lon: lon})
+}
+
+// ReceiveContact inject inbound contact card
+func (s *Instance) ReceiveContact(client, name, phone string) string {
+	card := bridge.VCard{Name: name, Phones: []string{phone}}
+	return s.Receive(&bridge.Inbound{Kind: bridge.KindContact, Client: client, Text: name, VCard: card.String()})
+}
+
+// Revoked return IDs of messages revoked through the instance
+func (s *Instance) Revoked() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.revoked...)
+}
+
+// ReceiveRevoke simulate client deleting message for everyone
+func (s *Instance) ReceiveRevoke(messageID string) {
+	s.mu.Lock()
+	ctx := s.ctx
+	s.mu.Unlock()
+	bridge.Revoke(ctx, s, messageID, "client")
+}
+
+// Ack simulate delivery or read receipt of sent message
+func (s *Instance) Ack(messageID string, status int) {
+	s.mu.Lock()
+	ctx := s.ctx
+	s.mu.Unlock()
+	bridge.Receipt(ctx, messageID, status)
+}
+
+func (s *Instance) nextID() string {
+	s.seq++
+	return fmt.Sprintf("FAKE%d%08d", s.id, s.seq)
+}
+
+func (s *Instance) record(item *Sent) (*api.WAMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loggedIn {
+		return nil, fmt.Errorf("not logged in")
+	}
+	item.Client = s.PrepareClientJID(item.Client)
+	item.MessageID = s.nextID()
+	s.sent = append(s.sent, item)
+	return &api.WAMessage{
+		Client:    item.Client,
+		Name:      s.contacts[item.Client],
+		MessageID: item.MessageID,
+		Timestamp: uint64(time.Now().Unix()),
+	}, nil
+}
+
+func (s *Instance) ReadMessage(client, _, messageID string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jid := s.PrepareClientJID(client)
+	if s.chats[jid] > 0 {
+		s.chats[jid]--
+	}
+	s.read = append(s.read, messageID)
+	return nil
+}
+
+func (s *Instance) GetUnreadChat() (map[string]string, int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := map[string]string{}
+	for k, v := range s.chats {
+		if v != 0 {
+			res[k] = fmt.Sprintf("%d", v)
+		}
+	}
+	return res, len(s.chats), " fake"
+}
+
+func (s *Instance) GetStatusContacts() (bool, int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.contacts) > 0, len(s.contacts), " fake"
+}
+
+func (s *Instance) GetStatusDevice() bool {
+	return true
+}
+
+func (s *Instance) GetStatusLogin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loggedIn
+}
+
+func (s *Instance) DoLogin() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loggedIn = true
+	s.state = api.ConnectionState{State: api.ConnectionConnected, Since: time.Now()}
+	return true, nil
+}
+
+func (s *Instance) DoLogout() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loggedIn = false
+	s.state = api.ConnectionState{State: api.ConnectionLoggedOut, Since: time.Now()}
+	return true, nil
+}
+
+func (s *Instance) GetConnectionState() api.ConnectionState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *Instance) ClientExist(client string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jid := s.PrepareClientJID(client)
+	_, ok := s.contacts[jid]
+	return ok || pkg.StringInSlice(jid, s.clients)
+}
+
+func (s *Instance) GetClientName(client string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jid := s.PrepareClientJID(client)
+	if name, ok := s.contacts[jid]; ok {
+		return name
+	}
+	if !pkg.StringInSlice(jid, s.clients) {
+		return "Not Sync"
+	}
+	return "New Client"
+}
+
+func (s *Instance) SendMessage(client, text, QuotedID, Quoted string) (msg *api.WAMessage, err error) {
+	return s.record(&Sent{Kind: bridge.KindText, Client: client, Text: text, QuotedID: QuotedID, Quoted: Quoted})
+}
+
+func (s *Instance) SendImage(client string, reader io.Reader, mime string, QuotedID string, Quoted string) (msg *api.WAMessage, err error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return s.record(&Sent{Kind: bridge.KindImage, Client: client, Mime: mime, Data: data, QuotedID: QuotedID, Quoted: Quoted})
+}
+
+func (s *Instance) SendDocument(client string, reader io.Reader, mime string, fileName string, QuotedID string, Quoted string) (msg *api.WAMessage, err error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return s.record(&Sent{Kind: bridge.KindDocument, Client: client, Mime: mime, FileName: fileName, Data: data, QuotedID: QuotedID, Quoted: Quoted})
+}
+
+func (s *Instance) SendAudio(client string, reader io.Reader, mime string, QuotedID string, Quoted string) (msg *api.WAMessage, err error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return s.record(&Sent{Kind: bridge.KindAudio, Client: client, Mime: mime, Data: data, QuotedID: QuotedID, Quoted: Quoted})
+}
+
+func (s *Instance) SendVideo(client string, reader io.Reader, mime string, QuotedID string, Quoted string) (msg *api.WAMessage, err error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return s.record(&Sent{Kind: bridge.KindVideo, Client: client, Mime: mime, Data: data, QuotedID: QuotedID, Quoted: Quoted})
+}
+
+func (s *Instance) SendLocation(client string, lat, lon float64, QuotedID string, Quoted string) (msg *api.WAMessage, err error) {
+	return s.record(&Sent{Kind: bridge.KindLocation, Client: client, Lat: lat, Lon: lon, QuotedID: QuotedID, Quoted: Quoted})
+}
+
+func (s *Instance) SendContact(client, name, phone string, QuotedID string, Quoted string) (msg *api.WAMessage, err error) {
+	card := bridge.VCard{Name: name, Phones: []string{phone}}
+	return s.record(&Sent{Kind: bridge.KindContact, Client: client, Text: name, VCard: card.String(), QuotedID: QuotedID, Quoted: Quoted})
+}
+
+func (s *Instance) RevokeMessage(client, messageID string, fromMe bool) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loggedIn {
+		return fmt.Errorf("not logged in")
+	}
+	if !fromMe {
+		return fmt.Errorf("only own messages can be revoked")
+	}
+	s.revoked = append(s.revoked, messageID)
+	return nil
+}
+
+func (s *Instance) GetHistory(client string, size int) (err error) {
+	s.mu.Lock()
+	items := s.history[s.PrepareClientJID(client)]
+	if len(items) > size {
+		items = items[len(items)-size:]
+	}
+	ctx := s.ctx
+	s.mu.Unlock()
+
+	for _, v := range items {
+		item := *v
+		item.Text = fmt.Sprintf("%s Client: %s", time.Unix(int64(v.Timestamp), 0), v.Text)
+		bridge.Handle(ctx, s, &item, false)
+	}
+	return nil
+}
+
+func (s *Instance) GetContactPhoto(_ string) (result string, err error) {
+	return "", nil
+}
+
+func (s *Instance) GetShortClient(client string) string {
+	parts := strings.Split(client, "@")
+	if len(parts) > 1 {
+		return parts[0]
+	}
+	return client
+}
+
+func (s *Instance) PrepareClientJID(client string) string {
+	if strings.Count(client, "@") > 0 {
+		return client
+	}
+	jidPrefix := "s.whatsapp.net"
+	if len(strings.SplitN(client, "-", 2)) == 2 {
+		jidPrefix = "g.us"
+	} else if len(client) > 14 {
+		jidPrefix = "g.us"
+	}
+	return fmt.Sprintf("%s@%s", client, jidPrefix)
+}
+
+func (s *Instance) PartsClientJID(jid string) (string, string) {
+	if strings.Count(jid, "@") > 0 {
+		parts := strings.Split(jid, "@")
+		return parts[0], parts[1]
+	}
+	return "", ""
+}
+
+func (s *Instance) GetID() string {
+	return fmt.Sprintf("%d", s.id)
+}
+
+func (s *Instance) SyncContacts() (bool, error) {
+	return true, nil
+}
+
+func (s *Instance) SyncChats() (bool, error) {
+	return true, nil
+}
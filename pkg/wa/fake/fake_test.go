@@ -0,0 +1,227 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"tgwabr/pkg/store"
+	"tgwabr/pkg/wa/bridge"
+	"time"
+)
+
+type tgMessage struct {
+	ChatID int64
+	Kind   string
+	Text   string
+	Data   []byte
+}
+
+type recorderTG struct {
+	mu   sync.Mutex
+	seq  int
+	sent []tgMessage
+	fail error
+	api.TG
+}
+
+func (r *recorderTG) record(chatID int64, kind, text string, reader io.Reader) (*api.TGMessage, error) {
+	var data []byte
+	if reader != nil {
+		data, _ = ioutil.ReadAll(reader)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail != nil {
+		return nil, r.fail
+	}
+	r.seq++
+	r.sent = append(r.sent, tgMessage{ChatID: chatID, Kind: kind, Text: text, Data: data})
+	return &api.TGMessage{ChatID: chatID, MessageID: r.seq, UserName: "bot"}, nil
+}
+
+func (r *recorderTG) SendMessage(chatID int64, text string, _, _ int) (*api.TGMessage, error) {
+	return r.record(chatID, "text", text, nil)
+}
+
+func (r *recorderTG) SendImage(chatID int64, reader io.Reader, caption string, _, _ int) (*api.TGMessage, error) {
+	return r.record(chatID, "image", caption, reader)
+}
+
+func (r *recorderTG) SendDocument(chatID int64, reader io.Reader, fileName string, _, _ int) (*api.TGMessage, error) {
+	return r.record(chatID, "document", fileName, reader)
+}
+
+func (r *recorderTG) SendLocation(chatID int64, _, _ float64, _, _ int) (*api.TGMessage, error) {
+	return r.record(chatID, "location", "", nil)
+}
+
+func (r *recorderTG) SendContact(chatID int64, phone, name string, _, _ int) (*api.TGMessage, error) {
+	return r.record(chatID, "contact", name+" "+phone, nil)
+}
+
+func (r *recorderTG) SendNewClient(chatID int64, _, _ string) (*api.TGMessage, error) {
+	return &api.TGMessage{ChatID: chatID}, nil
+}
+
+func (r *recorderTG) MirrorMessage(_ *api.Message) {}
+
+func (r *recorderTG) UpdateStatMessage(_ int) {}
+
+func newTestBridge(t *testing.T, mgID int64) (*Service, *recorderTG, api.Store) {
+	t.Helper()
+	_ = os.Setenv("TYPE_DB", "sqlite3")
+	_ = os.Setenv("NAME_INSTANCE", filepath.Join(t.TempDir(), "test"))
+
+	ctx := context.Background()
+	db, err := store.New(ctx)
+	if err != nil {
+		t.Fatalf("store.New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = db.ShutDown() })
+
+	tg := &recorderTG{}
+	ctx = appCtx.NewDB(ctx, db)
+	ctx = appCtx.NewTG(ctx, tg)
+	wa := New(ctx, mgID)
+	ctx = appCtx.NewWA(ctx, wa)
+	wa.UpdateCTX(ctx)
+	return wa, tg, db
+}
+
+func TestInstance_Receive(t *testing.T) {
+	const mgID = int64(-100)
+	wa, tg, db := newTestBridge(t, mgID)
+	wac := wa.Instance(mgID)
+	wac.AddContact("79111135900", "Maxim")
+
+	id := wac.ReceiveText("79111135900", "Hello")
+	wac.ReceiveImage("79111135900", []byte("jpeg"), "photo")
+	wac.ReceiveDocument("79111135900", []byte("pdf"), "price.pdf")
+	wac.ReceiveLocation("79111135900", 25.2, 55.3)
+	wac.ReceiveContact("79111135900", "Ivan", "+79110000001")
+
+	if len(tg.sent) != 6 {
+		t.Fatalf("Receive() sent to tg = %d, want 6", len(tg.sent))
+	}
+	if tg.sent[0].ChatID != mgID || tg.sent[0].Text != "Client Maxim(79111135900):\nHello" {
+		t.Errorf("Receive() text = %+v", tg.sent[0])
+	}
+	if string(tg.sent[1].Data) != "jpeg" || string(tg.sent[2].Data) != "pdf" || tg.sent[2].Text != "price.pdf" {
+		t.Errorf("Receive() media = %+v, %+v", tg.sent[1], tg.sent[2])
+	}
+
+	msg, err := db.GetMessageByWA(id)
+	if err != nil || msg == nil {
+		t.Fatalf("GetMessageByWA() = %v, %v", msg, err)
+	}
+	if msg.Chatted != api.ChattedNo || msg.Direction != api.DirectionWa2tg || msg.TGMessageID != 1 {
+		t.Errorf("GetMessageByWA() = %+v", msg)
+	}
+	if tg.sent[4].Text != "Client Maxim(79111135900):" || tg.sent[5].Kind != "contact" || tg.sent[5].Text != "Ivan +79110000001" {
+		t.Errorf("Receive() contact = %+v, %+v", tg.sent[4], tg.sent[5])
+	}
+	if len(wac.Read()) != 5 {
+		t.Errorf("Read() = %v, want 5 items", wac.Read())
+	}
+	if chats, _, _ := wac.GetUnreadChat(); len(chats) != 0 {
+		t.Errorf("GetUnreadChat() = %v, want empty", chats)
+	}
+}
+
+func TestInstance_ReceiveJoined(t *testing.T) {
+	const mgID = int64(-100)
+	wa, tg, db := newTestBridge(t, mgID)
+	wac := wa.Instance(mgID)
+
+	err := db.SaveChat(&api.Chat{MGID: wac.GetID(), WAClient: "79111135900@s.whatsapp.net", TGChatID: -200, TGUserName: "operator", Session: "s1"})
+	if err != nil {
+		t.Fatalf("SaveChat() error = %v", err)
+	}
+
+	id := wac.ReceiveText("79111135900", "Hello")
+	if len(tg.sent) != 1 || tg.sent[0].ChatID != -200 || tg.sent[0].Text != "Hello" {
+		t.Fatalf("Receive() sent = %+v", tg.sent)
+	}
+	msg, _ := db.GetMessageByWA(id)
+	if msg == nil || msg.Chatted != api.ChattedYes || msg.TGUserName != "operator" || msg.Session != "s1" {
+		t.Errorf("GetMessageByWA() = %+v", msg)
+	}
+	if wac.GetClientName("79111135900") != "New Client" {
+		t.Errorf("GetClientName() = %s", wac.GetClientName("79111135900"))
+	}
+}
+
+func TestInstance_Redeliver(t *testing.T) {
+	const mgID = int64(-100)
+	wa, tg, db := newTestBridge(t, mgID)
+	wac := wa.Instance(mgID)
+	ctx := appCtx.NewTG(appCtx.NewDB(context.Background(), db), tg)
+
+	tg.fail = errors.New("telegram down")
+	wac.ReceiveImage("79111135900", []byte("jpeg"), "photo")
+	wac.ReceiveText("79111135900", "Hello")
+	items, err := db.GetUndelivered(wac.GetID())
+	if err != nil || len(items) != 2 || string(items[0].Media) != "jpeg" {
+		t.Fatalf("GetUndelivered() = %+v, %v, want stored media", items, err)
+	}
+
+	// media comes from store, so delivery survives restart
+	tg.fail = nil
+	if err = bridge.Redeliver(ctx, wac, items[0], time.Millisecond, time.Millisecond, 3); err != nil {
+		t.Fatalf("Redeliver() error = %v", err)
+	}
+	if len(tg.sent) != 1 || tg.sent[0].Kind != "image" || string(tg.sent[0].Data) != "jpeg" {
+		t.Errorf("Redeliver() sent = %+v", tg.sent)
+	}
+
+	tg.fail = errors.New("telegram down")
+	// first attempt was the live delivery
+	for i := 0; i < 2; i++ {
+		_ = bridge.Redeliver(ctx, wac, items[1], time.Millisecond, time.Millisecond, 3)
+	}
+	if items[1].Status != api.UndeliveredDead || items[1].Attempts != 3 {
+		t.Errorf("Redeliver() after max attempts = %+v, want dead", items[1])
+	}
+	if items, err = db.GetUndelivered(wac.GetID()); err != nil || len(items) != 0 {
+		t.Errorf("GetUndelivered() = %+v, %v, want empty", items, err)
+	}
+}
+
+func TestInstance_ReceiveTGNotReady(t *testing.T) {
+	const mgID = int64(-100)
+	wa, _, db := newTestBridge(t, mgID)
+	wa.UpdateCTX(appCtx.NewDB(context.Background(), db))
+	wac := wa.Instance(mgID)
+
+	wac.ReceiveText("79111135900", "Hello")
+	items, err := db.GetUndelivered(wac.GetID())
+	if err != nil || len(items) != 1 || items[0].Text != "Hello" || items[0].Error != "module Telegram not ready" {
+		t.Errorf("GetUndelivered() = %+v, %v, want queued for retry", items, err)
+	}
+}
+
+func TestInstance_Send(t *testing.T) {
+	wa := New(context.Background(), 1)
+	wac := wa.Instance(1)
+
+	resp, err := wac.SendMessage("79111135900", "Hi", "Q1", "Hello")
+	if err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	last := wac.LastSent()
+	if last.MessageID != resp.MessageID || last.Client != "79111135900@s.whatsapp.net" || last.QuotedID != "Q1" {
+		t.Errorf("LastSent() = %+v", last)
+	}
+
+	_, _ = wac.DoLogout()
+	if _, err = wac.SendMessage("79111135900", "Hi", "", ""); err == nil {
+		t.Errorf("SendMessage() after logout error = nil")
+	}
+}
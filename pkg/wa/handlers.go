@@ -1,47 +1,76 @@
 package wa
 
 import (
-	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"strings"
 	"tgwabr/api"
 	appCtx "tgwabr/context"
 	"tgwabr/pkg"
+	"tgwabr/pkg/wa/bridge"
 	"time"
 
 	"github.com/cristalinojr/go-whatsapp"
+	waproto "go.mau.fi/whatsmeow/binary/proto"
 )
 
 func (s *Instance) handleMessage(message interface{}, doSave bool) {
-	msg := &api.Message{}
+	in := &bridge.Inbound{}
 	var info whatsapp.MessageInfo
 	switch m := message.(type) {
 	case whatsapp.TextMessage:
 		info = m.Info
-		msg.Text = m.Text
-		msg.WAFwdMessageID = m.ContextInfo.QuotedMessageID
+		in.Kind = bridge.KindText
+		in.Text = m.Text
+		in.QuotedID = m.ContextInfo.QuotedMessageID
 	case whatsapp.ImageMessage:
 		info = m.Info
-		msg.Text = fmt.Sprintf("%s (%s)", m.Caption, m.Type)
-		msg.WAFwdMessageID = m.ContextInfo.QuotedMessageID
+		in.Kind = bridge.KindImage
+		in.Text = fmt.Sprintf("%s (%s)", m.Caption, m.Type)
+		in.Caption = m.Caption
+		in.QuotedID = m.ContextInfo.QuotedMessageID
+		in.Download = func() ([]byte, error) {
+			raw, err := m.Download()
+			if err != nil {
+				if _, err = s.conn.LoadMediaInfo(m.Info.RemoteJid, m.Info.Id, m.Info.FromMe); err == nil {
+					raw, err = m.Download()
+				}
+			}
+			return raw, err
+		}
 	case whatsapp.DocumentMessage:
 		info = m.Info
-		msg.Text = fmt.Sprintf("%s (%s)", m.Title, m.Type)
-		msg.WAFwdMessageID = m.ContextInfo.QuotedMessageID
+		in.Kind = bridge.KindDocument
+		in.Text = fmt.Sprintf("%s (%s)", m.Title, m.Type)
+		in.FileName = m.FileName
+		in.QuotedID = m.ContextInfo.QuotedMessageID
+		in.Download = m.Download
 	case whatsapp.AudioMessage:
 		info = m.Info
-		msg.Text = m.Type
-		msg.WAFwdMessageID = m.ContextInfo.QuotedMessageID
+		in.Kind = bridge.KindAudio
+		in.Text = m.Type
+		in.QuotedID = m.ContextInfo.QuotedMessageID
+		in.Download = m.Download
 	case whatsapp.VideoMessage:
 		info = m.Info
-		msg.Text = fmt.Sprintf("%s (%s)", m.Caption, m.Type)
-		msg.WAFwdMessageID = m.ContextInfo.QuotedMessageID
+		in.Kind = bridge.KindVideo
+		in.Text = fmt.Sprintf("%s (%s)", m.Caption, m.Type)
+		in.QuotedID = m.ContextInfo.QuotedMessageID
+		in.Download = m.Download
+	case whatsapp.ContactMessage:
+		info = m.Info
+		in.Kind = bridge.KindContact
+		in.Text = m.DisplayName
+		in.VCard = m.Vcard
+		in.QuotedID = m.ContextInfo.QuotedMessageID
 	case whatsapp.LocationMessage:
 		info = m.Info
-		msg.Text = m.Name
-		msg.WAFwdMessageID = m.ContextInfo.QuotedMessageID
+		in.Kind = bridge.KindLocation
+		in.Text = m.Name
+		in.Lat = m.DegreesLatitude
+		in.Lon = m.DegreesLongitude
+		in.QuotedID = m.ContextInfo.QuotedMessageID
 	default:
 		log.Println(fmt.Sprintf("Type not implement %T", m))
 		return
@@ -55,143 +84,27 @@ func (s *Instance) handleMessage(message interface{}, doSave bool) {
 		return
 	}
 
-	name := s.conn.Store.Contacts[info.RemoteJid].Name
-	fromName := s.conn.Store.Contacts[info.SenderJid].Name
-	msg = &api.Message{
-		MGID:           s.GetID(),
-		WAClient:       info.RemoteJid,
-		WAName:         name,
-		WAFromName:     fromName,
-		WAFromClient:   info.SenderJid,
-		WAMessageID:    info.Id,
-		WATimestamp:    info.Timestamp,
-		WAFwdMessageID: msg.WAFwdMessageID,
-		Chatted:        api.ChattedNo,
-		MessageStatus:  int(info.Status),
-		Text:           msg.Text,
-	}
-
+	in.ID = info.Id
+	in.Client = info.RemoteJid
+	in.Name = s.conn.Store.Contacts[info.RemoteJid].Name
+	in.From = info.SenderJid
+	in.FromName = s.conn.Store.Contacts[info.SenderJid].Name
+	in.FromMe = info.FromMe
+	in.Timestamp = info.Timestamp
+	in.Status = int(info.Status)
 	if info.FromMe {
-		msg.WAName = "Self"
-		msg.WAClient = s.conn.Info.Wid
-	}
-
-	if !pkg.StringInSlice(msg.WAClient, s.clients) {
-		s.clients = append(s.clients, msg.WAClient)
-	}
-
-	db, ok := appCtx.FromDB(s.ctx)
-	if !ok {
-		log.Println("Store not ready")
-		return
-	}
-
-	if doSave {
-		if db.ExistMessageByWA(msg.WAMessageID) {
-			return
-		}
-
-		err := db.SaveMessage(msg)
-		if err != nil {
-			log.Println("Save store error: ", err)
-		}
-	}
-
-	tg, ok := appCtx.FromTG(s.ctx)
-	if !ok {
-		fmt.Println(msg)
-		return
-	}
-
-	chat, err := db.GetChatByClient(info.RemoteJid, s.GetID())
-	if err != nil {
-		log.Println("Get chat store error: ", err)
-	}
-	chatID := s.id
-	if chat != nil {
-		chatID = chat.TGChatID
-		msg.Chatted = api.ChattedYes
-		msg.TGUserName = chat.TGUserName
-		msg.Session = chat.Session
-	} else if info.FromMe {
-		return
-	}
-	tgMsg := &api.TGMessage{}
-	switch m := message.(type) {
-	case whatsapp.TextMessage:
-		txt := msg.Text
-		if chat == nil {
-			builder := strings.Builder{}
-			builder.WriteString(fmt.Sprintf("Client %s(%s):\n", msg.WAName, s.GetShortClient(msg.WAClient)))
-			builder.WriteString(txt)
-			txt = builder.String()
-		}
-		tgMsg, err = tg.SendMessage(chatID, txt)
-	case whatsapp.ImageMessage:
-		var raw []byte
-		raw, err = m.Download()
-		if err != nil {
-			if _, err = s.conn.LoadMediaInfo(m.Info.RemoteJid, m.Info.Id, m.Info.FromMe); err == nil {
-				raw, err = m.Download()
-			}
-		}
-		if err == nil {
-			buf := bytes.NewReader(raw)
-			tgMsg, err = tg.SendImage(chatID, buf, m.Caption)
-		}
-	case whatsapp.DocumentMessage:
-		var raw []byte
-		raw, err = m.Download()
-		if err == nil {
-			buf := bytes.NewReader(raw)
-			tgMsg, err = tg.SendDocument(chatID, buf, m.FileName)
-		}
-	case whatsapp.AudioMessage:
-		var raw []byte
-		raw, err = m.Download()
-		if err == nil {
-			buf := bytes.NewReader(raw)
-			tgMsg, err = tg.SendAudio(chatID, buf)
-		}
-	case whatsapp.VideoMessage:
-		var raw []byte
-		raw, err = m.Download()
-		if err == nil {
-			buf := bytes.NewReader(raw)
-			tgMsg, err = tg.SendVideo(chatID, buf)
-		}
-	case whatsapp.LocationMessage:
-		tgMsg, err = tg.SendLocation(chatID, m.DegreesLatitude, m.DegreesLongitude)
-	default:
-		return
+		in.Owner = s.conn.Info.Wid
 	}
 
-	if err != nil {
-		log.Println("Send message tg error: ", err)
-		return
+	client := in.Client
+	if in.FromMe {
+		client = in.Owner
 	}
-
-	msg.TGChatID = tgMsg.ChatID
-	msg.TGMessageID = tgMsg.MessageID
-	msg.TGTimestamp = tgMsg.Timestamp
-	msg.TGFwdMessageID = tgMsg.FwdMessageID
-	msg.Direction = api.DirectionWa2tg
-	if msg.TGUserName == "" {
-		msg.TGUserName = tgMsg.UserName
+	if !pkg.StringInSlice(client, s.clients) {
+		s.clients = append(s.clients, client)
 	}
 
-	if doSave {
-		err = s.ReadMessage(msg.WAClient, msg.WAMessageID)
-		if err != nil {
-			log.Println("Error read message: ", err)
-		}
-
-		err = db.SaveMessage(msg)
-		if err != nil {
-			log.Println("Save store error: ", err)
-		}
-		tg.UpdateStatMessage(1)
-	}
+	bridge.Handle(s.ctx, s, in, doSave)
 }
 
 func (s *Instance) HandleError(err error) {
@@ -202,13 +115,7 @@ func (s *Instance) HandleError(err error) {
 			errp = e.Err
 		}
 		log.Printf("Connection failed, underlying error: %v", errp)
-		log.Println("WAInstance Waiting 30sec...")
-		<-time.After(30 * time.Second)
-		log.Println("WAInstance Reconnecting...")
-		err = s.conn.Restore()
-		if err != nil {
-			log.Println("Restore failed WAInstance: ", err)
-		}
+		s.supervisor.Disconnected(errp)
 	} else {
 		log.Println("error WAInstance occoured: ", err)
 	}
@@ -238,11 +145,65 @@ func (s *Instance) HandleLocationMessage(message whatsapp.LocationMessage) {
 	s.handleMessage(message, true)
 }
 
+// HandleRawMessage catch revoke of messages, other types come through typed handlers
+func (s *Instance) HandleRawMessage(message *waproto.WebMessageInfo) {
+	protocol := message.GetMessage().GetProtocolMessage()
+	if protocol == nil || protocol.GetType() != waproto.ProtocolMessage_REVOKE {
+		return
+	}
+	by := "client"
+	if message.GetKey().GetFromMe() {
+		by = "self"
+	}
+	bridge.Revoke(s.ctx, s, protocol.GetKey().GetId(), by)
+}
+
+// HandleJsonMessage track acks of sent messages, e.g. ["Msg",{"cmd":"ack","id":"...","ack":3}]
+// or ["MsgInfo",{"cmd":"acks","id":["...","..."],"ack":2}]
 func (s *Instance) HandleJsonMessage(message string) {
-	log.Println("WAInstance message JSON: ", message)
+	var raw []json.RawMessage
+	if err := json.Unmarshal([]byte(message), &raw); err != nil || len(raw) < 2 {
+		return
+	}
+	var kind string
+	if err := json.Unmarshal(raw[0], &kind); err != nil || (kind != "Msg" && kind != "MsgInfo") {
+		return
+	}
+	var ack struct {
+		Cmd string          `json:"cmd"`
+		ID  json.RawMessage `json:"id"`
+		Ack int             `json:"ack"`
+	}
+	if err := json.Unmarshal(raw[1], &ack); err != nil {
+		return
+	}
+	var ids []string
+	switch ack.Cmd {
+	case "ack":
+		var id string
+		if err := json.Unmarshal(ack.ID, &id); err != nil {
+			return
+		}
+		ids = []string{id}
+	case "acks":
+		if err := json.Unmarshal(ack.ID, &ids); err != nil {
+			return
+		}
+	default:
+		return
+	}
+	// web ack starts with -1 (error), proto status with 0 (error)
+	status := ack.Ack + 1
+	if ack.Ack < 0 {
+		status = api.MessageStatusFailed
+	}
+	for _, id := range ids {
+		bridge.Receipt(s.ctx, id, status)
+	}
 }
 
-func (s *Instance) HandleContactMessage(_ whatsapp.ContactMessage) {
+func (s *Instance) HandleContactMessage(message whatsapp.ContactMessage) {
+	s.handleMessage(message, true)
 }
 
 func (s *Instance) HandleContactList(contacts []whatsapp.Contact) {
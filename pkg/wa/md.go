@@ -0,0 +1,168 @@
+package wa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"tgwabr/pkg/wa/bridge"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// MDInstance WhatsApp instance on the multi-device protocol
+type MDInstance struct {
+	ctx       context.Context
+	id        int64
+	client    *whatsmeow.Client
+	container *sqlstore.Container
+	api.WAInstance
+	clients    []string
+	chats      map[string]uint32
+	chatsMu    sync.RWMutex
+	pointTime  uint64
+	status     InstanceStatus
+	supervisor *bridge.Supervisor
+}
+
+func newMDInstance(ctx context.Context, id int64, pointTime uint64) (instance *MDInstance, err error) {
+
+	instance = &MDInstance{ctx: ctx, clients: []string{}, chats: map[string]uint32{}, id: id, pointTime: pointTime}
+
+	logLevel := "WARN"
+	if os.Getenv("WA_DEBUG") != "" {
+		logLevel = "DEBUG"
+	}
+
+	dialect := os.Getenv("WA_MD_DB_DIALECT")
+	address := os.Getenv("WA_MD_DB_ADDRESS")
+	if dialect == "" {
+		dialect = "sqlite3"
+	}
+	if address == "" {
+		address = fmt.Sprintf("file:%s_%d_wa_md.db?_foreign_keys=on", os.Getenv("NAME_INSTANCE"), id)
+	} else if strings.Contains(address, "%d") {
+		address = fmt.Sprintf(address, id)
+	}
+
+	instance.container, err = sqlstore.New(dialect, address, waLog.Stdout("WAStore", logLevel, false))
+	if err != nil {
+		return instance, fmt.Errorf("error open device store: %w", err)
+	}
+
+	device, err := instance.container.GetFirstDevice()
+	if err != nil {
+		return instance, fmt.Errorf("error get device: %w", err)
+	}
+
+	instance.client = whatsmeow.NewClient(device, waLog.Stdout("WAInstance", logLevel, false))
+	instance.client.EnableAutoReconnect = false
+	instance.client.AddEventHandler(instance.handleEvent)
+	instance.supervisor = newSupervisor(instance.reconnect, func(state api.ConnectionState) {
+		notifyState(instance.ctx, instance.id, state)
+	})
+
+	if err = instance.login(true); err != nil {
+		return instance, fmt.Errorf("error login: %w", err)
+	}
+
+	instance.WAInstance = instance
+
+	return
+}
+
+func (s *MDInstance) setCTX(ctx context.Context) {
+	s.ctx = ctx
+}
+
+func (s *MDInstance) shutDown() error {
+	s.supervisor.Stop()
+	s.client.Disconnect()
+	return nil
+}
+
+func (s *MDInstance) login(onlyRestore bool) error {
+
+	if s.client.Store.ID != nil {
+		if s.client.IsConnected() {
+			return nil
+		}
+		if err := s.client.Connect(); err != nil {
+			if onlyRestore {
+				log.Println("error connect: ", err)
+				s.supervisor.Disconnected(err)
+				return nil
+			}
+			return fmt.Errorf("error connect: %w", err)
+		}
+		log.Println("WAInstance Status: ", s.client.IsLoggedIn())
+		return nil
+	}
+
+	if onlyRestore {
+		log.Println("WAInstance not paired, use /login")
+		s.supervisor.LoggedOut(nil)
+		return nil
+	}
+
+	qr, err := s.client.GetQRChannel(context.Background())
+	if err != nil {
+		return fmt.Errorf("error get QR channel: %w", err)
+	}
+
+	if err = s.client.Connect(); err != nil {
+		return fmt.Errorf("error connect: %w", err)
+	}
+
+	tg, ok := appCtx.FromTG(s.ctx)
+	if !ok {
+		return fmt.Errorf("module Telegram not ready")
+	}
+
+	var tgMsg *api.TGMessage
+	deleteQR := func() {
+		if tgMsg == nil {
+			return
+		}
+		if err := tg.DeleteMessage(tgMsg.ChatID, tgMsg.MessageID); err != nil {
+			log.Println("error delete tg message: ", err)
+		}
+		tgMsg = nil
+	}
+	defer deleteQR()
+
+	for item := range qr {
+		if item.Event != "code" {
+			if item.Event == "success" {
+				return nil
+			}
+			return fmt.Errorf("error during login: %s", item.Event)
+		}
+		deleteQR()
+		tgMsg, err = tg.SendQR(s.id, item.Code)
+		if err != nil {
+			log.Printf("error send QR: %v\n", err)
+		}
+	}
+
+	return fmt.Errorf("error during login: QR channel closed")
+}
+
+func (s *MDInstance) reconnect() error {
+	if s.client.Store.ID == nil {
+		return bridge.ErrLoggedOut
+	}
+	err := s.client.Connect()
+	if err != nil && !errors.Is(err, whatsmeow.ErrAlreadyConnected) {
+		return err
+	}
+	return nil
+}
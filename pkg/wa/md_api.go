@@ -0,0 +1,501 @@
+package wa
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"tgwabr/pkg"
+	"tgwabr/pkg/wa/bridge"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/appstate"
+	waproto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+func (s *MDInstance) ReadMessage(client, sender, messageID string) (err error) {
+	jid, err := types.ParseJID(s.PrepareClientJID(client))
+	if err != nil {
+		return err
+	}
+	// in group chats sender is the participant, in private chats it is the chat itself
+	senderJID := jid
+	if sender != "" {
+		senderJID, err = types.ParseJID(sender)
+		if err != nil {
+			return err
+		}
+	}
+	err = s.client.MarkRead([]types.MessageID{messageID}, time.Now(), jid, senderJID)
+	if err != nil {
+		log.Println("WAInstance error Read message: ", err)
+		return err
+	}
+	return nil
+}
+
+func (s *MDInstance) GetStatusLogin() bool {
+	return s.client.IsLoggedIn()
+}
+
+func (s *MDInstance) GetStatusDevice() bool {
+	return s.client.IsConnected()
+}
+
+func (s *MDInstance) GetStatusContacts() (bool, int, string) {
+	desc := " not sync"
+	if s.status.ContactsLoad.Desc != "" {
+		desc = fmt.Sprintf(" sync: %s, %s", s.status.ContactsLoad.At.Format(time.RFC822), s.status.ContactsLoad.Desc)
+	}
+	contacts, err := s.client.Store.Contacts.GetAllContacts()
+	if err != nil {
+		log.Println("WAInstance error get contacts: ", err)
+		return false, 0, desc
+	}
+	return len(contacts) > 0, len(contacts), desc
+}
+
+func (s *MDInstance) GetUnreadChat() (map[string]string, int, string) {
+	res := map[string]string{}
+	desc := " not sync"
+	if s.status.ChatsLoad.Desc != "" {
+		desc = fmt.Sprintf(" sync: %s, %s", s.status.ChatsLoad.At.Format(time.RFC822), s.status.ChatsLoad.Desc)
+	}
+	s.chatsMu.RLock()
+	defer s.chatsMu.RUnlock()
+	for k, v := range s.chats {
+		if v != 0 {
+			res[k] = fmt.Sprintf("%d", v)
+		}
+	}
+	return res, len(s.chats), desc
+}
+
+func (s *MDInstance) DoLogin() (ok bool, err error) {
+	err = s.login(false)
+	if err != nil {
+		log.Println("WAInstance error login: ", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *MDInstance) DoLogout() (bool, error) {
+	err := s.client.Logout()
+	if err != nil {
+		log.Println("WAInstance error logout: ", err)
+		return false, err
+	}
+	s.supervisor.LoggedOut(nil)
+	return true, nil
+}
+
+func (s *MDInstance) GetConnectionState() api.ConnectionState {
+	return s.supervisor.State()
+}
+
+func (s *MDInstance) ClientExist(client string) bool {
+	jid, err := types.ParseJID(s.PrepareClientJID(client))
+	if err != nil {
+		return false
+	}
+	contact, err := s.client.Store.Contacts.GetContact(jid)
+	ok := err == nil && contact.Found
+	if !ok {
+		ok = pkg.StringInSlice(jid.String(), s.clients)
+	}
+	if !ok && jid.Server == types.DefaultUserServer {
+		items, err := s.client.IsOnWhatsApp([]string{"+" + jid.User})
+		if err == nil {
+			log.Println("WAInstance Exist result: ", items)
+			ok = len(items) > 0 && items[0].IsIn
+		} else {
+			log.Println("WAInstance Exist error: ", err)
+		}
+	}
+	return ok
+}
+
+func (s *MDInstance) GetShortClient(client string) string {
+	parts := strings.Split(client, "@")
+	if len(parts) > 1 {
+		return parts[0]
+	}
+	return client
+}
+
+func (s *MDInstance) GetClientName(client string) string {
+	jid, err := types.ParseJID(s.PrepareClientJID(client))
+	if err == nil {
+		v, err := s.client.Store.Contacts.GetContact(jid)
+		if err == nil && v.Found {
+			if v.FullName != "" {
+				return v.FullName
+			}
+			if v.FirstName != "" {
+				return v.FirstName
+			}
+			if v.PushName != "" {
+				return v.PushName
+			}
+		}
+	}
+
+	db, ok := appCtx.FromDB(s.ctx)
+	if ok {
+		items, err := db.GetContactsByWAClient(jid.String())
+		if err != nil {
+			log.Println("Get contact error: ", err)
+		}
+		if len(items) != 0 {
+			itm := items[0]
+			if itm.Name == "" {
+				return itm.ShortName
+			}
+			return itm.Name
+		}
+	} else {
+		log.Println("Store not ready")
+	}
+
+	if !pkg.StringInSlice(client, s.clients) {
+		return "Not Sync"
+	} else {
+		return "New Client"
+	}
+}
+
+func (s *MDInstance) contextInfo(jid types.JID, QuotedID, Quoted string) *waproto.ContextInfo {
+	if len(QuotedID) == 0 {
+		return nil
+	}
+	return &waproto.ContextInfo{
+		StanzaId:    proto.String(QuotedID),
+		Participant: proto.String(s.quotedSender(jid, QuotedID).String()),
+		QuotedMessage: &waproto.Message{
+			Conversation: proto.String(Quoted),
+		},
+	}
+}
+
+// quotedSender author of quoted message: own JID for message sent from Telegram, sender of the message in
+// group, chat JID when message is unknown
+func (s *MDInstance) quotedSender(jid types.JID, quotedID string) types.JID {
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		log.Println("Store not ready")
+		return jid
+	}
+	msg, err := db.GetMessageByWA(quotedID)
+	if err != nil {
+		log.Println("Get quoted message error: ", err)
+		return jid
+	}
+	if msg == nil {
+		return jid
+	}
+	if msg.Direction == api.DirectionTg2wa {
+		if s.client.Store.ID != nil {
+			return s.client.Store.ID.ToNonAD()
+		}
+		return jid
+	}
+	if msg.WAFromClient != "" {
+		if sender, err := types.ParseJID(msg.WAFromClient); err == nil {
+			return sender
+		}
+	}
+	return jid
+}
+
+func (s *MDInstance) send(jid types.JID, message *waproto.Message) (msg *api.WAMessage, err error) {
+	msgId := whatsmeow.GenerateMessageID()
+	ts, err := s.client.SendMessage(jid, msgId, message)
+	if err != nil {
+		return nil, err
+	}
+	name := s.GetClientName(jid.String())
+	return &api.WAMessage{
+		Client:    jid.String(),
+		Name:      name,
+		MessageID: msgId,
+		Timestamp: uint64(ts.Unix()),
+	}, nil
+}
+
+func (s *MDInstance) upload(reader io.Reader, mediaType whatsmeow.MediaType) (resp whatsmeow.UploadResponse, size uint64, err error) {
+	raw, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return resp, 0, err
+	}
+	resp, err = s.client.Upload(context.Background(), raw, mediaType)
+	return resp, uint64(len(raw)), err
+}
+
+func (s *MDInstance) SendMessage(client, text, QuotedID, Quoted string) (msg *api.WAMessage, err error) {
+	jid, err := types.ParseJID(s.PrepareClientJID(client))
+	if err != nil {
+		return nil, err
+	}
+	item := &waproto.Message{Conversation: proto.String(text)}
+	if ctxInfo := s.contextInfo(jid, QuotedID, Quoted); ctxInfo != nil {
+		item = &waproto.Message{
+			ExtendedTextMessage: &waproto.ExtendedTextMessage{
+				Text:        proto.String(text),
+				ContextInfo: ctxInfo,
+			},
+		}
+	}
+	return s.send(jid, item)
+}
+
+func (s *MDInstance) SendImage(client string, reader io.Reader, mime string, QuotedID string, Quoted string) (msg *api.WAMessage, err error) {
+	jid, err := types.ParseJID(s.PrepareClientJID(client))
+	if err != nil {
+		return nil, err
+	}
+	resp, size, err := s.upload(reader, whatsmeow.MediaImage)
+	if err != nil {
+		return nil, err
+	}
+	return s.send(jid, &waproto.Message{
+		ImageMessage: &waproto.ImageMessage{
+			Url:           proto.String(resp.URL),
+			DirectPath:    proto.String(resp.DirectPath),
+			MediaKey:      resp.MediaKey,
+			Mimetype:      proto.String(mime),
+			FileEncSha256: resp.FileEncSHA256,
+			FileSha256:    resp.FileSHA256,
+			FileLength:    proto.Uint64(size),
+			ContextInfo:   s.contextInfo(jid, QuotedID, Quoted),
+		},
+	})
+}
+
+func (s *MDInstance) SendDocument(client string, reader io.Reader, mime string, fileName string, QuotedID string, Quoted string) (msg *api.WAMessage, err error) {
+	jid, err := types.ParseJID(s.PrepareClientJID(client))
+	if err != nil {
+		return nil, err
+	}
+	resp, size, err := s.upload(reader, whatsmeow.MediaDocument)
+	if err != nil {
+		return nil, err
+	}
+	return s.send(jid, &waproto.Message{
+		DocumentMessage: &waproto.DocumentMessage{
+			Url:           proto.String(resp.URL),
+			DirectPath:    proto.String(resp.DirectPath),
+			MediaKey:      resp.MediaKey,
+			Mimetype:      proto.String(mime),
+			FileName:      proto.String(fileName),
+			Title:         proto.String(fileName),
+			FileEncSha256: resp.FileEncSHA256,
+			FileSha256:    resp.FileSHA256,
+			FileLength:    proto.Uint64(size),
+			ContextInfo:   s.contextInfo(jid, QuotedID, Quoted),
+		},
+	})
+}
+
+func (s *MDInstance) SendAudio(client string, reader io.Reader, mime string, QuotedID string, Quoted string) (msg *api.WAMessage, err error) {
+	jid, err := types.ParseJID(s.PrepareClientJID(client))
+	if err != nil {
+		return nil, err
+	}
+	resp, size, err := s.upload(reader, whatsmeow.MediaAudio)
+	if err != nil {
+		return nil, err
+	}
+	return s.send(jid, &waproto.Message{
+		AudioMessage: &waproto.AudioMessage{
+			Url:           proto.String(resp.URL),
+			DirectPath:    proto.String(resp.DirectPath),
+			MediaKey:      resp.MediaKey,
+			Mimetype:      proto.String(mime),
+			FileEncSha256: resp.FileEncSHA256,
+			FileSha256:    resp.FileSHA256,
+			FileLength:    proto.Uint64(size),
+			ContextInfo:   s.contextInfo(jid, QuotedID, Quoted),
+		},
+	})
+}
+
+func (s *MDInstance) SendVideo(client string, reader io.Reader, mime string, QuotedID string, Quoted string) (msg *api.WAMessage, err error) {
+	jid, err := types.ParseJID(s.PrepareClientJID(client))
+	if err != nil {
+		return nil, err
+	}
+	resp, size, err := s.upload(reader, whatsmeow.MediaVideo)
+	if err != nil {
+		return nil, err
+	}
+	return s.send(jid, &waproto.Message{
+		VideoMessage: &waproto.VideoMessage{
+			Url:           proto.String(resp.URL),
+			DirectPath:    proto.String(resp.DirectPath),
+			MediaKey:      resp.MediaKey,
+			Mimetype:      proto.String(mime),
+			FileEncSha256: resp.FileEncSHA256,
+			FileSha256:    resp.FileSHA256,
+			FileLength:    proto.Uint64(size),
+			ContextInfo:   s.contextInfo(jid, QuotedID, Quoted),
+		},
+	})
+}
+
+func (s *MDInstance) SendLocation(client string, lat, lon float64, QuotedID string, Quoted string) (msg *api.WAMessage, err error) {
+	jid, err := types.ParseJID(s.PrepareClientJID(client))
+	if err != nil {
+		return nil, err
+	}
+	return s.send(jid, &waproto.Message{
+		LocationMessage: &waproto.LocationMessage{
+			DegreesLatitude:  proto.Float64(lat),
+			DegreesLongitude: proto.Float64(lon),
+			ContextInfo:      s.contextInfo(jid, QuotedID, Quoted),
+		},
+	})
+}
+
+func (s *MDInstance) SendContact(client, name, phone string, QuotedID string, Quoted string) (msg *api.WAMessage, err error) {
+	jid, err := types.ParseJID(s.PrepareClientJID(client))
+	if err != nil {
+		return nil, err
+	}
+	card := bridge.VCard{Name: name, Phones: []string{phone}}
+	return s.send(jid, &waproto.Message{
+		ContactMessage: &waproto.ContactMessage{
+			DisplayName: proto.String(name),
+			Vcard:       proto.String(card.String()),
+			ContextInfo: s.contextInfo(jid, QuotedID, Quoted),
+		},
+	})
+}
+
+func (s *MDInstance) RevokeMessage(client, messageID string, fromMe bool) (err error) {
+	if !fromMe {
+		return fmt.Errorf("only own messages can be revoked")
+	}
+	jid, err := types.ParseJID(s.PrepareClientJID(client))
+	if err != nil {
+		return err
+	}
+	_, err = s.client.RevokeMessage(jid, messageID)
+	return
+}
+
+// GetHistory relay the last stored messages with client to Telegram, multi-device protocol does not load chat
+// history on demand
+func (s *MDInstance) GetHistory(client string, size int) (err error) {
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return fmt.Errorf("module Store not ready")
+	}
+	client = s.PrepareClientJID(client)
+	items, err := db.GetLastMessagesByClient(s.GetID(), client, size)
+	if err != nil {
+		return err
+	}
+	for _, v := range items {
+		screenName := "Client"
+		if v.Direction == api.DirectionTg2wa {
+			screenName = "Me"
+			if v.TGUserName != "" {
+				screenName = "@" + v.TGUserName
+			}
+		}
+		in := &bridge.Inbound{
+			Kind:      bridge.KindText,
+			ID:        v.WAMessageID,
+			Client:    client,
+			Name:      v.WAName,
+			From:      v.WAFromClient,
+			FromName:  v.WAFromName,
+			Timestamp: v.WATimestamp,
+			Text:      fmt.Sprintf("%s %s: %s", time.Unix(int64(v.WATimestamp), 0), screenName, v.Text),
+		}
+		if in.From == "" {
+			in.From, in.FromName = client, s.GetClientName(client)
+		}
+		bridge.Handle(s.ctx, s, in, false)
+	}
+	return nil
+}
+
+func (s *MDInstance) GetContactPhoto(client string) (result string, err error) {
+	jid, err := types.ParseJID(s.PrepareClientJID(client))
+	if err != nil {
+		return "", err
+	}
+	info, err := s.client.GetProfilePictureInfo(jid, false)
+	if err != nil {
+		return "", err
+	}
+	if info == nil {
+		return "", nil
+	}
+	return info.URL, nil
+}
+
+func (s *MDInstance) PrepareClientJID(client string) string {
+	if strings.Count(client, "@") > 0 {
+		return client
+	}
+	jidPrefix := types.DefaultUserServer
+	if len(strings.SplitN(client, "-", 2)) == 2 {
+		jidPrefix = types.GroupServer
+	} else if len(client) > 14 {
+		jidPrefix = types.GroupServer
+	}
+	return fmt.Sprintf("%s@%s", client, jidPrefix)
+}
+
+func (s *MDInstance) PartsClientJID(jid string) (string, string) {
+	if strings.Count(jid, "@") > 0 {
+		parts := strings.Split(jid, "@")
+		return parts[0], parts[1]
+	}
+	return "", ""
+}
+
+func (s *MDInstance) GetID() string {
+	return fmt.Sprintf("%d", s.id)
+}
+
+func (s *MDInstance) SyncContacts() (bool, error) {
+	err := s.client.FetchAppState(appstate.WAPatchCriticalUnblockLow, true, false)
+	if err != nil {
+		log.Println("WAInstance SyncContact error: ", err)
+		return false, err
+	}
+	s.handleContactList()
+	return true, nil
+}
+
+func (s *MDInstance) SyncChats() (bool, error) {
+	s.handleChatList()
+	return s.countChats() > 0, nil
+}
+
+func (s *MDInstance) sendStatusReady() {
+	if !(strings.Count(s.status.ContactsLoad.Desc, "Load") > 0 &&
+		strings.Count(s.status.ChatsLoad.Desc, "Load") > 0) {
+		return
+	}
+
+	log.Println("WAInstance is sync")
+
+	tg, ok := appCtx.FromTG(s.ctx)
+	if !ok {
+		return
+	}
+
+	_, _ = tg.SendMessage(s.id, "Bot is sync... check /status", 0, 0)
+}
@@ -0,0 +1,250 @@
+package wa
+
+import (
+	"fmt"
+	"log"
+	"tgwabr/api"
+	appCtx "tgwabr/context"
+	"tgwabr/pkg"
+	"tgwabr/pkg/wa/bridge"
+	"time"
+
+	"go.mau.fi/whatsmeow/appstate"
+	waproto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func (s *MDInstance) handleEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.Message:
+		s.handleMessage(v, true)
+	case *events.Connected:
+		log.Println("WAInstance connected")
+		s.supervisor.Connected()
+	case *events.Disconnected:
+		log.Println("WAInstance disconnected")
+		s.supervisor.Disconnected(fmt.Errorf("websocket disconnected"))
+	case *events.StreamReplaced:
+		log.Println("WAInstance stream replaced by another client")
+		s.supervisor.LoggedOut(fmt.Errorf("stream replaced by another client"))
+	case *events.LoggedOut:
+		log.Println("WAInstance logged out: ", v.OnConnect)
+		s.supervisor.LoggedOut(nil)
+	case *events.Receipt:
+		s.handleReceipt(v)
+	case *events.HistorySync:
+		s.chatsMu.Lock()
+		for _, conv := range v.Data.GetConversations() {
+			s.chats[conv.GetId()] = conv.GetUnreadCount()
+		}
+		s.chatsMu.Unlock()
+		s.handleChatList()
+	case *events.AppStateSyncComplete:
+		if v.Name == appstate.WAPatchCriticalUnblockLow {
+			s.handleContactList()
+		}
+	}
+}
+
+func (s *MDInstance) handleMessage(evt *events.Message, doSave bool) {
+	in := &bridge.Inbound{}
+	m := unwrapMessage(evt.Message)
+	if protocol := m.GetProtocolMessage(); protocol != nil {
+		if protocol.GetType() == waproto.ProtocolMessage_REVOKE && doSave {
+			by := "client"
+			if evt.Info.IsFromMe {
+				by = "self"
+			}
+			bridge.Revoke(s.ctx, s, protocol.GetKey().GetId(), by)
+		}
+		return
+	}
+
+	switch {
+	case m.GetConversation() != "":
+		in.Kind = bridge.KindText
+		in.Text = m.GetConversation()
+	case m.GetExtendedTextMessage() != nil:
+		item := m.GetExtendedTextMessage()
+		in.Kind = bridge.KindText
+		in.Text = item.GetText()
+		in.QuotedID = item.GetContextInfo().GetStanzaId()
+	case m.GetImageMessage() != nil:
+		item := m.GetImageMessage()
+		in.Kind = bridge.KindImage
+		in.Text = fmt.Sprintf("%s (%s)", item.GetCaption(), item.GetMimetype())
+		in.Caption = item.GetCaption()
+		in.QuotedID = item.GetContextInfo().GetStanzaId()
+		in.Download = func() ([]byte, error) { return s.client.Download(item) }
+	case m.GetDocumentMessage() != nil:
+		item := m.GetDocumentMessage()
+		in.Kind = bridge.KindDocument
+		in.Text = fmt.Sprintf("%s (%s)", item.GetTitle(), item.GetMimetype())
+		in.FileName = item.GetFileName()
+		in.QuotedID = item.GetContextInfo().GetStanzaId()
+		in.Download = func() ([]byte, error) { return s.client.Download(item) }
+	case m.GetAudioMessage() != nil:
+		item := m.GetAudioMessage()
+		in.Kind = bridge.KindAudio
+		in.Text = item.GetMimetype()
+		in.QuotedID = item.GetContextInfo().GetStanzaId()
+		in.Download = func() ([]byte, error) { return s.client.Download(item) }
+	case m.GetVideoMessage() != nil:
+		item := m.GetVideoMessage()
+		in.Kind = bridge.KindVideo
+		in.Text = fmt.Sprintf("%s (%s)", item.GetCaption(), item.GetMimetype())
+		in.QuotedID = item.GetContextInfo().GetStanzaId()
+		in.Download = func() ([]byte, error) { return s.client.Download(item) }
+	case m.GetContactMessage() != nil:
+		item := m.GetContactMessage()
+		in.Kind = bridge.KindContact
+		in.Text = item.GetDisplayName()
+		in.VCard = item.GetVcard()
+		in.QuotedID = item.GetContextInfo().GetStanzaId()
+	case m.GetLocationMessage() != nil:
+		item := m.GetLocationMessage()
+		in.Kind = bridge.KindLocation
+		in.Text = item.GetName()
+		in.Lat = item.GetDegreesLatitude()
+		in.Lon = item.GetDegreesLongitude()
+		in.QuotedID = item.GetContextInfo().GetStanzaId()
+	default:
+		log.Println(fmt.Sprintf("Type not implement %s", evt.Info.Type))
+		return
+	}
+
+	timestamp := uint64(evt.Info.Timestamp.Unix())
+	if timestamp < s.pointTime && doSave {
+		return
+	}
+
+	if evt.Info.Chat == types.StatusBroadcastJID {
+		return
+	}
+
+	in.ID = evt.Info.ID
+	in.Client = evt.Info.Chat.String()
+	in.Name = s.contactName(evt.Info.Chat, "")
+	in.From = evt.Info.Sender.ToNonAD().String()
+	in.FromName = s.contactName(evt.Info.Sender.ToNonAD(), evt.Info.PushName)
+	in.FromMe = evt.Info.IsFromMe
+	in.Timestamp = timestamp
+	in.Status = int(waproto.WebMessageInfo_DELIVERY_ACK)
+	if evt.Info.IsFromMe && s.client.Store.ID != nil {
+		in.Owner = s.client.Store.ID.ToNonAD().String()
+	}
+
+	client := in.Client
+	if in.FromMe {
+		client = in.Owner
+	}
+	if !pkg.StringInSlice(client, s.clients) {
+		s.clients = append(s.clients, client)
+	}
+
+	bridge.Handle(s.ctx, s, in, doSave)
+}
+
+// unwrapMessage content of disappearing and view once messages, they wrap usual message
+func unwrapMessage(m *waproto.Message) *waproto.Message {
+	for {
+		switch {
+		case m.GetEphemeralMessage() != nil:
+			m = m.GetEphemeralMessage().GetMessage()
+		case m.GetViewOnceMessage() != nil:
+			m = m.GetViewOnceMessage().GetMessage()
+		default:
+			return m
+		}
+	}
+}
+
+func (s *MDInstance) handleReceipt(evt *events.Receipt) {
+	if evt.IsFromMe {
+		return
+	}
+	var status int
+	switch string(evt.Type) {
+	case "":
+		status = api.MessageStatusDeliveryAck
+	case "read":
+		status = api.MessageStatusRead
+	case "played":
+		status = api.MessageStatusPlayed
+	default:
+		return
+	}
+	for _, id := range evt.MessageIDs {
+		bridge.Receipt(s.ctx, id, status)
+	}
+}
+
+func (s *MDInstance) contactName(jid types.JID, pushName string) string {
+	contact, err := s.client.Store.Contacts.GetContact(jid)
+	if err == nil && contact.Found {
+		if contact.FullName != "" {
+			return contact.FullName
+		}
+		if contact.PushName != "" {
+			return contact.PushName
+		}
+	}
+	return pushName
+}
+
+func (s *MDInstance) handleContactList() {
+	contacts, err := s.client.Store.Contacts.GetAllContacts()
+	if err != nil {
+		log.Println("WAInstance contacts load error: ", err)
+		return
+	}
+	log.Printf("WAInstance contacts load: %d\n", len(contacts))
+	s.status.ContactsLoad.At = time.Now()
+	if len(contacts) == 0 {
+		s.status.ContactsLoad.Desc = "Receive empty"
+		return
+	}
+	s.status.ContactsLoad.Desc = fmt.Sprintf("Load: %d", len(contacts))
+	s.sendStatusReady()
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		log.Println("Store not ready")
+		return
+	}
+	for jid, v := range contacts {
+		if jid.Server != types.DefaultUserServer {
+			continue
+		}
+		if v.FullName == "" {
+			continue
+		}
+		err := db.SaveContact(&api.Contact{
+			Phone:     jid.User,
+			WAClient:  jid.String(),
+			Name:      v.FullName,
+			ShortName: v.FirstName,
+		})
+		if err != nil {
+			log.Println("Sync Store contacts error: ", err)
+		}
+	}
+}
+
+func (s *MDInstance) countChats() int {
+	s.chatsMu.RLock()
+	defer s.chatsMu.RUnlock()
+	return len(s.chats)
+}
+
+func (s *MDInstance) handleChatList() {
+	count := s.countChats()
+	log.Printf("WAInstance chat load: %d\n", count)
+	s.status.ChatsLoad.At = time.Now()
+	if count > 0 {
+		s.status.ChatsLoad.Desc = fmt.Sprintf("Load: %d", count)
+		s.sendStatusReady()
+	} else {
+		s.status.ChatsLoad.Desc = "Receive empty"
+	}
+}
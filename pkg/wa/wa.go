@@ -1,6 +1,7 @@
 package wa
 
 import (
+	"bytes"
 	"context"
 	"encoding/gob"
 	"errors"
@@ -11,16 +12,24 @@ import (
 	"strings"
 	"tgwabr/api"
 	appCtx "tgwabr/context"
+	"tgwabr/pkg"
+	"tgwabr/pkg/wa/bridge"
 	"time"
 
 	"github.com/cristalinojr/go-whatsapp"
 )
 
 type Service struct {
-	instances map[int64]*Instance
+	instances map[int64]instance
 	api.WA
 }
 
+type instance interface {
+	api.WAInstance
+	setCTX(ctx context.Context)
+	shutDown() error
+}
+
 type StatusItem struct {
 	At   time.Time
 	Desc string
@@ -36,20 +45,23 @@ type Instance struct {
 	id   int64
 	conn *whatsapp.Conn
 	api.WAInstance
-	clients   []string
-	pointTime uint64
-	status    InstanceStatus
+	clients    []string
+	pointTime  uint64
+	status     InstanceStatus
+	supervisor *bridge.Supervisor
 }
 
 func New(ctx context.Context) (service *Service, err error) {
 
-	service = &Service{instances: map[int64]*Instance{}}
+	service = &Service{instances: map[int64]instance{}}
 	pointTimeStr := os.Getenv("WA_POINT_TIME")
 	pointTime, err := strconv.ParseUint(pointTimeStr, 10, 64)
 	if err != nil {
 		pointTime = 0
 	}
 
+	multiDevice := strings.Split(os.Getenv("WA_MD_GROUPS"), ",")
+
 	items := strings.Split(os.Getenv("TG_MAIN_GROUPS"), ",")
 
 	for _, v := range items {
@@ -59,41 +71,76 @@ func New(ctx context.Context) (service *Service, err error) {
 			return service, fmt.Errorf("error parse ID: %w", err)
 		}
 
-		instance := &Instance{ctx: ctx, clients: []string{}, id: id, pointTime: pointTime}
-
-		instance.conn, err = whatsapp.NewConn(30 * time.Second)
+		if pkg.StringInSlice(v, multiDevice) {
+			service.instances[id], err = newMDInstance(ctx, id, pointTime)
+		} else {
+			service.instances[id], err = newInstance(ctx, id, pointTime)
+		}
 		if err != nil {
-			return service, fmt.Errorf("error creating connection: %w", err)
+			return service, err
 		}
+	}
 
-		instance.conn.SetClientVersion(2, 2208, 14)
+	return
+}
 
-		instance.conn.AddHandler(instance)
-		if err = instance.login(true); err != nil {
-			return service, fmt.Errorf("error login: %w", err)
-		}
+func newInstance(ctx context.Context, id int64, pointTime uint64) (instance *Instance, err error) {
 
-		instance.WAInstance = instance
-		service.instances[id] = instance
+	instance = &Instance{ctx: ctx, clients: []string{}, id: id, pointTime: pointTime}
+
+	instance.conn, err = whatsapp.NewConn(30 * time.Second)
+	if err != nil {
+		return instance, fmt.Errorf("error creating connection: %w", err)
 	}
 
+	instance.conn.SetClientVersion(2, 2208, 14)
+
+	instance.supervisor = newSupervisor(instance.reconnect, func(state api.ConnectionState) {
+		notifyState(instance.ctx, instance.id, state)
+	})
+
+	instance.conn.AddHandler(instance)
+	if err = instance.login(true); err != nil {
+		return instance, fmt.Errorf("error login: %w", err)
+	}
+
+	instance.WAInstance = instance
+
 	return
 }
 
+func newSupervisor(connect func() error, notify func(state api.ConnectionState)) *bridge.Supervisor {
+	supervisor := bridge.NewSupervisor(connect, notify)
+	if v, err := time.ParseDuration(os.Getenv("WA_RECONNECT_MIN")); err == nil {
+		supervisor.Min = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("WA_RECONNECT_MAX")); err == nil {
+		supervisor.Max = v
+	}
+	return supervisor
+}
+
+func notifyState(ctx context.Context, id int64, state api.ConnectionState) {
+	tg, ok := appCtx.FromTG(ctx)
+	if !ok {
+		return
+	}
+	_, err := tg.SendMessage(id, fmt.Sprintf("WhatsApp connection: %s", state.Describe(time.Now())), 0, 0)
+	if err != nil {
+		log.Println("WAInstance error send connection state: ", err)
+	}
+}
+
 func (s *Service) UpdateCTX(ctx context.Context) {
-	for k := range s.instances {
-		s.instances[k].ctx = ctx
+	for _, v := range s.instances {
+		v.setCTX(ctx)
 	}
 }
 
 func (s *Service) ShutDown() error {
 	for _, v := range s.instances {
-		session, err := v.conn.Disconnect()
-		if err != nil {
-			return fmt.Errorf("error disconnecting: %w", err)
-		}
-		if err = v.writeSession(session); err != nil {
-			return fmt.Errorf("error saving session: %w", err)
+		if err := v.shutDown(); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -104,6 +151,22 @@ func (s *Service) GetInstance(id int64) (api.WAInstance, bool) {
 	return item, ok
 }
 
+func (s *Instance) setCTX(ctx context.Context) {
+	s.ctx = ctx
+}
+
+func (s *Instance) shutDown() error {
+	s.supervisor.Stop()
+	session, err := s.conn.Disconnect()
+	if err != nil {
+		return fmt.Errorf("error disconnecting: %w", err)
+	}
+	if err = s.writeSession(session); err != nil {
+		return fmt.Errorf("error saving session: %w", err)
+	}
+	return nil
+}
+
 func (s *Instance) login(onlyRestore bool) error {
 
 	var ok bool
@@ -138,6 +201,13 @@ func (s *Instance) login(onlyRestore bool) error {
 		if !onlyRestore {
 			return fmt.Errorf("error ping: %w", err)
 		}
+		if ok {
+			s.supervisor.Disconnected(err)
+		} else {
+			s.supervisor.LoggedOut(nil)
+		}
+	} else {
+		s.supervisor.Connected()
 	}
 
 	log.Println("WAInstance Status: ", ok)
@@ -155,6 +225,17 @@ func (s *Instance) login(onlyRestore bool) error {
 	return nil
 }
 
+func (s *Instance) reconnect() error {
+	err := s.conn.Restore()
+	if err == nil || errors.Is(err, whatsapp.ErrAlreadyConnected) || errors.Is(err, whatsapp.ErrAlreadyLoggedIn) {
+		return nil
+	}
+	if errors.Is(err, whatsapp.ErrInvalidSession) {
+		return fmt.Errorf("%w: %v", bridge.ErrLoggedOut, err)
+	}
+	return err
+}
+
 func (s *Instance) restore() (ok bool, err error) {
 	err = s.conn.Restore()
 	if err != nil && (errors.Is(err, whatsapp.ErrAlreadyConnected) || errors.Is(err, whatsapp.ErrAlreadyLoggedIn)) {
@@ -218,18 +299,20 @@ func (s *Instance) loginSession() (ok bool, err error) {
 
 func (s *Instance) readSession() (whatsapp.Session, error) {
 	session := whatsapp.Session{}
-	file, err := os.Open(fmt.Sprintf("%d_wa_instance_session.gob", s.id))
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return session, fmt.Errorf("store not ready")
+	}
+
+	raw, err := db.GetSession(s.GetID())
 	if err != nil {
 		return session, err
 	}
-	defer func() {
-		err := file.Close()
-		if err != nil {
-			log.Println("error close file: ", err)
-		}
-	}()
+	if raw == nil {
+		return s.importSession()
+	}
 
-	decoder := gob.NewDecoder(file)
+	decoder := gob.NewDecoder(bytes.NewReader(raw))
 	if err = decoder.Decode(&session); err != nil {
 		return session, err
 	}
@@ -238,10 +321,28 @@ func (s *Instance) readSession() (whatsapp.Session, error) {
 }
 
 func (s *Instance) writeSession(session whatsapp.Session) error {
-	file, err := os.Create(fmt.Sprintf("%d_wa_instance_session.gob", s.id))
-	if err != nil {
+	db, ok := appCtx.FromDB(s.ctx)
+	if !ok {
+		return fmt.Errorf("store not ready")
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := gob.NewEncoder(buf)
+	if err := encoder.Encode(session); err != nil {
 		return err
 	}
+
+	return db.SaveSession(s.GetID(), buf.Bytes())
+}
+
+// importSession move session from gob file of previous versions to the store
+func (s *Instance) importSession() (whatsapp.Session, error) {
+	session := whatsapp.Session{}
+	fileName := fmt.Sprintf("%d_wa_instance_session.gob", s.id)
+	file, err := os.Open(fileName)
+	if err != nil {
+		return session, err
+	}
 	defer func() {
 		err := file.Close()
 		if err != nil {
@@ -249,10 +350,19 @@ func (s *Instance) writeSession(session whatsapp.Session) error {
 		}
 	}()
 
-	encoder := gob.NewEncoder(file)
-	if err = encoder.Encode(session); err != nil {
-		return err
+	decoder := gob.NewDecoder(file)
+	if err = decoder.Decode(&session); err != nil {
+		return session, err
 	}
 
-	return nil
+	if err = s.writeSession(session); err != nil {
+		return session, fmt.Errorf("error import session: %w", err)
+	}
+
+	if err = os.Remove(fileName); err != nil {
+		log.Println("error remove imported session file: ", err)
+	}
+	log.Println("WAInstance session imported from ", fileName)
+
+	return session, nil
 }
@@ -48,7 +48,7 @@ func Init() func() {
 	tgImpl.UpdateCTX(ctx)
 
 	for _, v := range tgImpl.GetMainGroups() {
-		_, _ = tgImpl.SendMessage(v, "Bot start! Please wait all sync! Check /status")
+		_, _ = tgImpl.SendMessage(v, "Bot start! Please wait all sync! Check /status", 0, 0)
 	}
 
 	return func() {